@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/firehose"
+	"github.com/blackmichael/bluesky-feeds/internal/httpserver"
+	"github.com/blackmichael/bluesky-feeds/internal/sqlite"
+)
+
+const usage = `Usage: feedctl <command> [flags]
+
+Commands:
+  delete-before   Delete all indexed posts older than a given time
+  export          Write all indexed posts as JSON lines
+  import          Load posts from JSON lines written by export
+  posts           List a feed's posts with author and text, newest first
+  did-doc         Print the did:web document the server would serve
+  replay-estimate Estimate how many events a restart would replay from the saved cursor
+`
+
+// batchSize is the number of rows read or written per database round trip
+// by export and import.
+const batchSize = 1000
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("a command is required")
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "delete-before":
+		return runDeleteBefore(ctx, args[1:])
+	case "export":
+		return runExport(ctx, args[1:])
+	case "import":
+		return runImport(ctx, args[1:])
+	case "posts":
+		return runPosts(ctx, args[1:])
+	case "did-doc":
+		return runDIDDoc(args[1:])
+	case "replay-estimate":
+		return runReplayEstimate(ctx, args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runDeleteBefore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("delete-before", flag.ExitOnError)
+	dbPath := dbPathFlag(fs)
+	before := fs.String("before", "", "Delete posts indexed before this time (RFC 3339 or YYYY-MM-DD, UTC)")
+	fs.Parse(args)
+
+	if *before == "" {
+		return fmt.Errorf("--before is required")
+	}
+	t, err := parseTime(*before)
+	if err != nil {
+		return err
+	}
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	fmt.Printf("Deleting posts indexed before %s...\n", t.Format(time.RFC3339))
+	deleted, err := repo.DeletePostsBefore(ctx, t)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d posts\n", deleted)
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := dbPathFlag(fs)
+	out := fs.String("out", "-", "Output file, or - for stdout")
+	fs.Parse(args)
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var n int
+	err = repo.ExportPosts(ctx, batchSize, func(row sqlite.PostRow) error {
+		n++
+		return enc.Encode(row)
+	})
+	if err != nil {
+		return fmt.Errorf("export posts: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d posts\n", n)
+	return nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := dbPathFlag(fs)
+	in := fs.String("in", "-", "Input file, or - for stdin")
+	fs.Parse(args)
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	r := os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("open input file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	batch := make([]sqlite.PostRow, 0, batchSize)
+	var total int
+	flush := func() error {
+		n, err := repo.ImportPosts(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("import posts: %w", err)
+		}
+		total += n
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		var row sqlite.PostRow
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("decode row %d: %w", total+len(batch)+1, err)
+		}
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d posts\n", total)
+	return nil
+}
+
+func runPosts(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("posts", flag.ExitOnError)
+	dbPath := dbPathFlag(fs)
+	feedURI := fs.String("feed", "", "AT-URI of the feed generator record")
+	limit := fs.Int("limit", 25, "Number of posts to list")
+	cursor := fs.String("cursor", "", "Cursor printed by a previous call, to list the next page")
+	fs.Parse(args)
+
+	if *feedURI == "" {
+		return fmt.Errorf("--feed is required")
+	}
+	if *limit < 1 {
+		return fmt.Errorf("--limit must be at least 1")
+	}
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	posts, next, err := repo.GetFeedPostsDetailed(ctx, *feedURI, *limit, *cursor)
+	if err != nil {
+		return fmt.Errorf("list posts: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, p := range posts {
+		if err := enc.Encode(p); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+	}
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "Next page: --cursor %s\n", next)
+	}
+	return nil
+}
+
+func runDIDDoc(args []string) error {
+	fs := flag.NewFlagSet("did-doc", flag.ExitOnError)
+	def, _ := config.Getenv("FEEDGEN_HOSTNAME")
+	hostname := fs.String("hostname", def, "Public hostname of the server (defaults to FEEDGEN_HOSTNAME)")
+	fs.Parse(args)
+
+	if *hostname == "" {
+		return fmt.Errorf("--hostname is required (or set FEEDGEN_HOSTNAME)")
+	}
+
+	host := config.Host{Hostname: *hostname}
+	doc, err := json.MarshalIndent(httpserver.DIDDocument(host), "", "  ")
+	if err != nil {
+		return fmt.Errorf("render DID document: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Service DID: %s\n", host.ServiceDID())
+	fmt.Println(string(doc))
+	return nil
+}
+
+func runReplayEstimate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay-estimate", flag.ExitOnError)
+	dbPath := dbPathFlag(fs)
+	rate := fs.Float64("rate", 50, "Average firehose events per second for the collections the server subscribes to (see events_received in the firehose stats log)")
+	window := fs.Duration("window", 24*time.Hour, "How far back the Jetstream instance keeps events; older cursors can't be replayed in full")
+	fs.Parse(args)
+
+	if *rate <= 0 {
+		return fmt.Errorf("--rate must be positive")
+	}
+	if *window <= 0 {
+		return fmt.Errorf("--window must be positive")
+	}
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	cursor, err := repo.GetCursor(ctx, firehose.CursorService)
+	if err != nil {
+		return fmt.Errorf("load cursor: %w", err)
+	}
+	if cursor == 0 {
+		fmt.Println("No saved cursor: the server will start live (or from FEEDGEN_FIREHOSE_BACKFILL), so nothing is replayed.")
+		return nil
+	}
+
+	at := time.UnixMicro(cursor).UTC()
+	gap := max(time.Since(at), 0)
+	// Jetstream can only replay what it still holds
+	events := int64(min(gap, *window).Seconds() * *rate)
+
+	fmt.Printf("Saved cursor:     %d (%s)\n", cursor, at.Format(time.RFC3339))
+	fmt.Printf("Gap to now:       %s\n", gap.Round(time.Second))
+	fmt.Printf("Estimated events: %d (at %g events/s)\n", events, *rate)
+	if gap > *window {
+		fmt.Printf("Warning: the cursor is %s older than the %s replay window; events before %s are no longer available, so resuming leaves a gap anyway. Consider moving the cursor to live.\n",
+			(gap - *window).Round(time.Second), *window, time.Now().UTC().Add(-*window).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// dbPathFlag registers the --db flag on fs, defaulting to DATABASE_PATH.
+func dbPathFlag(fs *flag.FlagSet) *string {
+	def, err := config.Getenv("DATABASE_PATH")
+	if err != nil || def == "" {
+		def = "/data/bluesky-feeds.db"
+	}
+	return fs.String("db", def, "Path to the SQLite database file")
+}
+
+// parseTime accepts either an RFC 3339 timestamp or a bare date.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/version"
 )
 
 func main() {
@@ -19,103 +22,232 @@ func main() {
 	}
 }
 
+// options holds the parsed command line.
+type options struct {
+	handle       string
+	password     string
+	pds          string
+	appView      string
+	serviceDID   string
+	feedRKey     string
+	displayName  string
+	description  string
+	avatarPath   string
+	unpublish    bool
+	unpublishAll bool
+	confirm      bool
+	verify       bool
+	checkAuth    bool
+	userAgent    string
+	resetCreated bool
+	reconcile    bool
+	dryRun       bool
+}
+
 func run() error {
-	var (
-		handle      string
-		password    string
-		pds         string
-		serviceDID  string
-		feedRKey    string
-		displayName string
-		description string
-		avatarPath  string
-		unpublish   bool
-	)
+	var opts options
 
-	flag.StringVar(&handle, "handle", envOrDefault("BLUESKY_HANDLE", ""), "BlueSky handle (e.g. user.bsky.social)")
-	flag.StringVar(&password, "password", envOrDefault("BLUESKY_APP_PASSWORD", ""), "BlueSky app password")
-	flag.StringVar(&pds, "pds", envOrDefault("BLUESKY_PDS", "https://bsky.social"), "PDS service URL")
-	flag.StringVar(&serviceDID, "service-did", envOrDefault("FEEDGEN_SERVICE_DID", ""), "Feed generator service DID (e.g. did:web:feed.example.com)")
-	flag.StringVar(&feedRKey, "rkey", "", "Record key / short name for the feed (e.g. my-cool-feed)")
-	flag.StringVar(&displayName, "name", "", "Feed display name (max 24 graphemes)")
-	flag.StringVar(&description, "description", "", "Feed description (max 300 graphemes)")
-	flag.StringVar(&avatarPath, "avatar-path", "", "Path to avatar image (PNG or JPEG)")
-	flag.BoolVar(&unpublish, "unpublish", false, "Delete the feed generator record instead of publishing")
+	defaultPassword, err := config.Getenv("BLUESKY_APP_PASSWORD")
+	if err != nil {
+		return err
+	}
+
+	flag.StringVar(&opts.handle, "handle", envOrDefault("BLUESKY_HANDLE", ""), "BlueSky handle (e.g. user.bsky.social)")
+	flag.StringVar(&opts.password, "password", defaultPassword, "BlueSky app password")
+	flag.StringVar(&opts.pds, "pds", envOrDefault("BLUESKY_PDS", "https://bsky.social"), "PDS service URL")
+	flag.StringVar(&opts.appView, "appview", envOrDefault("BLUESKY_APPVIEW", "https://public.api.bsky.app"), "AppView service URL (used by --verify)")
+	flag.StringVar(&opts.serviceDID, "service-did", envOrDefault("FEEDGEN_SERVICE_DID", ""), "Feed generator service DID (e.g. did:web:feed.example.com)")
+	flag.StringVar(&opts.feedRKey, "rkey", "", "Record key / short name for the feed (e.g. my-cool-feed)")
+	flag.StringVar(&opts.displayName, "name", "", "Feed display name (max 24 graphemes)")
+	flag.StringVar(&opts.description, "description", "", "Feed description (max 300 graphemes)")
+	flag.StringVar(&opts.avatarPath, "avatar-path", "", "Path to avatar image (PNG, JPEG, or WebP)")
+	flag.BoolVar(&opts.unpublish, "unpublish", false, "Delete the feed generator record instead of publishing")
+	flag.BoolVar(&opts.unpublishAll, "unpublish-all", false, "Delete every feed generator record in the account (requires --yes)")
+	flag.BoolVar(&opts.confirm, "yes", false, "Confirm --unpublish-all")
+	flag.StringVar(&opts.userAgent, "user-agent", envOrDefault("FEEDGEN_USER_AGENT", version.UserAgent()), "User-Agent sent with API requests")
+	flag.BoolVar(&opts.resetCreated, "reset-created", false, "Set a fresh createdAt instead of preserving the existing record's")
+	flag.BoolVar(&opts.verify, "verify", false, "After publishing, ask the AppView whether the feed generator is online and valid")
+	flag.BoolVar(&opts.checkAuth, "check-auth", false, "Only check that the credentials work and print the account they belong to")
+	flag.BoolVar(&opts.reconcile, "reconcile", false, "Publish the record of every configured feed with a DisplayName, updating only those that differ from the config")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "With --reconcile, only report which records would change")
 	flag.Parse()
 
-	if handle == "" || password == "" {
-		return fmt.Errorf("--handle and --password are required (or set BLUESKY_HANDLE and BLUESKY_APP_PASSWORD)")
+	if opts.handle == "" || opts.password == "" {
+		return fmt.Errorf("--handle and --password are required (or set BLUESKY_HANDLE and BLUESKY_APP_PASSWORD or BLUESKY_APP_PASSWORD_FILE)")
+	}
+	if opts.unpublishAll && !opts.confirm {
+		return fmt.Errorf("--unpublish-all deletes every feed generator record in the account; pass --yes to confirm")
 	}
-	if feedRKey == "" {
+	if opts.reconcile && (opts.feedRKey != "" || opts.displayName != "" || opts.description != "" || opts.avatarPath != "" || opts.unpublish || opts.unpublishAll) {
+		return fmt.Errorf("--reconcile takes names, descriptions and avatars from the feed config; it can't be combined with --rkey, --name, --description, --avatar-path or unpublishing")
+	}
+	if opts.dryRun && !opts.reconcile {
+		return fmt.Errorf("--dry-run only applies to --reconcile")
+	}
+	if opts.feedRKey == "" && !opts.unpublishAll && !opts.checkAuth && !opts.reconcile {
 		return fmt.Errorf("--rkey is required")
 	}
 
-	ctx := context.Background()
-	client := bluesky.NewClient(pds)
+	client := bluesky.NewClient(opts.pds, opts.appView)
+	client.UserAgent = opts.userAgent
+	return execute(context.Background(), client, opts)
+}
+
+// execute carries out the operation opts asks for against client.
+func execute(ctx context.Context, client bluesky.FeedGeneratorAPI, opts options) error {
+	// Read and check the avatar before logging in so an unsupported or
+	// oversized file fails fast.
+	var (
+		avatarData     []byte
+		avatarMimeType string
+		err            error
+	)
+	if opts.avatarPath != "" && !opts.unpublish && !opts.unpublishAll && !opts.checkAuth {
+		avatarData, err = os.ReadFile(opts.avatarPath)
+		if err != nil {
+			return fmt.Errorf("read avatar: %w", err)
+		}
+		avatarMimeType, err = detectMimeType(opts.avatarPath, avatarData)
+		if err != nil {
+			return err
+		}
+		if err := client.CheckBlob(avatarData, avatarMimeType); err != nil {
+			return fmt.Errorf("avatar %s: %w", opts.avatarPath, err)
+		}
+	}
 
-	fmt.Printf("Logging in as %s...\n", handle)
-	if err := client.Login(ctx, handle, password); err != nil {
+	fmt.Printf("Logging in as %s...\n", opts.handle)
+	if err := client.Login(ctx, opts.handle, opts.password); err != nil {
 		return err
 	}
 	fmt.Printf("Authenticated as %s\n", client.DID())
 
+	if opts.checkAuth {
+		return runCheckAuth(ctx, client)
+	}
+
+	if opts.unpublishAll {
+		return runUnpublishAll(ctx, client)
+	}
+
+	if opts.reconcile {
+		return runReconcile(ctx, client, opts)
+	}
+
 	// Handle avatar upload if path provided
 	var avatarRef *bluesky.BlobRef
-	if avatarPath != "" {
-		mimeType, err := detectMimeType(avatarPath)
+	if avatarData != nil {
+		fmt.Printf("Uploading avatar from %s...\n", opts.avatarPath)
+		avatarRef, err = client.UploadBlob(ctx, avatarData, avatarMimeType)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: %v, skipping avatar upload\n", err)
+			fmt.Fprintf(os.Stderr, "warning: failed to upload avatar: %v, continuing without avatar\n", err)
+			avatarRef = nil
 		} else {
-			imgData, err := os.ReadFile(avatarPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "warning: failed to read avatar file: %v, skipping avatar upload\n", err)
-			} else {
-				fmt.Printf("Uploading avatar from %s...\n", avatarPath)
-				avatarRef, err = client.UploadBlob(ctx, imgData, mimeType)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "warning: failed to upload avatar: %v, continuing without avatar\n", err)
-					avatarRef = nil
-				} else {
-					fmt.Printf("Avatar uploaded successfully (CID: %s, size: %d bytes, type: %s)\n",
-						avatarRef.Ref.Link, avatarRef.Size, avatarRef.MimeType)
-				}
-			}
+			fmt.Printf("Avatar uploaded successfully (CID: %s, size: %d bytes, type: %s)\n",
+				avatarRef.Ref.Link, avatarRef.Size, avatarRef.MimeType)
 		}
 	}
 
-	if unpublish {
-		fmt.Printf("Unpublishing feed %q...\n", feedRKey)
-		if err := client.UnpublishFeedGenerator(ctx, feedRKey); err != nil {
+	if opts.unpublish {
+		fmt.Printf("Unpublishing feed %q...\n", opts.feedRKey)
+		if err := client.UnpublishFeedGenerator(ctx, opts.feedRKey); err != nil {
 			return err
 		}
-		fmt.Printf("Feed unpublished: at://%s/app.bsky.feed.generator/%s\n", client.DID(), feedRKey)
+		fmt.Printf("Feed unpublished: at://%s/app.bsky.feed.generator/%s\n", client.DID(), opts.feedRKey)
 		return nil
 	}
 
-	if serviceDID == "" {
+	if opts.serviceDID == "" {
 		return fmt.Errorf("--service-did is required for publishing (or set FEEDGEN_SERVICE_DID)")
 	}
-	if displayName == "" {
+	if opts.displayName == "" {
 		return fmt.Errorf("--name is required for publishing")
 	}
 
+	// Preserve the original creation time when updating an existing feed so
+	// clients don't treat it as new.
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	if !opts.resetCreated {
+		existing, err := client.GetFeedGenerator(ctx, opts.feedRKey)
+		if err != nil {
+			return fmt.Errorf("fetch existing feed record: %w", err)
+		}
+		if existing != nil && existing.CreatedAt != "" {
+			fmt.Printf("Updating existing feed, preserving createdAt %s\n", existing.CreatedAt)
+			createdAt = existing.CreatedAt
+		}
+	}
+
 	record := bluesky.FeedGeneratorRecord{
-		DID:         serviceDID,
-		DisplayName: displayName,
-		Description: description,
+		DID:         opts.serviceDID,
+		DisplayName: opts.displayName,
+		Description: opts.description,
 		Avatar:      avatarRef,
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		CreatedAt:   createdAt,
 	}
 
-	fmt.Printf("Publishing feed %q...\n", feedRKey)
+	fmt.Printf("Publishing feed %q...\n", opts.feedRKey)
 	fmt.Printf("Feed record %v\n", record)
-	if err := client.PublishFeedGenerator(ctx, feedRKey, record); err != nil {
+	if err := client.PublishFeedGenerator(ctx, opts.feedRKey, record); err != nil {
 		return err
 	}
 
-	feedURI := fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", client.DID(), feedRKey)
+	feedURI := fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", client.DID(), opts.feedRKey)
 	fmt.Printf("Feed published: %s\n", feedURI)
 
+	if opts.verify {
+		fmt.Printf("Verifying feed with AppView %s...\n", opts.appView)
+		view, err := client.GetFeedGeneratorView(ctx, feedURI)
+		if err != nil {
+			return fmt.Errorf("verify feed: %w", err)
+		}
+		fmt.Printf("AppView status: online=%t valid=%t (service DID: %s)\n", view.IsOnline, view.IsValid, view.DID)
+		if !view.IsOnline || !view.IsValid {
+			return fmt.Errorf("feed generator is not healthy according to the AppView (online=%t, valid=%t)", view.IsOnline, view.IsValid)
+		}
+	}
+
+	return nil
+}
+
+// runCheckAuth prints the account the session belongs to, as reported back
+// by the PDS, without changing anything.
+func runCheckAuth(ctx context.Context, client bluesky.FeedGeneratorAPI) error {
+	session, err := client.WhoAmI(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("DID:             %s\n", session.DID)
+	fmt.Printf("Handle:          %s\n", session.Handle)
+	fmt.Printf("Email confirmed: %t\n", session.EmailConfirmed)
+	return nil
+}
+
+// runUnpublishAll lists every feed generator record in the account and
+// deletes them, reporting each result and continuing past failures.
+func runUnpublishAll(ctx context.Context, client bluesky.FeedGeneratorAPI) error {
+	rkeys, err := client.ListFeedGenerators(ctx)
+	if err != nil {
+		return err
+	}
+	if len(rkeys) == 0 {
+		fmt.Println("No feed generator records to unpublish")
+		return nil
+	}
+
+	fmt.Printf("Unpublishing %d feed(s): %s\n", len(rkeys), strings.Join(rkeys, ", "))
+	failed := 0
+	for _, r := range client.UnpublishFeedGenerators(ctx, rkeys) {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  %s: failed: %v\n", r.RKey, r.Err)
+			continue
+		}
+		fmt.Printf("  %s: unpublished\n", r.RKey)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feed(s) failed to unpublish", failed, len(rkeys))
+	}
 	return nil
 }
 
@@ -126,15 +258,36 @@ func envOrDefault(key, fallback string) string {
 	return fallback
 }
 
-// detectMimeType determines MIME type from file extension
-func detectMimeType(path string) (string, error) {
+// avatarMimeTypes maps the avatar file extensions we recognize to their
+// MIME types. Its values are the formats allowed for upload.
+var avatarMimeTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+}
+
+// detectMimeType determines an avatar's MIME type by sniffing its content,
+// so a missing or wrong extension doesn't cause a bad upload. It fails if the
+// content isn't one of the allowed image formats.
+func detectMimeType(path string, data []byte) (string, error) {
+	sniffed := http.DetectContentType(data)
 	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".png":
-		return "image/png", nil
-	case ".jpg", ".jpeg":
-		return "image/jpeg", nil
-	default:
-		return "", fmt.Errorf("unsupported file extension %q: expected .png, .jpg, or .jpeg", ext)
+	byExt, extOK := avatarMimeTypes[ext]
+
+	allowed := false
+	for _, mimeType := range avatarMimeTypes {
+		if mimeType == sniffed {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("avatar %s is %s, expected a PNG, JPEG, or WebP image", path, sniffed)
+	}
+
+	if extOK && byExt != sniffed {
+		fmt.Fprintf(os.Stderr, "warning: avatar %s has extension %s but contains %s, uploading as the latter\n", path, ext, sniffed)
 	}
+	return sniffed, nil
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// runReconcile publishes a record for every feed in domain.GetFeedConfigs
+// that has a DisplayName, so the account's records match the config. A
+// record is only written when its service DID, name, description or avatar
+// differ from the config; the existing createdAt is kept unless
+// --reset-created. Changed records are written together with
+// PublishFeedGenerators. With --dry-run it only reports what would change.
+// It continues past failures and returns an error if any feed failed.
+func runReconcile(ctx context.Context, client bluesky.FeedGeneratorAPI, opts options) error {
+	if opts.serviceDID == "" {
+		return fmt.Errorf("--service-did is required for --reconcile (or set FEEDGEN_SERVICE_DID)")
+	}
+
+	configs := domain.GetFeedConfigs(client.DID())
+	fmt.Printf("Reconciling %d feed(s) against service %s...\n", len(configs), opts.serviceDID)
+	failed := 0
+	var (
+		writes  []bluesky.FeedGeneratorWrite
+		changes [][]string
+	)
+	for _, cfg := range configs {
+		rkey := path.Base(cfg.URI)
+		if cfg.DisplayName == "" {
+			fmt.Printf("  %s: skipped, no DisplayName in config\n", rkey)
+			continue
+		}
+		write, changed, err := reconcileFeed(ctx, client, opts, rkey, cfg)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(os.Stderr, "  %s: failed: %v\n", rkey, err)
+		case write != nil:
+			writes = append(writes, *write)
+			changes = append(changes, changed)
+		}
+	}
+
+	for i, r := range client.PublishFeedGenerators(ctx, writes) {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  %s: failed: %v\n", r.RKey, r.Err)
+			continue
+		}
+		fmt.Printf("  %s: published (%s)\n", r.RKey, strings.Join(changes[i], ", "))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feed(s) failed to reconcile", failed, len(configs))
+	}
+	return nil
+}
+
+// reconcileFeed works out the record cfg asks for and returns it with the
+// fields that changed, uploading the avatar if it is new. It returns a nil
+// write if the record is up to date or --dry-run is set.
+func reconcileFeed(ctx context.Context, client bluesky.FeedGeneratorAPI, opts options, rkey string, cfg domain.FeedConfig) (*bluesky.FeedGeneratorWrite, []string, error) {
+	// Check the avatar before touching the record, and compute its CID so
+	// an unchanged image isn't uploaded again.
+	var (
+		avatarData     []byte
+		avatarMimeType string
+		avatarCID      string
+		err            error
+	)
+	if cfg.AvatarPath != "" {
+		avatarData, err = os.ReadFile(cfg.AvatarPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read avatar: %w", err)
+		}
+		avatarMimeType, err = detectMimeType(cfg.AvatarPath, avatarData)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := client.CheckBlob(avatarData, avatarMimeType); err != nil {
+			return nil, nil, fmt.Errorf("avatar %s: %w", cfg.AvatarPath, err)
+		}
+		avatarCID = bluesky.BlobCID(avatarData)
+	}
+
+	existing, err := client.GetFeedGenerator(ctx, rkey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch existing feed record: %w", err)
+	}
+	changes := recordChanges(existing, opts.serviceDID, cfg, avatarCID)
+	if len(changes) == 0 {
+		fmt.Printf("  %s: up to date\n", rkey)
+		return nil, nil, nil
+	}
+	if opts.dryRun {
+		fmt.Printf("  %s: would publish (%s)\n", rkey, strings.Join(changes, ", "))
+		return nil, nil, nil
+	}
+
+	record := bluesky.FeedGeneratorRecord{
+		DID:         opts.serviceDID,
+		DisplayName: cfg.DisplayName,
+		Description: cfg.Description,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if existing != nil {
+		if !opts.resetCreated && existing.CreatedAt != "" {
+			record.CreatedAt = existing.CreatedAt
+		}
+		if existing.Avatar != nil && existing.Avatar.Ref.Link == avatarCID {
+			record.Avatar = existing.Avatar
+		}
+	}
+	if avatarData != nil && record.Avatar == nil {
+		record.Avatar, err = client.UploadBlob(ctx, avatarData, avatarMimeType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("upload avatar: %w", err)
+		}
+	}
+	return &bluesky.FeedGeneratorWrite{RKey: rkey, Record: record, Exists: existing != nil}, changes, nil
+}
+
+// recordChanges lists the fields of existing that differ from what cfg
+// asks for, or "new record" if there is no record yet. avatarCID is the
+// blob CID of the configured avatar, or empty for none.
+func recordChanges(existing *bluesky.FeedGeneratorRecord, serviceDID string, cfg domain.FeedConfig, avatarCID string) []string {
+	if existing == nil {
+		return []string{"new record"}
+	}
+	var changes []string
+	if existing.DID != serviceDID {
+		changes = append(changes, "did")
+	}
+	if existing.DisplayName != cfg.DisplayName {
+		changes = append(changes, "displayName")
+	}
+	if existing.Description != cfg.Description {
+		changes = append(changes, "description")
+	}
+	var existingCID string
+	if existing.Avatar != nil {
+		existingCID = existing.Avatar.Ref.Link
+	}
+	if existingCID != avatarCID {
+		changes = append(changes, "avatar")
+	}
+	return changes
+}
@@ -0,0 +1,191 @@
+// Command republish renders a feed generator's description from a template
+// filled in with live stats, such as the number of indexed posts, and
+// updates the published record. With --every it keeps doing so on a
+// schedule.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/sqlite"
+	"github.com/blackmichael/bluesky-feeds/internal/version"
+)
+
+// minInterval is the shortest --every allowed. Each run logs in and writes a
+// record, both of which count against the PDS's rate limits.
+const minInterval = 15 * time.Minute
+
+// maxDescriptionLen is the lexicon's limit on a feed generator description.
+// It is counted in graphemes; runes are a close, conservative stand-in.
+const maxDescriptionLen = 300
+
+// templateData is the value a description template is executed with.
+type templateData struct {
+	FeedURI   string
+	RKey      string
+	PostCount int64
+	Now       time.Time
+}
+
+func main() {
+	if err := run(); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	defaultPassword, err := config.Getenv("BLUESKY_APP_PASSWORD")
+	if err != nil {
+		return err
+	}
+	defaultDB, err := config.Getenv("DATABASE_PATH")
+	if err != nil {
+		return err
+	}
+
+	var (
+		handle    = flag.String("handle", os.Getenv("BLUESKY_HANDLE"), "BlueSky handle (e.g. user.bsky.social)")
+		password  = flag.String("password", defaultPassword, "BlueSky app password")
+		pds       = flag.String("pds", envOrDefault("BLUESKY_PDS", "https://bsky.social"), "PDS service URL")
+		rkey      = flag.String("rkey", "", "Record key of the published feed")
+		tmplText  = flag.String("template", "", `Description template, e.g. "Indexing {{.PostCount}} posts about agents"`)
+		dbPath    = flag.String("db", defaultDB, "SQLite database to read stats from")
+		every     = flag.Duration("every", 0, fmt.Sprintf("Republish at this interval until interrupted (minimum %s); 0 runs once", minInterval))
+		userAgent = flag.String("user-agent", envOrDefault("FEEDGEN_USER_AGENT", version.UserAgent()), "User-Agent sent with API requests")
+	)
+	flag.Parse()
+
+	if *handle == "" || *password == "" {
+		return fmt.Errorf("--handle and --password are required (or set BLUESKY_HANDLE and BLUESKY_APP_PASSWORD or BLUESKY_APP_PASSWORD_FILE)")
+	}
+	if *rkey == "" || *tmplText == "" {
+		return fmt.Errorf("--rkey and --template are required")
+	}
+	if *dbPath == "" {
+		return fmt.Errorf("--db is required (or set DATABASE_PATH)")
+	}
+	if *every != 0 && *every < minInterval {
+		return fmt.Errorf("--every must be at least %s to stay within rate limits", minInterval)
+	}
+
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(*tmplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+
+	repo, err := sqlite.NewRepository(*dbPath, sqlite.Options{})
+	if err != nil {
+		return fmt.Errorf("open repository: %w", err)
+	}
+	defer repo.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	r := &republisher{
+		handle:   *handle,
+		password: *password,
+		pds:      *pds,
+		rkey:     *rkey,
+		tmpl:     tmpl,
+		repo:     repo,
+		ua:       *userAgent,
+	}
+	if *every == 0 {
+		return r.republish(ctx)
+	}
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		// A failed run is retried at the next tick rather than ending the loop.
+		if err := r.republish(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type republisher struct {
+	handle, password, pds, rkey string
+	tmpl                        *template.Template
+	repo                        *sqlite.Repository
+	ua                          string
+}
+
+// republish logs in, renders the description, and updates the feed record
+// if the description changed. Logging in each time avoids relying on a
+// session outliving a long --every interval.
+func (r *republisher) republish(ctx context.Context) error {
+	client := bluesky.NewClient(r.pds, "")
+	client.UserAgent = r.ua
+	if err := client.Login(ctx, r.handle, r.password); err != nil {
+		return err
+	}
+	feedURI := fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", client.DID(), r.rkey)
+
+	count, err := r.repo.CountPosts(ctx, feedURI)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = r.tmpl.Execute(&buf, templateData{
+		FeedURI:   feedURI,
+		RKey:      r.rkey,
+		PostCount: count,
+		Now:       time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("render description: %w", err)
+	}
+	description := buf.String()
+	if n := utf8.RuneCountInString(description); n > maxDescriptionLen {
+		return fmt.Errorf("rendered description is %d characters, the limit is %d", n, maxDescriptionLen)
+	}
+
+	record, err := client.GetFeedGenerator(ctx, r.rkey)
+	if err != nil {
+		return fmt.Errorf("fetch feed record: %w", err)
+	}
+	if record == nil {
+		return fmt.Errorf("feed %s is not published; publish it first with cmd/publish", feedURI)
+	}
+	if record.Description == description {
+		fmt.Printf("Description of %s is unchanged, skipping\n", r.rkey)
+		return nil
+	}
+
+	record.Description = description
+	if err := client.PublishFeedGenerator(ctx, r.rkey, *record); err != nil {
+		return err
+	}
+	fmt.Printf("Republished %s: %q\n", feedURI, description)
+	return nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -3,20 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+	"github.com/blackmichael/bluesky-feeds/internal/circuitbreaker"
 	"github.com/blackmichael/bluesky-feeds/internal/config"
 	"github.com/blackmichael/bluesky-feeds/internal/domain"
 	"github.com/blackmichael/bluesky-feeds/internal/firehose"
 	"github.com/blackmichael/bluesky-feeds/internal/httpserver"
+	"github.com/blackmichael/bluesky-feeds/internal/langdetect"
+	"github.com/blackmichael/bluesky-feeds/internal/serviceauth"
 	"github.com/blackmichael/bluesky-feeds/internal/sqlite"
+	"github.com/blackmichael/bluesky-feeds/internal/webhook"
 )
 
+// shutdownTimeout bounds how long shutdown waits for in-flight requests and
+// abandoned firehose handlers before the database is closed.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -25,30 +34,125 @@ func main() {
 }
 
 func run() error {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
 
+	logger := cfg.NewLogger(os.Stdout)
+
 	// Set up repository (implements both PostRepository and CursorRepository)
-	repo, err := sqlite.NewRepository(cfg.DatabasePath)
+	repo, err := sqlite.NewRepository(cfg.DatabasePath, sqlite.Options{
+		MaxConcurrentQueries: cfg.DBMaxConcurrentQueries,
+		QueueTimeout:         cfg.DBQueueTimeout,
+		StatementTimeout:     cfg.DBStatementTimeout,
+		BinaryCIDs:           cfg.DBBinaryCIDs,
+		ReplicaPath:          cfg.DBReplicaPath,
+		Logger:               logger,
+	})
 	if err != nil {
 		return fmt.Errorf("create repository: %w", err)
 	}
 	defer repo.Close()
-	logger.Info("database ready", "path", cfg.DatabasePath)
+	logger.Info("database ready", "path", cfg.DatabasePath, "replica_path", cfg.DBReplicaPath, "statement_timeout", cfg.DBStatementTimeout)
+
+	// Optionally guard the repository with a circuit breaker so a failing
+	// database fast-fails instead of stalling every caller.
+	var store circuitbreaker.Store = repo
+	if cfg.BreakerThreshold > 0 {
+		store = circuitbreaker.NewRepository(repo, circuitbreaker.New(cfg.BreakerThreshold, cfg.BreakerCooldown))
+	}
+
+	// The AppView client looks up quoted posts for feeds that match them
+	appView := bluesky.NewClient("", cfg.AppViewURL)
+	appView.UserAgent = cfg.UserAgent
+	appView.PLCDirectory = cfg.PLCURL
+
+	// Handles are resolved to DIDs once at startup: a publisher handle (with
+	// FEEDGEN_RESOLVE_PUBLISHER_HANDLE) before anything builds feed URIs from
+	// it, then the accounts in MentionsAny.
+	resolveCtx, cancelResolve := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelResolve()
+	if err := cfg.ResolvePublisher(resolveCtx, appView); err != nil {
+		return err
+	}
+	if cfg.ResolvePublisherHandle {
+		logger.Info("publisher DID", "did", cfg.PublisherDID)
+	}
+
+	logger.Info("features", "enabled", cfg.Features.Enabled())
 
-	// Set up feed service with feed configurations
+	// Set up feed service with the feeds of every served host
 	feedConfigs := domain.GetFeedConfigs(cfg.PublisherDID)
-	feedService, err := domain.NewFeedService(feedConfigs, repo, repo, logger)
+	for _, host := range cfg.ExtraHosts {
+		feedConfigs = append(feedConfigs, domain.GetFeedConfigs(host.PublisherDID)...)
+	}
+
+	// Webhook notifications are delivered in the background once started
+	var webhooks *webhook.Dispatcher
+	var notifier domain.MatchNotifier
+	if cfg.Features.Webhooks {
+		webhooks = webhook.NewDispatcher(cfg.WebhookSecret, cfg.WebhookWorkers, cfg.UserAgent, logger)
+		notifier = webhooks
+	} else {
+		for i := range feedConfigs {
+			if feedConfigs[i].WebhookURL != "" {
+				logger.Warn("webhooks feature is off, ignoring feed webhook", "feed", feedConfigs[i].URI)
+				feedConfigs[i].WebhookURL = ""
+			}
+		}
+	}
+	if err := domain.ResolveMentions(resolveCtx, feedConfigs, appView); err != nil {
+		return err
+	}
+	feedService, err := domain.NewFeedService(feedConfigs, store, store, domain.ServiceOptions{
+		TombstoneWindow:     cfg.TombstoneWindow,
+		RetryBufferSize:     cfg.RetryBufferSize,
+		WriteFailurePolicy:  domain.WriteFailurePolicy(cfg.WriteFailurePolicy),
+		DedupWindow:         cfg.DedupWindow,
+		DedupSize:           cfg.DedupSize,
+		KeywordStatsWindow:  cfg.KeywordStatsWindow,
+		PostCounts:          repo,
+		MatchedPosts:        repo,
+		RecentPosts:         repo,
+		PostUpserts:         repo,
+		QueryGauge:          repo,
+		FeedStatsTTL:        cfg.FeedStatsTTL,
+		QuotedPosts:         appView,
+		AuthorFollowers:     appView,
+		LanguageDetector:    langdetect.Script{},
+		Webhooks:            notifier,
+		ReadPositions:       repo,
+		ReadPositionTTL:     cfg.ReadPositionTTL,
+		ReadPositionMaxRows: cfg.ReadPositionMaxRows,
+	}, logger)
 	if err != nil {
 		return fmt.Errorf("create feed service: %w", err)
 	}
 
+	if cfg.Trace {
+		feedService.SetTrace(true, cfg.TraceSampleRate, 0)
+	}
+
+	// Check the server can serve something valid before starting any
+	// background work or accepting requests.
+	server := httpserver.NewServer(cfg, feedService, logger)
+	if err := server.Preflight(); err != nil {
+		return fmt.Errorf("startup check: %w", err)
+	}
+	logger.Info("startup checks passed", "feeds", len(feedService.FeedURIs()))
+
+	// A feed published moments ago has nothing to serve until its first
+	// match. It still answers with empty pages; say so, so an empty feed in
+	// the app isn't mistaken for a broken one.
+	if empty, err := feedService.EmptyFeeds(context.Background()); err != nil {
+		logger.Warn("failed to check for empty feeds", "error", err)
+	} else {
+		for _, uri := range empty {
+			logger.Info("feed is warming: live but empty until its first match", "feed", uri)
+		}
+	}
+
 	// Set up graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -56,19 +160,54 @@ func run() error {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload the TLS certificate on SIGHUP, e.g. after a renewal
+	if cfg.TLSCertPath != "" {
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		go func() {
+			for range hupCh {
+				if err := server.ReloadCertificate(); err != nil {
+					logger.Error("failed to reload TLS certificate", "error", err)
+					continue
+				}
+				logger.Info("reloaded TLS certificate")
+			}
+		}()
+	}
+
+	// Background workers are tracked so shutdown can wait for them to stop
+	// before the repository is closed.
+	var workers sync.WaitGroup
+
 	// Start the firehose subscriber in the background
-	subscriber := firehose.NewSubscriber(cfg.FirehoseURL, feedService, logger)
-	go func() {
+	stats := firehose.NewLogStatsReporter(logger, 30*time.Second)
+	subscriber := firehose.NewSubscriber(cfg, feedService, stats, logger)
+	server.SetFirehose(subscriber)
+
+	// Feeds that remember read positions identify requesters by their
+	// service auth token, verified against the signing key in their DID
+	// document.
+	server.SetTokenVerifier(serviceauth.NewVerifier(appView, cfg.SigningKeyTTL))
+	subscriberErr := make(chan error, 1)
+	workers.Go(func() {
 		if err := subscriber.Start(ctx); err != nil && ctx.Err() == nil {
 			logger.Error("firehose subscriber exited with error", "error", err)
+			subscriberErr <- err
 		}
-	}()
+	})
+
+	// Deliver webhook notifications for matched posts
+	if webhooks != nil {
+		workers.Go(func() { webhooks.Run(ctx) })
+	}
+
+	// Retry posts that failed to persist during a database outage
+	workers.Go(func() { feedService.StartRetryJob(ctx, 5*time.Second) })
 
 	// Start background post cleanup
-	go feedService.StartCleanupJob(ctx, time.Minute, 7*24*time.Hour, 500)
+	workers.Go(func() { feedService.StartCleanupJob(ctx, cfg.CleanupInterval, cfg.PostMaxAge, cfg.PostMaxRows) })
 
 	// Start the HTTP server
-	server := httpserver.NewServer(cfg, feedService, logger)
 	go func() {
 		if err := server.Start(); err != nil && err != http.ErrServerClosed {
 			logger.Error("http server exited with error", "error", err)
@@ -77,14 +216,30 @@ func run() error {
 
 	logger.Info("server started", "port", cfg.Port, "hostname", cfg.Hostname)
 
-	// Wait for shutdown signal
-	sig := <-sigCh
-	logger.Info("received signal, shutting down", "signal", sig)
-	cancel()
+	// Wait for shutdown signal or a fatal subscriber error
+	var runErr error
+	select {
+	case sig := <-sigCh:
+		logger.Info("received signal, shutting down", "signal", sig)
+	case runErr = <-subscriberErr:
+		logger.Info("firehose subscriber stopped, shutting down")
+	}
 
-	if err := server.Shutdown(context.Background()); err != nil {
+	// Drain in-flight requests first, then stop the background workers and
+	// wait for them, so nothing is still using the repository when the
+	// deferred Close runs. Requests and abandoned firehose handlers get
+	// shutdownTimeout to finish.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Error("error shutting down http server", "error", err)
 	}
+	cancel()
+	workers.Wait()
+	if err := subscriber.WaitHandlers(shutdownCtx); err != nil {
+		logger.Error("abandoned firehose handlers still running at shutdown", "error", err)
+	}
+	logger.Info("background workers stopped")
 
-	return nil
+	return runErr
 }
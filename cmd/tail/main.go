@@ -0,0 +1,213 @@
+// Command tail connects to Jetstream and prints posts matching the feed rules
+// as they arrive, without touching a database. Use it to sanity-check keyword
+// changes against the live firehose before deploying them.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/firehose"
+	"github.com/blackmichael/bluesky-feeds/internal/version"
+)
+
+// tailDID stands in for the publisher DID in feed URIs. Only the rkey is
+// printed, so its value doesn't matter.
+const tailDID = "did:plc:tail"
+
+// feedFile is the JSON shape of a --feeds file entry.
+type feedFile struct {
+	Name           string   `json:"name"`
+	Keywords       []string `json:"keywords"`
+	Langs          []string `json:"langs"`
+	MinLinks       int      `json:"min_links"`
+	MaxLinks       int      `json:"max_links"`
+	BlockedDomains []string `json:"blocked_domains"`
+	MentionsAny    []string `json:"mentions_any"`
+	Quotes         string   `json:"quotes"`
+	OriginalOnly   bool     `json:"original_only"`
+
+	ReplyRootAuthors []string `json:"reply_root_authors"`
+	ReplyRootURIs    []string `json:"reply_root_uris"`
+}
+
+func main() {
+	var (
+		feedsPath   = flag.String("feeds", "", "JSON file with an array of feed definitions ({name, keywords, langs, min_links, max_links, blocked_domains, mentions_any, quotes, original_only, reply_root_authors, reply_root_uris})")
+		keywords    = flag.String("keywords", "", "Comma-separated keywords for an ad-hoc feed (overrides --feeds)")
+		langs       = flag.String("langs", "", "Comma-separated language codes for the ad-hoc feed")
+		firehoseURL = flag.String("firehose", "wss://jetstream1.us-east.bsky.network/subscribe", "Jetstream WebSocket URL")
+		verbose     = flag.Bool("v", false, "Log subscriber activity to stderr")
+	)
+	flag.Parse()
+
+	if err := run(*feedsPath, *keywords, *langs, *firehoseURL, *verbose); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(feedsPath, keywords, langs, firehoseURL string, verbose bool) error {
+	configs, err := loadFeedConfigs(feedsPath, keywords, langs)
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelInfo
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	// Handles in MentionsAny are resolved once, up front
+	appView := bluesky.NewClient("", "")
+	if err := domain.ResolveMentions(context.Background(), configs, appView); err != nil {
+		return err
+	}
+
+	var repo discardRepository
+	feedService, err := domain.NewFeedService(configs, repo, repo, domain.ServiceOptions{
+		OnMatch: func(post *domain.IncomingPost, matches []domain.Match) {
+			printMatches(os.Stdout, post, matches)
+		},
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("create feed service: %w", err)
+	}
+
+	cfg := &config.Config{
+		FirehoseURL: firehoseURL,
+		UserAgent:   version.UserAgent(),
+	}
+	stats := firehose.NewLogStatsReporter(logger, time.Minute)
+	subscriber := firehose.NewSubscriber(cfg, feedService, stats, logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "Tailing %d feed(s) from %s, press Ctrl-C to stop\n", len(configs), firehoseURL)
+	return subscriber.Start(ctx)
+}
+
+// loadFeedConfigs builds the feeds to match against: an ad-hoc feed from
+// --keywords, the feeds in --feeds, or else the server's built-in feeds.
+func loadFeedConfigs(feedsPath, keywords, langs string) ([]domain.FeedConfig, error) {
+	if keywords != "" {
+		return []domain.FeedConfig{{
+			URI:      feedURI("adhoc"),
+			Keywords: splitList(keywords),
+			Langs:    splitList(langs),
+		}}, nil
+	}
+
+	if feedsPath == "" {
+		return domain.GetFeedConfigs(tailDID), nil
+	}
+
+	data, err := os.ReadFile(feedsPath)
+	if err != nil {
+		return nil, fmt.Errorf("read feeds file: %w", err)
+	}
+	var defs []feedFile
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("parse feeds file: %w", err)
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("feeds file %s defines no feeds", feedsPath)
+	}
+
+	configs := make([]domain.FeedConfig, len(defs))
+	for i, d := range defs {
+		if d.Name == "" {
+			return nil, fmt.Errorf("feeds file %s: feed %d has no name", feedsPath, i)
+		}
+		configs[i] = domain.FeedConfig{
+			URI:            feedURI(d.Name),
+			Keywords:       d.Keywords,
+			Langs:          d.Langs,
+			MinLinks:       d.MinLinks,
+			MaxLinks:       d.MaxLinks,
+			BlockedDomains: d.BlockedDomains,
+			MentionsAny:    d.MentionsAny,
+			Quotes:         domain.QuoteFilter(d.Quotes),
+			OriginalOnly:   d.OriginalOnly,
+
+			ReplyRootAuthors: d.ReplyRootAuthors,
+			ReplyRootURIs:    d.ReplyRootURIs,
+		}
+	}
+	return configs, nil
+}
+
+func feedURI(name string) string {
+	return fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", tailDID, name)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printMatches writes one line per matched feed: feed name, post URI,
+// author DID, matched keyword, and the post text flattened to one line.
+func printMatches(w io.Writer, post *domain.IncomingPost, matches []domain.Match) {
+	text := strings.Join(strings.Fields(domain.PreviewText(post.Text, 0)), " ")
+	for _, m := range matches {
+		name := m.FeedURI[strings.LastIndex(m.FeedURI, "/")+1:]
+		keyword := m.Keyword
+		if keyword == "" {
+			keyword = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%q\t%s\n", name, post.URI, post.AuthorDID, keyword, text)
+	}
+}
+
+// discardRepository satisfies the repository ports without storing
+// anything, so the subscriber always starts from live and matched posts go
+// nowhere.
+type discardRepository struct{}
+
+func (discardRepository) CreatePost(context.Context, *domain.Post, []string) error { return nil }
+func (discardRepository) DeletePost(context.Context, string) error                 { return nil }
+
+func (discardRepository) IsTombstoned(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (discardRepository) DeleteTombstonesBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (discardRepository) DeleteOldPosts(context.Context, string, time.Duration, int) (domain.CleanupResult, error) {
+	return domain.CleanupResult{}, nil
+}
+
+func (discardRepository) DeletePostsBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (discardRepository) GetFeedPosts(context.Context, string, int, string, []string) ([]domain.Post, string, error) {
+	return nil, "", nil
+}
+
+func (discardRepository) GetCursor(context.Context, string) (int64, error)  { return 0, nil }
+func (discardRepository) UpdateCursor(context.Context, string, int64) error { return nil }
@@ -3,6 +3,7 @@ module github.com/blackmichael/bluesky-feeds
 go 1.25.5
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
 	github.com/gorilla/websocket v1.5.3
 	modernc.org/sqlite v1.37.1
 )
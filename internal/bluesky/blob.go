@@ -0,0 +1,66 @@
+package bluesky
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultMaxBlobSize is the largest blob, in bytes, UploadBlob accepts by
+// default. It matches the 1MB limit the AT Protocol lexicons set on avatars.
+const DefaultMaxBlobSize = 1_000_000
+
+// DefaultBlobMimeTypes are the MIME types UploadBlob accepts by default.
+var DefaultBlobMimeTypes = []string{"image/png", "image/jpeg", "image/webp"}
+
+// BlobTooLargeError is returned by CheckBlob and UploadBlob when a blob
+// exceeds the client's MaxBlobSize.
+type BlobTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e *BlobTooLargeError) Error() string {
+	return fmt.Sprintf("blob is %d bytes, more than the %d byte limit", e.Size, e.MaxSize)
+}
+
+// BlobTypeError is returned by CheckBlob and UploadBlob when a blob's MIME
+// type isn't in the client's BlobMimeTypes.
+type BlobTypeError struct {
+	MimeType string
+	Allowed  []string
+}
+
+func (e *BlobTypeError) Error() string {
+	return fmt.Sprintf("blob type %q is not allowed, expected one of %s", e.MimeType, strings.Join(e.Allowed, ", "))
+}
+
+// CheckBlob reports whether UploadBlob would accept data as mimeType,
+// without making a request. Parameters on mimeType (e.g. "; charset=...")
+// are ignored.
+func (c *Client) CheckBlob(data []byte, mimeType string) error {
+	if c.MaxBlobSize > 0 && len(data) > c.MaxBlobSize {
+		return &BlobTooLargeError{Size: len(data), MaxSize: c.MaxBlobSize}
+	}
+	base, _, _ := strings.Cut(mimeType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	if len(c.BlobMimeTypes) > 0 && !slices.Contains(c.BlobMimeTypes, base) {
+		return &BlobTypeError{MimeType: mimeType, Allowed: c.BlobMimeTypes}
+	}
+	return nil
+}
+
+// blobCIDPrefix is the CIDv1 header of a blob: version 1, the raw codec,
+// and a 32-byte sha2-256 multihash.
+var blobCIDPrefix = []byte{0x01, 0x55, 0x12, 0x20}
+
+// BlobCID returns the CID a PDS assigns to data when it is uploaded as a
+// blob ("bafkrei..."), so a local file can be compared with an uploaded one
+// without uploading it again.
+func BlobCID(data []byte) string {
+	sum := sha256.Sum256(data)
+	b := append(slices.Clone(blobCIDPrefix), sum[:]...)
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+}
@@ -0,0 +1,270 @@
+// Package blueskytest provides an in-memory implementation of
+// bluesky.FeedGeneratorAPI for exercising publish and unpublish flows without
+// a PDS or AppView.
+package blueskytest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/blackmichael/bluesky-feeds/internal/bluesky"
+)
+
+// Call is one recorded method call. Args holds the arguments after the
+// context, in order.
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Client is a fake bluesky.FeedGeneratorAPI. It keeps feed generator records
+// in memory by rkey and records every call. The zero value is ready to use
+// and behaves like an empty account that accepts any credentials.
+type Client struct {
+	// Account is the DID reported after Login. Defaults to "did:plc:test".
+	Account string
+
+	// Session is returned by WhoAmI. If nil, a session for Account is made up.
+	Session *bluesky.Session
+
+	// View is returned by GetFeedGeneratorView. If nil, the feed is reported
+	// online and valid.
+	View *bluesky.FeedGeneratorView
+
+	// Errors makes the named method (e.g. "UploadBlob") fail with the given
+	// error. For UnpublishFeedGenerators and PublishFeedGenerators the error
+	// is reported for every rkey.
+	Errors map[string]error
+
+	mu      sync.Mutex
+	calls   []Call
+	did     string
+	records map[string]bluesky.FeedGeneratorRecord
+}
+
+var _ bluesky.FeedGeneratorAPI = (*Client)(nil)
+
+// Calls returns the calls made so far, in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.calls)
+}
+
+// Methods returns the names of the methods called so far, in order.
+func (c *Client) Methods() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	methods := make([]string, len(c.calls))
+	for i, call := range c.calls {
+		methods[i] = call.Method
+	}
+	return methods
+}
+
+// Record returns the stored feed generator record with the given rkey.
+func (c *Client) Record(rkey string) (bluesky.FeedGeneratorRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, ok := c.records[rkey]
+	return rec, ok
+}
+
+// SetRecord stores a feed generator record, e.g. to simulate a feed that was
+// published before.
+func (c *Client) SetRecord(rkey string, record bluesky.FeedGeneratorRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.records == nil {
+		c.records = make(map[string]bluesky.FeedGeneratorRecord)
+	}
+	c.records[rkey] = record
+}
+
+// record logs a call and returns the error configured for method, if any.
+// The caller must hold c.mu.
+func (c *Client) record(method string, args ...any) error {
+	c.calls = append(c.calls, Call{Method: method, Args: args})
+	return c.Errors[method]
+}
+
+func (c *Client) account() string {
+	if c.Account == "" {
+		return "did:plc:test"
+	}
+	return c.Account
+}
+
+func (c *Client) CheckBlob(data []byte, mimeType string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.record("CheckBlob", len(data), mimeType)
+}
+
+func (c *Client) Login(_ context.Context, identifier, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("Login", identifier); err != nil {
+		return err
+	}
+	c.did = c.account()
+	return nil
+}
+
+func (c *Client) DID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.did
+}
+
+func (c *Client) WhoAmI(context.Context) (*bluesky.Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("WhoAmI"); err != nil {
+		return nil, err
+	}
+	if err := c.authenticated(); err != nil {
+		return nil, err
+	}
+	if c.Session != nil {
+		s := *c.Session
+		return &s, nil
+	}
+	return &bluesky.Session{DID: c.did, Handle: "test.bsky.social"}, nil
+}
+
+func (c *Client) UploadBlob(_ context.Context, data []byte, mimeType string) (*bluesky.BlobRef, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("UploadBlob", len(data), mimeType); err != nil {
+		return nil, err
+	}
+	if err := c.authenticated(); err != nil {
+		return nil, err
+	}
+	ref := &bluesky.BlobRef{Type: "blob", MimeType: mimeType, Size: len(data)}
+	ref.Ref.Link = bluesky.BlobCID(data)
+	return ref, nil
+}
+
+func (c *Client) GetFeedGenerator(_ context.Context, rkey string) (*bluesky.FeedGeneratorRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("GetFeedGenerator", rkey); err != nil {
+		return nil, err
+	}
+	if err := c.authenticated(); err != nil {
+		return nil, err
+	}
+	rec, ok := c.records[rkey]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (c *Client) PublishFeedGenerator(_ context.Context, rkey string, record bluesky.FeedGeneratorRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("PublishFeedGenerator", rkey, record); err != nil {
+		return err
+	}
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	if c.records == nil {
+		c.records = make(map[string]bluesky.FeedGeneratorRecord)
+	}
+	c.records[rkey] = record
+	return nil
+}
+
+func (c *Client) UnpublishFeedGenerator(_ context.Context, rkey string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("UnpublishFeedGenerator", rkey); err != nil {
+		return err
+	}
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	delete(c.records, rkey)
+	return nil
+}
+
+func (c *Client) ListFeedGenerators(context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("ListFeedGenerators"); err != nil {
+		return nil, err
+	}
+	if err := c.authenticated(); err != nil {
+		return nil, err
+	}
+	rkeys := make([]string, 0, len(c.records))
+	for rkey := range c.records {
+		rkeys = append(rkeys, rkey)
+	}
+	slices.Sort(rkeys)
+	return rkeys, nil
+}
+
+func (c *Client) UnpublishFeedGenerators(_ context.Context, rkeys []string) []bluesky.UnpublishResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.record("UnpublishFeedGenerators", slices.Clone(rkeys))
+	if err == nil {
+		err = c.authenticated()
+	}
+	results := make([]bluesky.UnpublishResult, len(rkeys))
+	for i, rkey := range rkeys {
+		results[i] = bluesky.UnpublishResult{RKey: rkey, Err: err}
+		if err == nil {
+			delete(c.records, rkey)
+		}
+	}
+	return results
+}
+
+func (c *Client) PublishFeedGenerators(_ context.Context, records []bluesky.FeedGeneratorWrite) []bluesky.PublishResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.record("PublishFeedGenerators", slices.Clone(records))
+	if err == nil {
+		err = c.authenticated()
+	}
+	if c.records == nil {
+		c.records = make(map[string]bluesky.FeedGeneratorRecord)
+	}
+	results := make([]bluesky.PublishResult, len(records))
+	for i, r := range records {
+		results[i] = bluesky.PublishResult{RKey: r.RKey, Err: err}
+		if err == nil {
+			c.records[r.RKey] = r.Record
+		}
+	}
+	return results
+}
+
+func (c *Client) GetFeedGeneratorView(_ context.Context, feedURI string) (*bluesky.FeedGeneratorView, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("GetFeedGeneratorView", feedURI); err != nil {
+		return nil, err
+	}
+	if c.View != nil {
+		v := *c.View
+		return &v, nil
+	}
+	return &bluesky.FeedGeneratorView{URI: feedURI, IsOnline: true, IsValid: true}, nil
+}
+
+// authenticated mirrors the real client's check that Login was called first.
+func (c *Client) authenticated() error {
+	if c.did == "" {
+		return fmt.Errorf("not authenticated: call Login first")
+	}
+	return nil
+}
@@ -4,18 +4,45 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/version"
 )
 
-const defaultPDS = "https://bsky.social"
+const (
+	defaultPDS     = "https://bsky.social"
+	defaultAppView = "https://public.api.bsky.app"
+)
 
 // Client is a minimal BlueSky/AT Protocol API client for managing feed
 // generator records.
 type Client struct {
+	// UserAgent is sent with every request. NewClient sets it to
+	// version.UserAgent().
+	UserAgent string
+
+	// MaxBlobSize is the largest blob in bytes UploadBlob sends; larger ones
+	// are rejected before any request is made. NewClient sets it to
+	// DefaultMaxBlobSize. Zero means no limit.
+	MaxBlobSize int
+
+	// BlobMimeTypes lists the MIME types UploadBlob sends. NewClient sets it
+	// to DefaultBlobMimeTypes. An empty list allows any type.
+	BlobMimeTypes []string
+
+	// PLCDirectory is the directory SigningKey resolves did:plc documents
+	// from. NewClient sets it to DefaultPLCDirectory.
+	PLCDirectory string
+
 	pds        string
+	appView    string
 	httpClient *http.Client
 
 	// populated after Login
@@ -23,14 +50,44 @@ type Client struct {
 	did       string
 }
 
+// FeedGeneratorAPI is the set of operations used to manage an account's
+// feed generator records. *Client implements it against the real services;
+// package blueskytest provides an in-memory fake.
+type FeedGeneratorAPI interface {
+	CheckBlob(data []byte, mimeType string) error
+	Login(ctx context.Context, identifier, password string) error
+	DID() string
+	WhoAmI(ctx context.Context) (*Session, error)
+	UploadBlob(ctx context.Context, data []byte, mimeType string) (*BlobRef, error)
+	GetFeedGenerator(ctx context.Context, rkey string) (*FeedGeneratorRecord, error)
+	PublishFeedGenerator(ctx context.Context, rkey string, record FeedGeneratorRecord) error
+	UnpublishFeedGenerator(ctx context.Context, rkey string) error
+	ListFeedGenerators(ctx context.Context) ([]string, error)
+	UnpublishFeedGenerators(ctx context.Context, rkeys []string) []UnpublishResult
+	PublishFeedGenerators(ctx context.Context, records []FeedGeneratorWrite) []PublishResult
+	GetFeedGeneratorView(ctx context.Context, feedURI string) (*FeedGeneratorView, error)
+}
+
+var _ FeedGeneratorAPI = (*Client)(nil)
+
 // NewClient creates a new BlueSky API client. If pds is empty, it defaults to
-// https://bsky.social.
-func NewClient(pds string) *Client {
+// https://bsky.social. If appView is empty, it defaults to
+// https://public.api.bsky.app. Record writes go to the PDS; read-only views
+// such as getFeedGenerator go to the AppView.
+func NewClient(pds, appView string) *Client {
 	if pds == "" {
 		pds = defaultPDS
 	}
+	if appView == "" {
+		appView = defaultAppView
+	}
 	return &Client{
-		pds: pds,
+		UserAgent:     version.UserAgent(),
+		MaxBlobSize:   DefaultMaxBlobSize,
+		BlobMimeTypes: slices.Clone(DefaultBlobMimeTypes),
+		PLCDirectory:  DefaultPLCDirectory,
+		pds:           pds,
+		appView:       appView,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -60,6 +117,29 @@ func (c *Client) DID() string {
 	return c.did
 }
 
+// Session describes the account a session token belongs to.
+type Session struct {
+	DID            string `json:"did"`
+	Handle         string `json:"handle"`
+	Email          string `json:"email,omitempty"`
+	EmailConfirmed bool   `json:"emailConfirmed"`
+}
+
+// WhoAmI returns the account of the current session via
+// com.atproto.server.getSession, confirming the session token is still
+// valid. It has no side effects and must be called after Login.
+func (c *Client) WhoAmI(ctx context.Context) (*Session, error) {
+	if c.accessJwt == "" {
+		return nil, fmt.Errorf("not authenticated: call Login first")
+	}
+
+	var session Session
+	if err := c.get(ctx, c.pds, "/xrpc/com.atproto.server.getSession", &session); err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return &session, nil
+}
+
 // BlobRef represents an AT Protocol blob reference for uploaded content.
 type BlobRef struct {
 	Type string `json:"$type"`
@@ -122,9 +202,118 @@ func (c *Client) UnpublishFeedGenerator(ctx context.Context, rkey string) error
 	return nil
 }
 
+// UnpublishResult is the outcome of deleting one feed generator record.
+type UnpublishResult struct {
+	RKey string
+	Err  error // nil if the record was deleted
+}
+
+// UnpublishFeedGenerators deletes each of the given feed generator records,
+// continuing past individual failures. It returns one result per rkey, in
+// order.
+//
+// Records are deleted in ApplyWrites batches. Because a batch is atomic, the
+// API can't say which record made it fail, so a rejected batch is retried one
+// record at a time to attribute the failure to individual feeds.
+func (c *Client) UnpublishFeedGenerators(ctx context.Context, rkeys []string) []UnpublishResult {
+	writes := make([]Write, len(rkeys))
+	for i, rkey := range rkeys {
+		writes[i] = Write{Action: WriteDelete, Collection: "app.bsky.feed.generator", RKey: rkey}
+	}
+	errs := c.applyEach(ctx, writes, func(i int) error {
+		return c.UnpublishFeedGenerator(ctx, rkeys[i])
+	})
+
+	results := make([]UnpublishResult, len(rkeys))
+	for i, rkey := range rkeys {
+		results[i] = UnpublishResult{RKey: rkey, Err: errs[i]}
+	}
+	return results
+}
+
+// FeedGeneratorWrite is one record for PublishFeedGenerators.
+type FeedGeneratorWrite struct {
+	RKey   string
+	Record FeedGeneratorRecord
+
+	// Exists says the record is already published, so it is updated
+	// rather than created.
+	Exists bool
+}
+
+// PublishResult is the outcome of publishing one feed generator record.
+type PublishResult struct {
+	RKey string
+	Err  error // nil if the record was written
+}
+
+// PublishFeedGenerators creates or updates each of the given feed generator
+// records, continuing past individual failures. It returns one result per
+// record, in order.
+//
+// Like UnpublishFeedGenerators, records are written in ApplyWrites batches,
+// and a rejected batch is retried one record at a time with
+// PublishFeedGenerator to attribute the failure to individual feeds.
+func (c *Client) PublishFeedGenerators(ctx context.Context, records []FeedGeneratorWrite) []PublishResult {
+	writes := make([]Write, len(records))
+	for i, r := range records {
+		action := WriteCreate
+		if r.Exists {
+			action = WriteUpdate
+		}
+		writes[i] = Write{Action: action, Collection: "app.bsky.feed.generator", RKey: r.RKey, Value: r.Record}
+	}
+	errs := c.applyEach(ctx, writes, func(i int) error {
+		return c.PublishFeedGenerator(ctx, records[i].RKey, records[i].Record)
+	})
+
+	results := make([]PublishResult, len(records))
+	for i, r := range records {
+		results[i] = PublishResult{RKey: r.RKey, Err: errs[i]}
+	}
+	return results
+}
+
+// ListFeedGenerators returns the rkeys of every feed generator record in the
+// authenticated user's repo via com.atproto.repo.listRecords.
+func (c *Client) ListFeedGenerators(ctx context.Context) ([]string, error) {
+	if c.accessJwt == "" {
+		return nil, fmt.Errorf("not authenticated: call Login first")
+	}
+
+	var rkeys []string
+	cursor := ""
+	for {
+		q := url.Values{}
+		q.Set("repo", c.did)
+		q.Set("collection", "app.bsky.feed.generator")
+		q.Set("limit", "100")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+
+		var resp listRecordsResponse
+		if err := c.get(ctx, c.pds, "/xrpc/com.atproto.repo.listRecords?"+q.Encode(), &resp); err != nil {
+			return nil, fmt.Errorf("list records: %w", err)
+		}
+		for _, r := range resp.Records {
+			rkeys = append(rkeys, r.URI[strings.LastIndex(r.URI, "/")+1:])
+		}
+		if resp.Cursor == "" || len(resp.Records) == 0 {
+			return rkeys, nil
+		}
+		cursor = resp.Cursor
+	}
+}
+
 // UploadBlob uploads raw image bytes as a blob and returns a reference.
 // The blob will be deleted if not referenced in a record within a time window.
+// Blobs failing CheckBlob are rejected with a *BlobTooLargeError or
+// *BlobTypeError without contacting the PDS.
 func (c *Client) UploadBlob(ctx context.Context, data []byte, mimeType string) (*BlobRef, error) {
+	if err := c.CheckBlob(data, mimeType); err != nil {
+		return nil, err
+	}
 	if c.accessJwt == "" {
 		return nil, fmt.Errorf("not authenticated: call Login first")
 	}
@@ -135,6 +324,7 @@ func (c *Client) UploadBlob(ctx context.Context, data []byte, mimeType string) (
 	}
 	req.Header.Set("Content-Type", mimeType)
 	req.Header.Set("Authorization", "Bearer "+c.accessJwt)
+	c.setUserAgent(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -148,7 +338,7 @@ func (c *Client) UploadBlob(ctx context.Context, data []byte, mimeType string) (
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, newAPIError(resp.StatusCode, respBody)
 	}
 
 	var result uploadBlobResponse
@@ -159,6 +349,169 @@ func (c *Client) UploadBlob(ctx context.Context, data []byte, mimeType string) (
 	return &result.Blob, nil
 }
 
+// GetFeedGenerator fetches the authenticated user's feed generator record
+// with the given rkey via com.atproto.repo.getRecord. It returns nil and no
+// error if the record doesn't exist.
+func (c *Client) GetFeedGenerator(ctx context.Context, rkey string) (*FeedGeneratorRecord, error) {
+	if c.accessJwt == "" {
+		return nil, fmt.Errorf("not authenticated: call Login first")
+	}
+
+	q := url.Values{}
+	q.Set("repo", c.did)
+	q.Set("collection", "app.bsky.feed.generator")
+	q.Set("rkey", rkey)
+
+	var resp getRecordResponse
+	if err := c.get(ctx, c.pds, "/xrpc/com.atproto.repo.getRecord?"+q.Encode(), &resp); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == "RecordNotFound" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get record: %w", err)
+	}
+
+	return &resp.Value, nil
+}
+
+// FeedGeneratorView is the AppView's view of a published feed generator,
+// along with the health status it reports for the generator service.
+type FeedGeneratorView struct {
+	URI         string `json:"uri"`
+	CID         string `json:"cid"`
+	DID         string `json:"did"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+	LikeCount   int    `json:"likeCount"`
+	IndexedAt   string `json:"indexedAt"`
+
+	// IsOnline reports whether the AppView could reach the feed generator service.
+	IsOnline bool `json:"-"`
+
+	// IsValid reports whether the feed generator service's DID document and
+	// describeFeedGenerator response are consistent with the record.
+	IsValid bool `json:"-"`
+}
+
+// GetFeedGeneratorView fetches the AppView's view of a feed generator via
+// app.bsky.feed.getFeedGenerator. Unlike the other methods, this queries the
+// AppView rather than the PDS and does not require authentication.
+func (c *Client) GetFeedGeneratorView(ctx context.Context, feedURI string) (*FeedGeneratorView, error) {
+	path := "/xrpc/app.bsky.feed.getFeedGenerator?feed=" + url.QueryEscape(feedURI)
+
+	var resp getFeedGeneratorResponse
+	if err := c.get(ctx, c.appView, path, &resp); err != nil {
+		return nil, fmt.Errorf("get feed generator: %w", err)
+	}
+
+	view := resp.View
+	view.IsOnline = resp.IsOnline
+	view.IsValid = resp.IsValid
+	return &view, nil
+}
+
+// GetPostText fetches the text of a post from the AppView via
+// app.bsky.feed.getPosts. It returns "" and no error if the post doesn't
+// exist or isn't visible. It does not require authentication.
+func (c *Client) GetPostText(ctx context.Context, uri string) (string, error) {
+	path := "/xrpc/app.bsky.feed.getPosts?uris=" + url.QueryEscape(uri)
+
+	var resp getPostsResponse
+	if err := c.get(ctx, c.appView, path, &resp); err != nil {
+		return "", fmt.Errorf("get posts: %w", err)
+	}
+	for _, p := range resp.Posts {
+		if p.URI == uri {
+			return p.Record.Text, nil
+		}
+	}
+	return "", nil
+}
+
+// ResolveHandle resolves an account handle to its DID via the AppView's
+// com.atproto.identity.resolveHandle. It does not require authentication.
+func (c *Client) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	path := "/xrpc/com.atproto.identity.resolveHandle?handle=" + url.QueryEscape(handle)
+
+	var resp struct {
+		DID string `json:"did"`
+	}
+	if err := c.get(ctx, c.appView, path, &resp); err != nil {
+		return "", fmt.Errorf("resolve handle: %w", err)
+	}
+	if resp.DID == "" {
+		return "", fmt.Errorf("resolve handle: no DID returned for %q", handle)
+	}
+	return resp.DID, nil
+}
+
+// Profile is the subset of an app.bsky.actor.defs#profileViewDetailed we
+// use.
+type Profile struct {
+	DID            string `json:"did"`
+	Handle         string `json:"handle"`
+	FollowersCount int    `json:"followersCount"`
+	FollowsCount   int    `json:"followsCount"`
+	PostsCount     int    `json:"postsCount"`
+}
+
+// GetProfile fetches an account's profile from the AppView via
+// app.bsky.actor.getProfile. It does not require authentication.
+func (c *Client) GetProfile(ctx context.Context, did string) (*Profile, error) {
+	path := "/xrpc/app.bsky.actor.getProfile?actor=" + url.QueryEscape(did)
+
+	var profile Profile
+	if err := c.get(ctx, c.appView, path, &profile); err != nil {
+		return nil, fmt.Errorf("get profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// GetFollowersCount returns the number of followers of the account did, via
+// GetProfile.
+func (c *Client) GetFollowersCount(ctx context.Context, did string) (int, error) {
+	profile, err := c.GetProfile(ctx, did)
+	if err != nil {
+		return 0, err
+	}
+	return profile.FollowersCount, nil
+}
+
+func (c *Client) get(ctx context.Context, baseURL, path string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if c.accessJwt != "" && baseURL == c.pds {
+		req.Header.Set("Authorization", "Bearer "+c.accessJwt)
+	}
+	c.setUserAgent(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp.StatusCode, respBody)
+	}
+
+	if result != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("unmarshal response: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (c *Client) post(ctx context.Context, path string, body any, result any) error {
 	payload, err := json.Marshal(body)
 	if err != nil {
@@ -173,6 +526,7 @@ func (c *Client) post(ctx context.Context, path string, body any, result any) er
 	if c.accessJwt != "" {
 		req.Header.Set("Authorization", "Bearer "+c.accessJwt)
 	}
+	c.setUserAgent(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -186,7 +540,7 @@ func (c *Client) post(ctx context.Context, path string, body any, result any) er
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return newAPIError(resp.StatusCode, respBody)
 	}
 
 	if result != nil && len(respBody) > 0 {
@@ -198,6 +552,39 @@ func (c *Client) post(ctx context.Context, path string, body any, result any) er
 	return nil
 }
 
+// APIError is returned when an XRPC call responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+
+	// Code is the XRPC error name (e.g. "RecordNotFound"), if the body
+	// carried one.
+	Code string
+
+	// Body is the raw response body.
+	Body string
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Body: string(body)}
+	var xrpcErr struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &xrpcErr) == nil {
+		e.Code = xrpcErr.Error
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+func (c *Client) setUserAgent(req *http.Request) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+}
+
 type createSessionResponse struct {
 	AccessJwt string `json:"accessJwt"`
 	DID       string `json:"did"`
@@ -220,3 +607,31 @@ type deleteRecordRequest struct {
 type uploadBlobResponse struct {
 	Blob BlobRef `json:"blob"`
 }
+
+type getRecordResponse struct {
+	URI   string              `json:"uri"`
+	CID   string              `json:"cid"`
+	Value FeedGeneratorRecord `json:"value"`
+}
+
+type listRecordsResponse struct {
+	Cursor  string `json:"cursor,omitempty"`
+	Records []struct {
+		URI string `json:"uri"`
+	} `json:"records"`
+}
+
+type getPostsResponse struct {
+	Posts []struct {
+		URI    string `json:"uri"`
+		Record struct {
+			Text string `json:"text"`
+		} `json:"record"`
+	} `json:"posts"`
+}
+
+type getFeedGeneratorResponse struct {
+	View     FeedGeneratorView `json:"view"`
+	IsOnline bool              `json:"isOnline"`
+	IsValid  bool              `json:"isValid"`
+}
@@ -0,0 +1,60 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultPLCDirectory is the directory did:plc documents are resolved from.
+const DefaultPLCDirectory = "https://plc.directory"
+
+// didDocument is the subset of a DID document we use.
+type didDocument struct {
+	ID                 string `json:"id"`
+	VerificationMethod []struct {
+		ID                 string `json:"id"`
+		Type               string `json:"type"`
+		PublicKeyMultibase string `json:"publicKeyMultibase"`
+	} `json:"verificationMethod"`
+}
+
+// SigningKey resolves did's DID document and returns the account's atproto
+// signing key: the publicKeyMultibase of its #atproto verification method.
+// did:plc documents come from PLCDirectory, did:web documents from the
+// host's /.well-known/did.json. It does not require authentication.
+func (c *Client) SigningKey(ctx context.Context, did string) (string, error) {
+	var baseURL, path string
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		baseURL, path = c.PLCDirectory, "/"+url.PathEscape(did)
+	case strings.HasPrefix(did, "did:web:"):
+		// atproto only uses hostname-level did:web, with any port
+		// percent-encoded.
+		host, err := url.PathUnescape(strings.TrimPrefix(did, "did:web:"))
+		if err != nil {
+			return "", fmt.Errorf("resolve %s: %w", did, err)
+		}
+		if u, err := url.Parse("https://" + host); err != nil || u.Host != host || u.Hostname() == "" {
+			return "", fmt.Errorf("resolve %s: not a hostname did:web", did)
+		}
+		baseURL, path = "https://"+host, "/.well-known/did.json"
+	default:
+		return "", fmt.Errorf("resolve %s: unsupported DID method", did)
+	}
+
+	var doc didDocument
+	if err := c.get(ctx, baseURL, path, &doc); err != nil {
+		return "", fmt.Errorf("resolve %s: %w", did, err)
+	}
+	if doc.ID != did {
+		return "", fmt.Errorf("resolve %s: document is for %q", did, doc.ID)
+	}
+	for _, m := range doc.VerificationMethod {
+		if (m.ID == "#atproto" || m.ID == did+"#atproto") && m.PublicKeyMultibase != "" {
+			return m.PublicKeyMultibase, nil
+		}
+	}
+	return "", fmt.Errorf("resolve %s: no atproto signing key", did)
+}
@@ -0,0 +1,121 @@
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// maxWritesPerBatch is the most writes the reference PDS accepts in one
+// com.atproto.repo.applyWrites call.
+const maxWritesPerBatch = 200
+
+// WriteAction is the kind of change a Write makes.
+type WriteAction string
+
+const (
+	WriteCreate WriteAction = "create"
+	WriteUpdate WriteAction = "update"
+	WriteDelete WriteAction = "delete"
+)
+
+// Write is one record change in an ApplyWrites batch.
+type Write struct {
+	Action     WriteAction
+	Collection string
+	RKey       string
+	Value      any // the record, for creates and updates
+}
+
+// WriteResult is the outcome of one write in a successful batch. URI and CID
+// are empty for deletes.
+type WriteResult struct {
+	URI string
+	CID string
+}
+
+type applyWritesRequest struct {
+	Repo   string       `json:"repo"`
+	Writes []applyWrite `json:"writes"`
+}
+
+type applyWrite struct {
+	Type       string `json:"$type"`
+	Collection string `json:"collection"`
+	RKey       string `json:"rkey"`
+	Value      any    `json:"value,omitempty"`
+}
+
+type applyWritesResponse struct {
+	Results []struct {
+		URI string `json:"uri"`
+		CID string `json:"cid"`
+	} `json:"results"`
+}
+
+// ApplyWrites applies writes to the authenticated user's repo in a single
+// com.atproto.repo.applyWrites request. The batch is atomic: either every
+// write is applied or none is, so on error no result is returned. At most
+// 200 writes are accepted per call.
+func (c *Client) ApplyWrites(ctx context.Context, writes []Write) ([]WriteResult, error) {
+	if c.accessJwt == "" {
+		return nil, fmt.Errorf("not authenticated: call Login first")
+	}
+	if len(writes) == 0 {
+		return nil, nil
+	}
+	if len(writes) > maxWritesPerBatch {
+		return nil, fmt.Errorf("apply writes: %d writes exceeds the limit of %d per batch", len(writes), maxWritesPerBatch)
+	}
+
+	body := applyWritesRequest{Repo: c.did, Writes: make([]applyWrite, len(writes))}
+	for i, w := range writes {
+		switch w.Action {
+		case WriteCreate, WriteUpdate, WriteDelete:
+		default:
+			return nil, fmt.Errorf("apply writes: write %d has unknown action %q", i, w.Action)
+		}
+		body.Writes[i] = applyWrite{
+			Type:       "com.atproto.repo.applyWrites#" + string(w.Action),
+			Collection: w.Collection,
+			RKey:       w.RKey,
+			Value:      w.Value,
+		}
+	}
+
+	var resp applyWritesResponse
+	if err := c.post(ctx, "/xrpc/com.atproto.repo.applyWrites", body, &resp); err != nil {
+		return nil, fmt.Errorf("apply writes: %w", err)
+	}
+
+	results := make([]WriteResult, len(writes))
+	for i := range min(len(resp.Results), len(results)) {
+		results[i] = WriteResult{URI: resp.Results[i].URI, CID: resp.Results[i].CID}
+	}
+	return results, nil
+}
+
+// applyEach applies writes in ApplyWrites batches and returns one error per
+// write. A batch the server rejects is atomic, so it can't say which write
+// was at fault; each write in it is retried on its own with single(i) so the
+// failure lands on the right one. Other errors, such as a network failure,
+// are reported for every write in the batch without retrying.
+func (c *Client) applyEach(ctx context.Context, writes []Write, single func(i int) error) []error {
+	errs := make([]error, len(writes))
+	for start := 0; start < len(writes); start += maxWritesPerBatch {
+		end := min(start+maxWritesPerBatch, len(writes))
+		_, err := c.ApplyWrites(ctx, writes[start:end])
+
+		var apiErr *APIError
+		for i := start; i < end; i++ {
+			switch {
+			case err == nil:
+			case errors.As(err, &apiErr):
+				errs[i] = single(i)
+			default:
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,112 @@
+// Package circuitbreaker provides a repository decorator that stops calling a
+// failing store for a cooldown period instead of letting every caller wait
+// for it to time out.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// Breaker states, as reported by State.
+const (
+	StateClosed   = "closed"    // calls pass through
+	StateOpen     = "open"      // calls fail fast until the cooldown elapses
+	StateHalfOpen = "half-open" // a single probe call is in flight
+)
+
+// Breaker trips open after a run of consecutive failures and fast-fails
+// calls until cooldown has elapsed, then lets one probe call through to test
+// recovery.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// New creates a Breaker that opens after threshold consecutive failures and
+// stays open for cooldown.
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     StateClosed,
+	}
+}
+
+// State returns the current breaker state.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a call may proceed, moving an open breaker to
+// half-open once the cooldown has elapsed.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return fmt.Errorf("%w: circuit breaker open", domain.ErrUnavailable)
+		}
+		b.state = StateHalfOpen
+		return nil
+	case StateHalfOpen:
+		return fmt.Errorf("%w: circuit breaker probing", domain.ErrUnavailable)
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a call.
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !countsAsFailure(err) {
+		if b.state == StateHalfOpen {
+			b.state = StateClosed
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// countsAsFailure reports whether err indicates the store is unhealthy.
+// Caller mistakes, cancellations and calls turned away by a local
+// concurrency limit say nothing about the store.
+func countsAsFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, domain.ErrInvalidCursor) &&
+		!errors.Is(err, domain.ErrOverloaded) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// call runs fn through the breaker.
+func call[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	if err := b.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := fn()
+	b.record(err)
+	return v, err
+}
@@ -0,0 +1,119 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// Store is the set of repository ports a Repository wraps.
+type Store interface {
+	domain.PostRepository
+	domain.CursorRepository
+}
+
+// Repository implements domain.PostRepository and domain.CursorRepository by
+// passing every call through a Breaker to an underlying Store.
+type Repository struct {
+	store   Store
+	breaker *Breaker
+}
+
+// NewRepository wraps store with breaker.
+func NewRepository(store Store, breaker *Breaker) *Repository {
+	return &Repository{store: store, breaker: breaker}
+}
+
+// RepositoryState implements domain.RepositoryStateReporter.
+func (r *Repository) RepositoryState() string {
+	return r.breaker.State()
+}
+
+// Ping implements domain.RepositoryPinger through the breaker, so a
+// successful ping can close it. Stores that can't ping report
+// errors.ErrUnsupported.
+func (r *Repository) Ping(ctx context.Context) error {
+	pinger, ok := r.store.(domain.RepositoryPinger)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	_, err := call(r.breaker, func() (struct{}, error) {
+		return struct{}{}, pinger.Ping(ctx)
+	})
+	return err
+}
+
+// CreatePost implements domain.PostRepository.
+func (r *Repository) CreatePost(ctx context.Context, post *domain.Post, feedURIs []string) error {
+	_, err := call(r.breaker, func() (struct{}, error) {
+		return struct{}{}, r.store.CreatePost(ctx, post, feedURIs)
+	})
+	return err
+}
+
+// DeletePost implements domain.PostRepository.
+func (r *Repository) DeletePost(ctx context.Context, uri string) error {
+	_, err := call(r.breaker, func() (struct{}, error) {
+		return struct{}{}, r.store.DeletePost(ctx, uri)
+	})
+	return err
+}
+
+// IsTombstoned implements domain.PostRepository.
+func (r *Repository) IsTombstoned(ctx context.Context, uri string, since time.Time) (bool, error) {
+	return call(r.breaker, func() (bool, error) {
+		return r.store.IsTombstoned(ctx, uri, since)
+	})
+}
+
+// DeleteTombstonesBefore implements domain.PostRepository.
+func (r *Repository) DeleteTombstonesBefore(ctx context.Context, t time.Time) (int64, error) {
+	return call(r.breaker, func() (int64, error) {
+		return r.store.DeleteTombstonesBefore(ctx, t)
+	})
+}
+
+// DeleteOldPosts implements domain.PostRepository.
+func (r *Repository) DeleteOldPosts(ctx context.Context, feedURI string, maxAge time.Duration, maxRows int) (domain.CleanupResult, error) {
+	return call(r.breaker, func() (domain.CleanupResult, error) {
+		return r.store.DeleteOldPosts(ctx, feedURI, maxAge, maxRows)
+	})
+}
+
+// DeletePostsBefore implements domain.PostRepository.
+func (r *Repository) DeletePostsBefore(ctx context.Context, t time.Time) (int64, error) {
+	return call(r.breaker, func() (int64, error) {
+		return r.store.DeletePostsBefore(ctx, t)
+	})
+}
+
+// GetFeedPosts implements domain.PostRepository.
+func (r *Repository) GetFeedPosts(ctx context.Context, feedURI string, limit int, cursor string, langs []string) ([]domain.Post, string, error) {
+	var posts []domain.Post
+	next, err := call(r.breaker, func() (string, error) {
+		var (
+			next string
+			err  error
+		)
+		posts, next, err = r.store.GetFeedPosts(ctx, feedURI, limit, cursor, langs)
+		return next, err
+	})
+	return posts, next, err
+}
+
+// GetCursor implements domain.CursorRepository.
+func (r *Repository) GetCursor(ctx context.Context, service string) (int64, error) {
+	return call(r.breaker, func() (int64, error) {
+		return r.store.GetCursor(ctx, service)
+	})
+}
+
+// UpdateCursor implements domain.CursorRepository.
+func (r *Repository) UpdateCursor(ctx context.Context, service string, cursor int64) error {
+	_, err := call(r.breaker, func() (struct{}, error) {
+		return struct{}{}, r.store.UpdateCursor(ctx, service, cursor)
+	})
+	return err
+}
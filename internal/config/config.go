@@ -1,11 +1,38 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/version"
 )
 
+// didPattern matches the generic DID syntax: did:<method>:<method-specific-id>.
+var didPattern = regexp.MustCompile(`^did:[a-z]+:[a-zA-Z0-9._:%-]+$`)
+
+// handlePattern matches an AT Protocol handle such as "alice.bsky.social",
+// with an optional leading '@'.
+var handlePattern = regexp.MustCompile(`^@?([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// maxWantedDIDs is the most wantedDids Jetstream accepts on a subscription.
+const maxWantedDIDs = 10000
+
+// minAdminTokenLen is the shortest FEEDGEN_ADMIN_TOKEN accepted.
+const minAdminTokenLen = 16
+
 // Config holds all configuration for the application.
 type Config struct {
 	// Hostname is the public hostname where this service is reachable (used for did:web).
@@ -17,54 +44,1084 @@ type Config struct {
 	// PublisherDID is the DID of the account that published the feed generator records.
 	PublisherDID string
 
+	// ResolvePublisherHandle allows PublisherDID to be set to a handle, which
+	// ResolvePublisher then resolves to its DID at startup.
+	ResolvePublisherHandle bool
+
+	// AllowedPublisherDIDs are additional DIDs whose feed URIs this server
+	// may serve, e.g. while migrating feeds between accounts.
+	AllowedPublisherDIDs []string
+
+	// ExtraHosts are additional generators served by this process, each
+	// under its own hostname and service DID. Requests are routed to a host
+	// by their Host header; anything else is served as Hostname.
+	ExtraHosts []Host
+
+	// TLSCertPath and TLSKeyPath locate the PEM certificate and key used to
+	// serve HTTPS directly. Both empty (the default) serves plain HTTP, for
+	// deployments behind a TLS-terminating proxy.
+	TLSCertPath string
+	TLSKeyPath  string
+
+	// HTTPRedirectPort, when TLS is enabled, runs a second plain HTTP
+	// listener on this port that redirects to HTTPS. Zero disables it.
+	HTTPRedirectPort int
+
 	// DatabasePath is the path to the SQLite database file.
 	DatabasePath string
 
+	// DBReplicaPath is an optional read-only replica of the database that
+	// serves feed reads. Empty serves them from DatabasePath.
+	DBReplicaPath string
+
+	// DBMaxConcurrentQueries bounds in-flight repository calls. Zero means
+	// unlimited.
+	DBMaxConcurrentQueries int
+
+	// DBQueueTimeout is how long a repository call waits for a free slot
+	// when DBMaxConcurrentQueries is reached. Zero fails fast.
+	DBQueueTimeout time.Duration
+
+	// DBStatementTimeout bounds how long any repository call may run once
+	// admitted. Zero means no limit.
+	DBStatementTimeout time.Duration
+
+	// DBBinaryCIDs stores post CIDs in binary rather than as text.
+	DBBinaryCIDs bool
+
+	// BreakerThreshold is the number of consecutive repository failures that
+	// open the circuit breaker. Zero disables the breaker.
+	BreakerThreshold int
+
+	// BreakerCooldown is how long the open breaker fast-fails before letting
+	// a probe call through.
+	BreakerCooldown time.Duration
+
 	// FirehoseURL is the Jetstream WebSocket endpoint.
 	FirehoseURL string
+
+	// AppViewURL is the BlueSky AppView used to look up posts, e.g. the text
+	// of quoted posts.
+	AppViewURL string
+
+	// FirehoseWantedDIDs restricts the firehose to events from these
+	// accounts, filtered server-side by Jetstream. Empty means all accounts.
+	FirehoseWantedDIDs []string
+
+	// UserAgent is sent on outbound HTTP and WebSocket requests.
+	UserAgent string
+
+	// FirehoseBadPayloadSampleRate logs one in every N malformed firehose
+	// payloads (truncated) at debug level. Zero disables sampling.
+	FirehoseBadPayloadSampleRate int
+
+	// FirehoseRequireCursor refuses to start the firehose subscriber when no
+	// saved cursor exists, preventing accidental replays or gaps in prod.
+	FirehoseRequireCursor bool
+
+	// FirehoseAllowStartWithoutCursor overrides FirehoseRequireCursor for a
+	// deliberate fresh start.
+	FirehoseAllowStartWithoutCursor bool
+
+	// FirehoseBackfill, when no saved cursor exists, starts the firehose this
+	// far in the past instead of live. Zero starts live.
+	FirehoseBackfill time.Duration
+
+	// FirehoseCursorSaveInterval is roughly how often the firehose cursor is
+	// saved. Each wait is jittered by up to 10% so instances sharing a
+	// database don't write in lockstep.
+	FirehoseCursorSaveInterval time.Duration
+
+	// FirehoseCursorSaveEvents, if positive, also saves the cursor once this
+	// many events have been processed since the last save, so a burst is
+	// checkpointed sooner than FirehoseCursorSaveInterval.
+	FirehoseCursorSaveEvents int
+
+	// FirehoseCursorMinAdvance skips a periodic cursor save when the cursor
+	// has moved less than this since the last save, to cut write churn on
+	// the cursor table during quiet periods. Zero saves every time.
+	FirehoseCursorMinAdvance time.Duration
+
+	// FirehoseMaxFailures makes the firehose subscriber give up, and the
+	// server exit non-zero, after this many consecutive connection failures.
+	// Zero keeps reconnecting forever.
+	FirehoseMaxFailures int
+
+	// FirehoseSlowEventThreshold logs a warning and counts a slow event when
+	// handling a single firehose event takes longer than this. Zero disables
+	// the warning.
+	FirehoseSlowEventThreshold time.Duration
+
+	// FirehoseEventDeadline abandons an event whose handling takes longer
+	// than this: the subscriber stops waiting for it and moves on to the
+	// next event. Zero waits forever.
+	FirehoseEventDeadline time.Duration
+
+	// CleanupInterval is how often the post cleanup job runs.
+	CleanupInterval time.Duration
+
+	// PostMaxAge is the default retention for indexed posts, for feeds that
+	// don't set their own MaxAge.
+	PostMaxAge time.Duration
+
+	// PostMaxRows is the default per-feed row cap, for feeds that don't set
+	// their own MaxRows.
+	PostMaxRows int
+
+	// TombstoneWindow is how long deleted post URIs are remembered so that
+	// replayed create events don't re-insert them. Zero disables tombstones.
+	TombstoneWindow time.Duration
+
+	// WriteFailurePolicy is what happens to matched posts that fail to
+	// persist: "buffer" (retry from a bounded buffer), "drop", or "block"
+	// (stop reading the firehose until the write succeeds).
+	WriteFailurePolicy string
+
+	// DedupWindow and DedupSize bound the recently-seen post URI set used to
+	// skip duplicate firehose creates. Either zero disables it.
+	DedupWindow time.Duration
+	DedupSize   int
+
+	// ReadPositionTTL and ReadPositionMaxRows bound the stored read
+	// positions of requesters of feeds with ResumeFromLastSeen: positions
+	// unused for the TTL are removed, and the rest capped at the row count.
+	ReadPositionTTL     time.Duration
+	ReadPositionMaxRows int
+
+	// PLCURL is the PLC directory requesters' did:plc documents are resolved
+	// from, to verify their service auth tokens.
+	PLCURL string
+
+	// SigningKeyTTL is how long a requester's resolved signing key is
+	// trusted before it is looked up again.
+	SigningKeyTTL time.Duration
+
+	// KeywordStatsWindow is the rolling window for per-keyword match counts
+	// reported by /stats. Zero disables them.
+	KeywordStatsWindow time.Duration
+
+	// FeedStatsTTL is how long /stats/feeds reuses its per-feed post counts
+	// before counting again.
+	FeedStatsTTL time.Duration
+
+	// RetryBufferSize is how many matched posts are held in memory for retry
+	// while the database is failing. Zero disables buffering.
+	RetryBufferSize int
+
+	// Trace starts the matching trace at startup, logging a TraceSampleRate
+	// fraction of posts at debug level with each feed's decision. It can
+	// also be toggled at runtime through /admin/trace.
+	Trace           bool
+	TraceSampleRate float64
+
+	// AdminToken is the bearer token required by the /admin endpoints. Empty
+	// disables them.
+	AdminToken string
+
+	// WebhookSecret signs the bodies of feed webhook notifications. Empty
+	// sends them unsigned.
+	WebhookSecret string
+
+	// WebhookWorkers is how many webhook notifications are delivered
+	// concurrently.
+	WebhookWorkers int
+
+	// PublicFeedRateLimit is how many requests per minute each client may
+	// make to the public /feed/{rkey} documents of feeds marked Public.
+	PublicFeedRateLimit int
+
+	// TrustedProxies are the addresses of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed. Requests from
+	// anywhere else are identified by their peer address.
+	TrustedProxies []netip.Prefix
+
+	// PrivacyPolicyURL and TermsOfServiceURL are advertised as links in
+	// describeFeedGenerator when set.
+	PrivacyPolicyURL  string
+	TermsOfServiceURL string
+
+	// DegradedServing makes getFeedSkeleton respond 200 with the last good
+	// first page (or an empty feed) instead of 500 when the repository fails.
+	DegradedServing bool
+
+	// SkeletonPost also accepts getFeedSkeleton as a POST with its
+	// parameters in a JSON body, for cursors too long for a query string.
+	SkeletonPost bool
+
+	// LogLevel is the minimum level of log records that are emitted.
+	LogLevel slog.Level
+
+	// LogFormat selects the log handler: "json" or "text".
+	LogFormat string
+
+	// Features switches optional subsystems on or off.
+	Features Features
+}
+
+// Host is one feed generator served by this process: a hostname, which
+// determines its did:web service DID, and the account its feeds are
+// published under.
+type Host struct {
+	Hostname     string
+	PublisherDID string
+
+	// AllowedPublisherDIDs are additional publisher DIDs whose feeds belong
+	// to this host. Only the primary host has any.
+	AllowedPublisherDIDs []string
+}
+
+// ServiceDID returns the did:web for the host based on its hostname.
+func (h Host) ServiceDID() string {
+	return "did:web:" + h.Hostname
+}
+
+// Serves reports whether feeds published by did belong to this host.
+func (h Host) Serves(did string) bool {
+	return did == h.PublisherDID || slices.Contains(h.AllowedPublisherDIDs, did)
 }
 
 // ServiceDID returns the did:web for this feed generator based on the hostname.
 func (c *Config) ServiceDID() string {
-	return "did:web:" + c.Hostname
+	return c.PrimaryHost().ServiceDID()
+}
+
+// publisherIsHandle reports whether PublisherDID holds a handle rather than
+// a DID.
+func (c *Config) publisherIsHandle() bool {
+	return !strings.HasPrefix(c.PublisherDID, "did:") && handlePattern.MatchString(c.PublisherDID)
+}
+
+// ResolvePublisher replaces a handle in PublisherDID with the DID resolver
+// returns for it, when ResolvePublisherHandle is set. It does nothing if
+// PublisherDID is already a DID, and makes no request unless it has to.
+func (c *Config) ResolvePublisher(ctx context.Context, resolver interface {
+	ResolveHandle(ctx context.Context, handle string) (string, error)
+}) error {
+	if !c.ResolvePublisherHandle || !c.publisherIsHandle() {
+		return nil
+	}
+	handle := strings.ToLower(strings.TrimPrefix(c.PublisherDID, "@"))
+	did, err := resolver.ResolveHandle(ctx, handle)
+	if err != nil {
+		return fmt.Errorf("resolve FEEDGEN_PUBLISHER_DID handle %q: %w", handle, err)
+	}
+	if !didPattern.MatchString(did) {
+		return fmt.Errorf("FEEDGEN_PUBLISHER_DID handle %q resolved to %q, which is not a valid DID", handle, did)
+	}
+	c.PublisherDID = did
+	return nil
+}
+
+// PrimaryHost returns the host configured by FEEDGEN_HOSTNAME and
+// FEEDGEN_PUBLISHER_DID.
+func (c *Config) PrimaryHost() Host {
+	return Host{
+		Hostname:             c.Hostname,
+		PublisherDID:         c.PublisherDID,
+		AllowedPublisherDIDs: c.AllowedPublisherDIDs,
+	}
+}
+
+// Hosts returns every host served, the primary host first.
+func (c *Config) Hosts() []Host {
+	return append([]Host{c.PrimaryHost()}, c.ExtraHosts...)
+}
+
+// HostFor returns the host a request with the given Host header is for,
+// falling back to the primary host for unknown or missing names.
+func (c *Config) HostFor(requestHost string) Host {
+	name := requestHost
+	if h, _, err := net.SplitHostPort(requestHost); err == nil {
+		name = h
+	}
+	for _, h := range c.ExtraHosts {
+		if strings.EqualFold(h.Hostname, name) {
+			return h
+		}
+	}
+	return c.PrimaryHost()
+}
+
+// IsAllowedPublisher reports whether did is the publisher DID of any host or
+// one of the allowed publisher DIDs.
+func (c *Config) IsAllowedPublisher(did string) bool {
+	for _, h := range c.Hosts() {
+		if h.Serves(did) {
+			return true
+		}
+	}
+	return false
 }
 
 // Load reads configuration from environment variables with sensible defaults.
+// Every variable may alternatively be supplied via a KEY_FILE variable; see
+// Getenv.
 func Load() (*Config, error) {
-	port := 3000
-	if p := os.Getenv("PORT"); p != "" {
-		var err error
-		port, err = strconv.Atoi(p)
+	port, err := getenvInt("PORT", 3000)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := getenvDefault("FEEDGEN_HOSTNAME", "localhost")
+	if err != nil {
+		return nil, err
+	}
+
+	publisherDID, err := Getenv("FEEDGEN_PUBLISHER_DID")
+	if err != nil {
+		return nil, err
+	}
+
+	resolvePublisher, err := getenvBool("FEEDGEN_RESOLVE_PUBLISHER_HANDLE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	dbPath, err := getenvDefault("DATABASE_PATH", "/data/bluesky-feeds.db")
+	if err != nil {
+		return nil, err
+	}
+
+	dbMaxConcurrent, err := getenvInt("DATABASE_MAX_CONCURRENT_QUERIES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dbQueueTimeout, err := getenvDuration("DATABASE_QUEUE_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	dbStatementTimeout, err := getenvDuration("DATABASE_STATEMENT_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dbBinaryCIDs, err := getenvBool("DATABASE_BINARY_CIDS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	dbReplicaPath, err := Getenv("DATABASE_REPLICA_PATH")
+	if err != nil {
+		return nil, err
+	}
+
+	breakerThreshold, err := getenvInt("DATABASE_BREAKER_THRESHOLD", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	breakerCooldown, err := getenvDuration("DATABASE_BREAKER_COOLDOWN", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	firehoseURL, err := getenvDefault("FEEDGEN_FIREHOSE_URL", "wss://jetstream1.us-east.bsky.network/subscribe")
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent, err := getenvDefault("FEEDGEN_USER_AGENT", version.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+
+	badPayloadSampleRate, err := getenvInt("FEEDGEN_FIREHOSE_BAD_PAYLOAD_SAMPLE_RATE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	requireCursor, err := getenvBool("FEEDGEN_REQUIRE_CURSOR", false)
+	if err != nil {
+		return nil, err
+	}
+
+	allowNoCursor, err := getenvBool("FEEDGEN_ALLOW_START_WITHOUT_CURSOR", false)
+	if err != nil {
+		return nil, err
+	}
+
+	backfill, err := getenvDuration("FEEDGEN_FIREHOSE_BACKFILL", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cursorSaveInterval, err := getenvDuration("FEEDGEN_FIREHOSE_CURSOR_SAVE_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	cursorSaveEvents, err := getenvInt("FEEDGEN_FIREHOSE_CURSOR_SAVE_EVENTS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cursorMinAdvance, err := getenvDuration("FEEDGEN_FIREHOSE_CURSOR_MIN_ADVANCE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	maxFailures, err := getenvInt("FEEDGEN_FIREHOSE_MAX_FAILURES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	slowEventThreshold, err := getenvDuration("FEEDGEN_FIREHOSE_SLOW_EVENT_THRESHOLD", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	eventDeadline, err := getenvDuration("FEEDGEN_FIREHOSE_EVENT_DEADLINE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupInterval, err := getenvDuration("FEEDGEN_CLEANUP_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	postMaxAge, err := getenvDuration("FEEDGEN_POST_MAX_AGE", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	postMaxRows, err := getenvInt("FEEDGEN_POST_MAX_ROWS", 500)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstoneWindow, err := getenvDuration("FEEDGEN_TOMBSTONE_WINDOW", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	retryBufferSize, err := getenvInt("FEEDGEN_RETRY_BUFFER_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	adminToken, err := Getenv("FEEDGEN_ADMIN_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	privacyPolicy, err := Getenv("FEEDGEN_PRIVACY_POLICY_URL")
+	if err != nil {
+		return nil, err
+	}
+
+	termsOfService, err := Getenv("FEEDGEN_TERMS_OF_SERVICE_URL")
+	if err != nil {
+		return nil, err
+	}
+
+	degradedServing, err := getenvBool("FEEDGEN_DEGRADED_SERVING", false)
+	if err != nil {
+		return nil, err
+	}
+
+	skeletonPost, err := getenvBool("FEEDGEN_SKELETON_POST", false)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCert, err := Getenv("FEEDGEN_TLS_CERT_PATH")
+	if err != nil {
+		return nil, err
+	}
+
+	tlsKey, err := Getenv("FEEDGEN_TLS_KEY_PATH")
+	if err != nil {
+		return nil, err
+	}
+
+	redirectPort, err := getenvInt("FEEDGEN_HTTP_REDIRECT_PORT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	writeFailurePolicy, err := getenvDefault("FEEDGEN_WRITE_FAILURE_POLICY", "buffer")
+	if err != nil {
+		return nil, err
+	}
+
+	dedupWindow, err := getenvDuration("FEEDGEN_DEDUP_WINDOW", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	dedupSize, err := getenvInt("FEEDGEN_DEDUP_SIZE", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	readPositionTTL, err := getenvDuration("FEEDGEN_READ_POSITION_TTL", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	readPositionMaxRows, err := getenvInt("FEEDGEN_READ_POSITION_MAX_ROWS", 100000)
+	if err != nil {
+		return nil, err
+	}
+
+	plcURL, err := getenvDefault("FEEDGEN_PLC_URL", "https://plc.directory")
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyTTL, err := getenvDuration("FEEDGEN_SIGNING_KEY_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := getenvBool("FEEDGEN_TRACE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	traceSampleRate, err := getenvFloat("FEEDGEN_TRACE_SAMPLE_RATE", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	features, err := loadFeatures()
+	if err != nil {
+		return nil, err
+	}
+
+	webhookSecret, err := Getenv("FEEDGEN_WEBHOOK_SECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	webhookWorkers, err := getenvInt("FEEDGEN_WEBHOOK_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	publicFeedRateLimit, err := getenvInt("FEEDGEN_PUBLIC_FEED_RATE_LIMIT", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := getenvPrefixes("FEEDGEN_TRUSTED_PROXIES")
+	if err != nil {
+		return nil, err
+	}
+
+	keywordStatsWindow, err := getenvDuration("FEEDGEN_KEYWORD_STATS_WINDOW", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	feedStatsTTL, err := getenvDuration("FEEDGEN_FEED_STATS_TTL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	appView, err := getenvDefault("FEEDGEN_APPVIEW_URL", "https://public.api.bsky.app")
+	if err != nil {
+		return nil, err
+	}
+
+	wantedDIDs, err := getenvList("FEEDGEN_FIREHOSE_WANTED_DIDS")
+	if err != nil {
+		return nil, err
+	}
+
+	allowedPublishers, err := getenvList("FEEDGEN_ALLOWED_PUBLISHER_DIDS")
+	if err != nil {
+		return nil, err
+	}
+
+	extraHosts, err := getenvHosts("FEEDGEN_EXTRA_HOSTS")
+	if err != nil {
+		return nil, err
+	}
+
+	var logLevel slog.Level
+	lvl, err := getenvDefault("LOG_LEVEL", "info")
+	if err != nil {
+		return nil, err
+	}
+	if err := logLevel.UnmarshalText([]byte(lvl)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be one of debug, info, warn, error", lvl)
+	}
+
+	logFormat, err := getenvDefault("LOG_FORMAT", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Hostname:                        hostname,
+		Port:                            port,
+		PublisherDID:                    publisherDID,
+		ResolvePublisherHandle:          resolvePublisher,
+		AllowedPublisherDIDs:            allowedPublishers,
+		ExtraHosts:                      extraHosts,
+		TLSCertPath:                     tlsCert,
+		TLSKeyPath:                      tlsKey,
+		HTTPRedirectPort:                redirectPort,
+		DatabasePath:                    dbPath,
+		DBMaxConcurrentQueries:          dbMaxConcurrent,
+		DBQueueTimeout:                  dbQueueTimeout,
+		DBStatementTimeout:              dbStatementTimeout,
+		DBBinaryCIDs:                    dbBinaryCIDs,
+		DBReplicaPath:                   dbReplicaPath,
+		BreakerThreshold:                breakerThreshold,
+		BreakerCooldown:                 breakerCooldown,
+		FirehoseURL:                     firehoseURL,
+		FirehoseWantedDIDs:              wantedDIDs,
+		AppViewURL:                      appView,
+		UserAgent:                       userAgent,
+		AdminToken:                      adminToken,
+		Trace:                           trace,
+		TraceSampleRate:                 traceSampleRate,
+		WebhookSecret:                   webhookSecret,
+		WebhookWorkers:                  webhookWorkers,
+		PublicFeedRateLimit:             publicFeedRateLimit,
+		TrustedProxies:                  trustedProxies,
+		PrivacyPolicyURL:                privacyPolicy,
+		TermsOfServiceURL:               termsOfService,
+		DegradedServing:                 degradedServing,
+		SkeletonPost:                    skeletonPost,
+		FirehoseBadPayloadSampleRate:    badPayloadSampleRate,
+		CleanupInterval:                 cleanupInterval,
+		PostMaxAge:                      postMaxAge,
+		PostMaxRows:                     postMaxRows,
+		TombstoneWindow:                 tombstoneWindow,
+		RetryBufferSize:                 retryBufferSize,
+		WriteFailurePolicy:              strings.ToLower(writeFailurePolicy),
+		DedupWindow:                     dedupWindow,
+		ReadPositionTTL:                 readPositionTTL,
+		ReadPositionMaxRows:             readPositionMaxRows,
+		PLCURL:                          plcURL,
+		SigningKeyTTL:                   signingKeyTTL,
+		KeywordStatsWindow:              keywordStatsWindow,
+		FeedStatsTTL:                    feedStatsTTL,
+		DedupSize:                       dedupSize,
+		FirehoseRequireCursor:           requireCursor,
+		FirehoseAllowStartWithoutCursor: allowNoCursor,
+		FirehoseBackfill:                backfill,
+		FirehoseCursorSaveInterval:      cursorSaveInterval,
+		FirehoseCursorSaveEvents:        cursorSaveEvents,
+		FirehoseCursorMinAdvance:        cursorMinAdvance,
+		FirehoseMaxFailures:             maxFailures,
+		FirehoseSlowEventThreshold:      slowEventThreshold,
+		FirehoseEventDeadline:           eventDeadline,
+		LogLevel:                        logLevel,
+		LogFormat:                       strings.ToLower(logFormat),
+		Features:                        features,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration for problems. All problems are reported
+// together in a single joined error rather than stopping at the first.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Hostname == "" {
+		errs = append(errs, errors.New("FEEDGEN_HOSTNAME must not be empty"))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+
+	if (c.TLSCertPath == "") != (c.TLSKeyPath == "") {
+		errs = append(errs, errors.New("FEEDGEN_TLS_CERT_PATH and FEEDGEN_TLS_KEY_PATH must be set together"))
+	}
+
+	if c.HTTPRedirectPort != 0 {
+		if c.TLSCertPath == "" {
+			errs = append(errs, errors.New("FEEDGEN_HTTP_REDIRECT_PORT requires FEEDGEN_TLS_CERT_PATH and FEEDGEN_TLS_KEY_PATH"))
+		}
+		if c.HTTPRedirectPort < 1 || c.HTTPRedirectPort > 65535 || c.HTTPRedirectPort == c.Port {
+			errs = append(errs, fmt.Errorf("FEEDGEN_HTTP_REDIRECT_PORT must be between 1 and 65535 and differ from PORT, got %d", c.HTTPRedirectPort))
+		}
+	}
+
+	switch {
+	case c.PublisherDID == "":
+		errs = append(errs, errors.New("FEEDGEN_PUBLISHER_DID is required"))
+	case didPattern.MatchString(c.PublisherDID):
+	case c.publisherIsHandle():
+		if !c.ResolvePublisherHandle {
+			errs = append(errs, fmt.Errorf("FEEDGEN_PUBLISHER_DID %q is a handle, not a DID: set it to the account's DID "+
+				"(look it up at https://public.api.bsky.app/xrpc/com.atproto.identity.resolveHandle?handle=%s), "+
+				"or set FEEDGEN_RESOLVE_PUBLISHER_HANDLE=true to resolve it at startup",
+				c.PublisherDID, strings.TrimPrefix(c.PublisherDID, "@")))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("FEEDGEN_PUBLISHER_DID %q is not a valid DID", c.PublisherDID))
+	}
+
+	if len(c.FirehoseWantedDIDs) > maxWantedDIDs {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_WANTED_DIDS lists %d DIDs, Jetstream accepts at most %d", len(c.FirehoseWantedDIDs), maxWantedDIDs))
+	}
+	for _, did := range c.FirehoseWantedDIDs {
+		if !didPattern.MatchString(did) {
+			errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_WANTED_DIDS entry %q is not a valid DID", did))
+		}
+	}
+
+	for _, did := range c.AllowedPublisherDIDs {
+		if !didPattern.MatchString(did) {
+			errs = append(errs, fmt.Errorf("FEEDGEN_ALLOWED_PUBLISHER_DIDS entry %q is not a valid DID", did))
+		}
+	}
+
+	hostnames := map[string]bool{strings.ToLower(c.Hostname): true}
+	for _, h := range c.ExtraHosts {
+		if hostnames[strings.ToLower(h.Hostname)] {
+			errs = append(errs, fmt.Errorf("FEEDGEN_EXTRA_HOSTS hostname %q is used more than once", h.Hostname))
+		}
+		hostnames[strings.ToLower(h.Hostname)] = true
+		if !didPattern.MatchString(h.PublisherDID) {
+			errs = append(errs, fmt.Errorf("FEEDGEN_EXTRA_HOSTS publisher DID %q for %s is not a valid DID", h.PublisherDID, h.Hostname))
+		}
+	}
+
+	if c.DatabasePath == "" {
+		errs = append(errs, errors.New("DATABASE_PATH must not be empty"))
+	} else if err := checkDatabaseDir(c.DatabasePath); err != nil {
+		errs = append(errs, fmt.Errorf("DATABASE_PATH: %w", err))
+	}
+
+	if c.DBReplicaPath != "" && c.DBReplicaPath == c.DatabasePath {
+		errs = append(errs, errors.New("DATABASE_REPLICA_PATH must differ from DATABASE_PATH"))
+	}
+
+	if c.DBMaxConcurrentQueries < 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_MAX_CONCURRENT_QUERIES must not be negative, got %d", c.DBMaxConcurrentQueries))
+	}
+
+	if c.DBQueueTimeout < 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_QUEUE_TIMEOUT must not be negative, got %s", c.DBQueueTimeout))
+	}
+	if c.DBStatementTimeout < 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_STATEMENT_TIMEOUT must not be negative, got %s", c.DBStatementTimeout))
+	}
+
+	if c.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_BREAKER_THRESHOLD must not be negative, got %d", c.BreakerThreshold))
+	}
+
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("DATABASE_BREAKER_COOLDOWN must be positive, got %s", c.BreakerCooldown))
+	}
+
+	if u, err := url.Parse(c.FirehoseURL); err != nil {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_URL is invalid: %w", err))
+	} else if u.Scheme != "ws" && u.Scheme != "wss" {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_URL must use ws or wss scheme, got %q", u.Scheme))
+	} else if u.Host == "" {
+		errs = append(errs, errors.New("FEEDGEN_FIREHOSE_URL must include a host"))
+	}
+
+	if c.FirehoseBadPayloadSampleRate < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_BAD_PAYLOAD_SAMPLE_RATE must not be negative, got %d", c.FirehoseBadPayloadSampleRate))
+	}
+
+	if c.FirehoseCursorSaveInterval < time.Second {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_CURSOR_SAVE_INTERVAL must be at least 1s, got %s", c.FirehoseCursorSaveInterval))
+	}
+	if c.FirehoseCursorSaveEvents < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_CURSOR_SAVE_EVENTS must not be negative, got %d", c.FirehoseCursorSaveEvents))
+	}
+	if c.FirehoseCursorMinAdvance < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_CURSOR_MIN_ADVANCE must not be negative, got %s", c.FirehoseCursorMinAdvance))
+	}
+	if c.FirehoseMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_MAX_FAILURES must not be negative, got %d", c.FirehoseMaxFailures))
+	}
+	if c.FirehoseBackfill < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_BACKFILL must not be negative, got %s", c.FirehoseBackfill))
+	}
+	if c.FirehoseSlowEventThreshold < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_SLOW_EVENT_THRESHOLD must not be negative, got %s", c.FirehoseSlowEventThreshold))
+	}
+	if c.FirehoseEventDeadline < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_EVENT_DEADLINE must not be negative, got %s", c.FirehoseEventDeadline))
+	}
+	if c.FirehoseEventDeadline > 0 && c.FirehoseEventDeadline < time.Second {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FIREHOSE_EVENT_DEADLINE must be at least 1s when set, got %s", c.FirehoseEventDeadline))
+	}
+
+	if c.CleanupInterval <= 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_CLEANUP_INTERVAL must be positive, got %s", c.CleanupInterval))
+	}
+
+	if c.PostMaxAge <= 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_POST_MAX_AGE must be positive, got %s", c.PostMaxAge))
+	}
+
+	if c.PostMaxRows <= 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_POST_MAX_ROWS must be positive, got %d", c.PostMaxRows))
+	}
+
+	if c.TombstoneWindow < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_TOMBSTONE_WINDOW must not be negative, got %s", c.TombstoneWindow))
+	}
+
+	if c.RetryBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_RETRY_BUFFER_SIZE must not be negative, got %d", c.RetryBufferSize))
+	}
+
+	switch c.WriteFailurePolicy {
+	case "buffer", "drop", "block":
+	default:
+		errs = append(errs, fmt.Errorf("FEEDGEN_WRITE_FAILURE_POLICY must be buffer, drop, or block, got %q", c.WriteFailurePolicy))
+	}
+
+	if c.DedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_DEDUP_WINDOW must not be negative, got %s", c.DedupWindow))
+	}
+
+	if c.DedupSize < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_DEDUP_SIZE must not be negative, got %d", c.DedupSize))
+	}
+
+	if c.ReadPositionTTL <= 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_READ_POSITION_TTL must be positive, got %s", c.ReadPositionTTL))
+	}
+
+	if c.ReadPositionMaxRows < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_READ_POSITION_MAX_ROWS must not be negative, got %d", c.ReadPositionMaxRows))
+	}
+
+	if u, err := url.Parse(c.PLCURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("FEEDGEN_PLC_URL must be an http or https URL, got %q", c.PLCURL))
+	}
+
+	if c.SigningKeyTTL <= 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_SIGNING_KEY_TTL must be positive, got %s", c.SigningKeyTTL))
+	}
+
+	if c.KeywordStatsWindow != 0 && c.KeywordStatsWindow < time.Minute {
+		errs = append(errs, fmt.Errorf("FEEDGEN_KEYWORD_STATS_WINDOW must be 0 or at least 1m, got %s", c.KeywordStatsWindow))
+	}
+
+	if c.FeedStatsTTL < 0 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_FEED_STATS_TTL must not be negative, got %s", c.FeedStatsTTL))
+	}
+
+	if u, err := url.Parse(c.AppViewURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("FEEDGEN_APPVIEW_URL must be an http or https URL, got %q", c.AppViewURL))
+	}
+
+	if c.Trace && !c.Features.Trace {
+		errs = append(errs, errors.New("FEEDGEN_TRACE=true conflicts with FEEDGEN_ENABLE_TRACE=false"))
+	}
+	if c.TraceSampleRate <= 0 || c.TraceSampleRate > 1 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_TRACE_SAMPLE_RATE must be greater than 0 and at most 1, got %g", c.TraceSampleRate))
+	}
+	if c.WebhookWorkers < 1 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_WEBHOOK_WORKERS must be at least 1, got %d", c.WebhookWorkers))
+	}
+	if c.PublicFeedRateLimit < 1 {
+		errs = append(errs, fmt.Errorf("FEEDGEN_PUBLIC_FEED_RATE_LIMIT must be at least 1, got %d", c.PublicFeedRateLimit))
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minAdminTokenLen {
+		errs = append(errs, fmt.Errorf("FEEDGEN_ADMIN_TOKEN must be at least %d characters", minAdminTokenLen))
+	}
+
+	for _, link := range []struct{ key, value string }{
+		{"FEEDGEN_PRIVACY_POLICY_URL", c.PrivacyPolicyURL},
+		{"FEEDGEN_TERMS_OF_SERVICE_URL", c.TermsOfServiceURL},
+	} {
+		if link.value == "" {
+			continue
+		}
+		if u, err := url.Parse(link.value); err != nil || !u.IsAbs() || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an absolute URL, got %q", link.key, link.value))
+		}
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or text, got %q", c.LogFormat))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// NewLogger builds a slog.Logger writing to w using the configured level and
+// format.
+func (c *Config) NewLogger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.LogLevel}
+	if c.LogFormat == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// checkDatabaseDir reports an error if the directory that would hold the
+// SQLite file at path doesn't exist, since SQLite won't create it. In-memory
+// databases and "file:" URIs are left to the driver.
+func checkDatabaseDir(path string) error {
+	if path == ":memory:" || strings.HasPrefix(path, "file:") {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// Getenv returns the value of the environment variable key. If key_FILE is
+// set, the value is instead read from the file it names, which is how Docker
+// and Kubernetes secrets are mounted. The _FILE variant takes precedence when
+// both are set. Trailing newlines in the file are ignored.
+func Getenv(key string) (string, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read %s_FILE: %w", key, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(key), nil
+}
+
+func getenvDefault(key, fallback string) (string, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		return fallback, nil
+	}
+	return v, nil
+}
+
+// getenvList reads a comma-separated list, trimming spaces and dropping
+// empty entries.
+func getenvList(key string) ([]string, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// getenvPrefixes reads a comma-separated list of IP addresses and CIDR
+// ranges. A bare address is a single-address range.
+func getenvPrefixes(key string) ([]netip.Prefix, error) {
+	entries, err := getenvList(key)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
 		if err != nil {
-			return nil, fmt.Errorf("invalid PORT: %w", err)
+			return nil, fmt.Errorf("%s entry %q must be an IP address or CIDR range", key, entry)
 		}
+		prefixes = append(prefixes, prefix.Masked())
 	}
+	return prefixes, nil
+}
 
-	hostname := os.Getenv("FEEDGEN_HOSTNAME")
-	if hostname == "" {
-		hostname = "localhost"
+// getenvHosts reads a comma-separated list of hostname=publisherDID pairs.
+func getenvHosts(key string) ([]Host, error) {
+	entries, err := getenvList(key)
+	if err != nil {
+		return nil, err
 	}
+	hosts := make([]Host, 0, len(entries))
+	for _, entry := range entries {
+		hostname, did, ok := strings.Cut(entry, "=")
+		hostname, did = strings.TrimSpace(hostname), strings.TrimSpace(did)
+		if !ok || hostname == "" || did == "" {
+			return nil, fmt.Errorf("%s entry %q must be hostname=publisherDID", key, entry)
+		}
+		hosts = append(hosts, Host{Hostname: hostname, PublisherDID: did})
+	}
+	return hosts, nil
+}
 
-	publisherDID := os.Getenv("FEEDGEN_PUBLISHER_DID")
-	if publisherDID == "" {
-		return nil, fmt.Errorf("FEEDGEN_PUBLISHER_DID is required")
+func getenvBool(key string, fallback bool) (bool, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return false, err
+	}
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
 	}
+	return b, nil
+}
 
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "/data/bluesky-feeds.db"
+func getenvInt(key string, fallback int) (int, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return 0, err
+	}
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
 	}
+	return n, nil
+}
 
-	firehoseURL := os.Getenv("FEEDGEN_FIREHOSE_URL")
-	if firehoseURL == "" {
-		firehoseURL = "wss://jetstream1.us-east.bsky.network/subscribe"
+func getenvFloat(key string, fallback float64) (float64, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return 0, err
+	}
+	if v == "" {
+		return fallback, nil
 	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
 
-	return &Config{
-		Hostname:     hostname,
-		Port:         port,
-		PublisherDID: publisherDID,
-		DatabasePath: dbPath,
-		FirehoseURL:  firehoseURL,
-	}, nil
+func getenvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, err := Getenv(key)
+	if err != nil {
+		return 0, err
+	}
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
 }
@@ -0,0 +1,73 @@
+package config
+
+// Features switches optional subsystems on or off in one place. Each flag is
+// read from FEEDGEN_ENABLE_<NAME>. Stats, PublicFeeds and Webhooks default to
+// off, since they serve unauthenticated database reads or run background
+// workers as soon as they are on; Admin and Trace default to on, since they
+// do nothing until FEEDGEN_ADMIN_TOKEN or FEEDGEN_TRACE is set. Turning one
+// off removes its routes and background work outright, whatever else is
+// configured.
+type Features struct {
+	// Stats serves /stats and /stats/feeds (FEEDGEN_ENABLE_STATS).
+	Stats bool
+
+	// Admin serves the /admin endpoints, which still require
+	// FEEDGEN_ADMIN_TOKEN (FEEDGEN_ENABLE_ADMIN).
+	Admin bool
+
+	// PublicFeeds serves the JSON Feed and RSS documents of Public feeds
+	// (FEEDGEN_ENABLE_PUBLIC_FEEDS).
+	PublicFeeds bool
+
+	// Webhooks delivers match notifications to feed WebhookURLs. When off,
+	// WebhookURLs are ignored and no delivery workers run
+	// (FEEDGEN_ENABLE_WEBHOOKS).
+	Webhooks bool
+
+	// Trace allows the matching trace, at startup with FEEDGEN_TRACE and at
+	// runtime through /admin/trace (FEEDGEN_ENABLE_TRACE).
+	Trace bool
+}
+
+// loadFeatures reads the FEEDGEN_ENABLE_* flags.
+func loadFeatures() (Features, error) {
+	var f Features
+	for _, flag := range []struct {
+		key      string
+		dst      *bool
+		fallback bool
+	}{
+		{"FEEDGEN_ENABLE_STATS", &f.Stats, false},
+		{"FEEDGEN_ENABLE_ADMIN", &f.Admin, true},
+		{"FEEDGEN_ENABLE_PUBLIC_FEEDS", &f.PublicFeeds, false},
+		{"FEEDGEN_ENABLE_WEBHOOKS", &f.Webhooks, false},
+		{"FEEDGEN_ENABLE_TRACE", &f.Trace, true},
+	} {
+		v, err := getenvBool(flag.key, flag.fallback)
+		if err != nil {
+			return Features{}, err
+		}
+		*flag.dst = v
+	}
+	return f, nil
+}
+
+// Enabled returns the names of the features that are on, for logging.
+func (f Features) Enabled() []string {
+	names := make([]string, 0, 5)
+	for _, feature := range []struct {
+		name string
+		on   bool
+	}{
+		{"stats", f.Stats},
+		{"admin", f.Admin},
+		{"public_feeds", f.PublicFeeds},
+		{"webhooks", f.Webhooks},
+		{"trace", f.Trace},
+	} {
+		if feature.on {
+			names = append(names, feature.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,427 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FeedBuilder assembles a FeedConfig step by step, checking each setting as
+// it is given. Calls that add to a list (WithKeywords, Langs, ...) append, so
+// they can be repeated. Once a setting is rejected, later calls are ignored
+// and Build reports the first error.
+//
+// The checks here are the ones that don't depend on ServiceOptions;
+// NewFeedService still validates the result in full.
+type FeedBuilder struct {
+	cfg FeedConfig
+	err error
+}
+
+// NewFeed starts a feed published by publisherDID under the record key rkey.
+func NewFeed(publisherDID, rkey string) *FeedBuilder {
+	b := &FeedBuilder{cfg: FeedConfig{URI: newFeedURI(publisherDID, rkey)}}
+	if !atURIPattern.MatchString(b.cfg.URI) {
+		b.err = fmt.Errorf("publisher DID %q and rkey %q do not make a valid AT-URI", publisherDID, rkey)
+	}
+	return b
+}
+
+// fail records err unless an earlier call already failed. It reports whether
+// the builder is still usable.
+func (b *FeedBuilder) fail(err error) bool {
+	if b.err == nil {
+		b.err = err
+	}
+	return false
+}
+
+// DisplayName sets the feed's human-readable name.
+func (b *FeedBuilder) DisplayName(name string) *FeedBuilder {
+	b.cfg.DisplayName = name
+	return b
+}
+
+// Description sets the description published with the feed.
+func (b *FeedBuilder) Description(description string) *FeedBuilder {
+	b.cfg.Description = description
+	return b
+}
+
+// Avatar sets the image file published as the feed's avatar.
+func (b *FeedBuilder) Avatar(path string) *FeedBuilder {
+	b.cfg.AvatarPath = path
+	return b
+}
+
+// WithKeywords adds terms matched against post text.
+func (b *FeedBuilder) WithKeywords(keywords ...string) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	cleaned, err := cleanKeywords(keywords)
+	if err != nil {
+		b.fail(fmt.Errorf("Keywords: %w", err))
+		return b
+	}
+	b.cfg.Keywords = append(b.cfg.Keywords, cleaned...)
+	return b
+}
+
+// KeywordAlias makes aliases match wherever keyword does.
+func (b *FeedBuilder) KeywordAlias(keyword string, aliases ...string) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if _, err := cleanKeywords(aliases); err != nil {
+		b.fail(fmt.Errorf("KeywordAliases %q: %w", keyword, err))
+		return b
+	}
+	if b.cfg.KeywordAliases == nil {
+		b.cfg.KeywordAliases = make(map[string][]string)
+	}
+	b.cfg.KeywordAliases[keyword] = append(b.cfg.KeywordAliases[keyword], aliases...)
+	return b
+}
+
+// MinKeywordHits requires at least n distinct keywords in a post.
+func (b *FeedBuilder) MinKeywordHits(n int) *FeedBuilder {
+	if b.err == nil && n < 0 {
+		b.fail(fmt.Errorf("MinKeywordHits must not be negative, got %d", n))
+	}
+	if b.err == nil {
+		b.cfg.MinKeywordHits = n
+	}
+	return b
+}
+
+// KeywordWeight sets how much keyword counts towards MinScore. The weight is
+// checked by Build.
+func (b *FeedBuilder) KeywordWeight(keyword string, weight float64) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.cfg.KeywordWeights == nil {
+		b.cfg.KeywordWeights = make(map[string]float64)
+	}
+	b.cfg.KeywordWeights[keyword] = weight
+	return b
+}
+
+// MinScore requires the weights of the distinct keywords in a post to add
+// up to at least score; a post scoring exactly score matches. The score is
+// checked by Build.
+func (b *FeedBuilder) MinScore(score float64) *FeedBuilder {
+	if b.err == nil {
+		b.cfg.MinScore = score
+	}
+	return b
+}
+
+// CaseSensitive matches keywords with exact case.
+func (b *FeedBuilder) CaseSensitive() *FeedBuilder {
+	b.cfg.CaseSensitive = true
+	return b
+}
+
+// Langs adds language codes posts must be tagged with.
+func (b *FeedBuilder) Langs(langs ...string) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	for _, lang := range langs {
+		if strings.TrimSpace(lang) == "" {
+			b.fail(errors.New("Langs: empty language code"))
+			return b
+		}
+	}
+	b.cfg.Langs = append(b.cfg.Langs, langs...)
+	return b
+}
+
+// LangDetection checks Langs against the detected language of the post text
+// as mode asks, accepting detections with at least minConfidence.
+func (b *FeedBuilder) LangDetection(mode LangDetectionMode, minConfidence float64) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if err := mode.validate(); err != nil {
+		b.fail(fmt.Errorf("LangDetection: %w", err))
+		return b
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		b.fail(fmt.Errorf("LangDetection: confidence must be between 0 and 1, got %v", minConfidence))
+		return b
+	}
+	b.cfg.LangDetection = mode
+	b.cfg.MinLangConfidence = minConfidence
+	return b
+}
+
+// MentionsAny adds accounts (DIDs) a post must mention.
+func (b *FeedBuilder) MentionsAny(dids ...string) *FeedBuilder {
+	if b.err != nil || !b.checkDIDs("MentionsAny", dids) {
+		return b
+	}
+	b.cfg.MentionsAny = append(b.cfg.MentionsAny, dids...)
+	return b
+}
+
+// ReplyRootAuthors adds accounts (DIDs) whose threads' replies are matched.
+func (b *FeedBuilder) ReplyRootAuthors(dids ...string) *FeedBuilder {
+	if b.err != nil || !b.checkDIDs("ReplyRootAuthors", dids) {
+		return b
+	}
+	b.cfg.ReplyRootAuthors = append(b.cfg.ReplyRootAuthors, dids...)
+	return b
+}
+
+// ReplyRootURIs adds posts (AT-URIs) whose threads' replies are matched.
+func (b *FeedBuilder) ReplyRootURIs(uris ...string) *FeedBuilder {
+	if b.err != nil || !b.checkURIs("ReplyRootURIs", uris) {
+		return b
+	}
+	b.cfg.ReplyRootURIs = append(b.cfg.ReplyRootURIs, uris...)
+	return b
+}
+
+// TimeWindow adds a UTC hour range posts must be created in.
+func (b *FeedBuilder) TimeWindow(start, end int) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	w := HourRange{Start: start, End: end}
+	if err := w.validate(); err != nil {
+		b.fail(fmt.Errorf("TimeWindows: %w", err))
+		return b
+	}
+	b.cfg.TimeWindows = append(b.cfg.TimeWindows, w)
+	return b
+}
+
+// FilterByAcceptLanguage serves requesters only posts in their languages.
+func (b *FeedBuilder) FilterByAcceptLanguage() *FeedBuilder {
+	b.cfg.FilterByAcceptLanguage = true
+	return b
+}
+
+// Pin adds posts (AT-URIs) shown at the top of the feed.
+func (b *FeedBuilder) Pin(uris ...string) *FeedBuilder {
+	if b.err != nil || !b.checkURIs("PinnedPosts", uris) {
+		return b
+	}
+	b.cfg.PinnedPosts = append(b.cfg.PinnedPosts, uris...)
+	return b
+}
+
+// Retention overrides the cleanup job's limits for the feed. Zero keeps the
+// global default.
+func (b *FeedBuilder) Retention(maxAge time.Duration, maxRows int) *FeedBuilder {
+	if b.err == nil && (maxAge < 0 || maxRows < 0) {
+		b.fail(errors.New("MaxAge and MaxRows must not be negative"))
+	}
+	if b.err == nil {
+		b.cfg.MaxAge, b.cfg.MaxRows = maxAge, maxRows
+	}
+	return b
+}
+
+// MaxCursorAge caps how far back the feed can be paged.
+func (b *FeedBuilder) MaxCursorAge(d time.Duration) *FeedBuilder {
+	if b.err == nil && d < 0 {
+		b.fail(errors.New("MaxCursorAge must not be negative"))
+	}
+	if b.err == nil {
+		b.cfg.MaxCursorAge = d
+	}
+	return b
+}
+
+// Links bounds the number of distinct links a post may contain. Zero means
+// no bound.
+func (b *FeedBuilder) Links(minLinks, maxLinks int) *FeedBuilder {
+	if b.err == nil && (minLinks < 0 || maxLinks < 0) {
+		b.fail(errors.New("MinLinks and MaxLinks must not be negative"))
+	}
+	if b.err == nil && maxLinks > 0 && minLinks > maxLinks {
+		b.fail(fmt.Errorf("MinLinks (%d) exceeds MaxLinks (%d)", minLinks, maxLinks))
+	}
+	if b.err == nil {
+		b.cfg.MinLinks, b.cfg.MaxLinks = minLinks, maxLinks
+	}
+	return b
+}
+
+// BlockDomains adds hosts posts must not link to.
+func (b *FeedBuilder) BlockDomains(domains ...string) *FeedBuilder {
+	if b.err == nil {
+		b.cfg.BlockedDomains = append(b.cfg.BlockedDomains, domains...)
+	}
+	return b
+}
+
+// MatchQuotedText also matches keywords against the text of quoted posts.
+func (b *FeedBuilder) MatchQuotedText() *FeedBuilder {
+	b.cfg.MatchQuotedText = true
+	return b
+}
+
+// Quotes excludes quote posts, or takes only them.
+func (b *FeedBuilder) Quotes(q QuoteFilter) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if err := q.validate(); err != nil {
+		b.fail(fmt.Errorf("Quotes: %w", err))
+		return b
+	}
+	b.cfg.Quotes = q
+	return b
+}
+
+// OriginalOnly restricts the feed to top-level posts that are neither
+// replies nor quotes.
+func (b *FeedBuilder) OriginalOnly() *FeedBuilder {
+	b.cfg.OriginalOnly = true
+	return b
+}
+
+// RefreshOnEdit moves edited posts that match to the top of the feed.
+func (b *FeedBuilder) RefreshOnEdit() *FeedBuilder {
+	b.cfg.RefreshOnEdit = true
+	return b
+}
+
+// RequireAll adds a group every matching post must satisfy.
+func (b *FeedBuilder) RequireAll(g MatchGroup) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(g.Keywords) == 0 && len(g.Hashtags) == 0 {
+		b.fail(fmt.Errorf("RequireAll group %d is empty", len(b.cfg.RequireAll)))
+		return b
+	}
+	if len(g.Keywords) > 0 {
+		if _, err := cleanKeywords(g.Keywords); err != nil {
+			b.fail(fmt.Errorf("RequireAll group %d: %w", len(b.cfg.RequireAll), err))
+			return b
+		}
+	}
+	b.cfg.RequireAll = append(b.cfg.RequireAll, g)
+	return b
+}
+
+// SampleRate keeps only this fraction of matching posts.
+func (b *FeedBuilder) SampleRate(rate float64) *FeedBuilder {
+	if b.err == nil && (rate < 0 || rate > 1) {
+		b.fail(fmt.Errorf("SampleRate must be between 0 and 1, got %g", rate))
+	}
+	if b.err == nil {
+		b.cfg.SampleRate = rate
+	}
+	return b
+}
+
+// MinAuthorFollowers rejects posts from authors with fewer followers.
+func (b *FeedBuilder) MinAuthorFollowers(n int) *FeedBuilder {
+	if b.err == nil && n < 0 {
+		b.fail(errors.New("MinAuthorFollowers must not be negative"))
+	}
+	if b.err == nil {
+		b.cfg.MinAuthorFollowers = n
+	}
+	return b
+}
+
+// ResumeFromLastSeen continues identified requesters from where they were.
+func (b *FeedBuilder) ResumeFromLastSeen() *FeedBuilder {
+	b.cfg.ResumeFromLastSeen = true
+	return b
+}
+
+// Webhook posts every saved match to rawURL.
+func (b *FeedBuilder) Webhook(rawURL string) *FeedBuilder {
+	if b.err != nil {
+		return b
+	}
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		b.fail(fmt.Errorf("WebhookURL %q is not an http or https URL", rawURL))
+		return b
+	}
+	b.cfg.WebhookURL = rawURL
+	return b
+}
+
+// Public also serves the feed as JSON Feed and RSS.
+func (b *FeedBuilder) Public() *FeedBuilder {
+	b.cfg.Public = true
+	return b
+}
+
+// Reposters adds accounts (DIDs) whose reposts are added to the feed.
+func (b *FeedBuilder) Reposters(dids ...string) *FeedBuilder {
+	if b.err != nil || !b.checkDIDs("Reposters", dids) {
+		return b
+	}
+	b.cfg.Reposters = append(b.cfg.Reposters, dids...)
+	return b
+}
+
+// Matcher sets the custom match hook.
+func (b *FeedBuilder) Matcher(fn MatchFunc) *FeedBuilder {
+	b.cfg.Matcher = fn
+	return b
+}
+
+// Build returns the assembled config, or the first error met while building
+// it. It also checks the feed has something to match on.
+func (b *FeedBuilder) Build() (FeedConfig, error) {
+	if b.err != nil {
+		return FeedConfig{}, fmt.Errorf("feed %s: %w", b.cfg.URI, b.err)
+	}
+	cfg := b.cfg
+	cfg.KeywordAliases = maps.Clone(cfg.KeywordAliases)
+	cfg.KeywordWeights = maps.Clone(cfg.KeywordWeights)
+	if len(cfg.Keywords) == 0 && len(cfg.RequireAll) == 0 && len(cfg.MentionsAny) == 0 && len(cfg.Reposters) == 0 &&
+		len(cfg.ReplyRootAuthors) == 0 && len(cfg.ReplyRootURIs) == 0 {
+		return FeedConfig{}, fmt.Errorf("feed %s: at least one keyword, RequireAll group, mention, reposter, or reply root is required", cfg.URI)
+	}
+	if cfg.MinKeywordHits > max(len(cfg.Keywords), 1) {
+		return FeedConfig{}, fmt.Errorf("feed %s: MinKeywordHits must be between 0 and the number of Keywords (%d), got %d", cfg.URI, len(cfg.Keywords), cfg.MinKeywordHits)
+	}
+	if err := validateWeights(cfg); err != nil {
+		return FeedConfig{}, fmt.Errorf("feed %s: %w", cfg.URI, err)
+	}
+	return cfg, nil
+}
+
+// MustBuild is like Build but panics on error. It is meant for feeds defined
+// in code, where a bad config is a programming error.
+func (b *FeedBuilder) MustBuild() FeedConfig {
+	cfg, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func (b *FeedBuilder) checkDIDs(field string, dids []string) bool {
+	for _, did := range dids {
+		if !strings.HasPrefix(did, "did:") {
+			return b.fail(fmt.Errorf("%s entry %q is not a DID", field, did))
+		}
+	}
+	return true
+}
+
+func (b *FeedBuilder) checkURIs(field string, uris []string) bool {
+	for _, uri := range uris {
+		if !atURIPattern.MatchString(uri) {
+			return b.fail(fmt.Errorf("%s entry %q is not a valid AT-URI", field, uri))
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCache is a bounded map whose entries expire after a fixed TTL. When
+// full, the oldest entry is evicted. It is safe for concurrent use.
+type ttlCache[V any] struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *cacheEntry[V], oldest first
+	entries map[string]*list.Element
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	addedAt time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration, size int) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value stored for key, if it was added within the TTL.
+func (c *ttlCache[V]) get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*cacheEntry[V])
+	if now.Sub(e.addedAt) > c.ttl {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// put stores value for key as of now, evicting the oldest entries if the
+// cache is over its size.
+func (c *ttlCache[V]) put(key string, value V, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushBack(&cacheEntry[V]{key: key, value: value, addedAt: now})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).key)
+	}
+}
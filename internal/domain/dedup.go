@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// recentURIs is a bounded, time-windowed set of recently saved post URIs,
+// used to skip duplicate create events (e.g. replayed around a reconnect)
+// before they reach the repository. When full, the oldest entry is evicted.
+type recentURIs struct {
+	window time.Duration
+	size   int
+
+	mu      sync.Mutex
+	order   *list.List // of recentEntry, oldest first
+	entries map[string]*list.Element
+}
+
+type recentEntry struct {
+	uri    string
+	seenAt time.Time
+}
+
+func newRecentURIs(window time.Duration, size int) *recentURIs {
+	return &recentURIs{
+		window:  window,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// contains reports whether uri was added within the window.
+func (r *recentURIs) contains(uri string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	el, ok := r.entries[uri]
+	if !ok {
+		return false
+	}
+	if now.Sub(el.Value.(recentEntry).seenAt) > r.window {
+		r.order.Remove(el)
+		delete(r.entries, uri)
+		return false
+	}
+	return true
+}
+
+// add records uri as seen at now.
+func (r *recentURIs) add(uri string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.entries[uri]; ok {
+		r.order.Remove(el)
+	}
+	r.entries[uri] = r.order.PushBack(recentEntry{uri: uri, seenAt: now})
+
+	for r.order.Len() > r.size {
+		oldest := r.order.Front()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(recentEntry).uri)
+	}
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pageDepthBounds are the upper bounds, in hours of cursor age, of the
+// pagination depth buckets. Deeper requests fall in a final open bucket.
+var pageDepthBounds = []int{1, 2, 4, 8, 12, 24, 48, 168}
+
+// DepthBucket counts the getFeedSkeleton requests whose cursor was at a given
+// depth: first pages, cursors younger than a number of hours, or older than
+// the last bound.
+type DepthBucket struct {
+	Depth    string `json:"depth"` // "first_page", "<1h", ..., ">=168h"
+	Requests int64  `json:"requests"`
+}
+
+// pageDepths counts getFeedSkeleton requests per feed by how far back their
+// cursor points, measured as the cursor's age. Counts run from startup. It
+// is safe for concurrent use.
+type pageDepths struct {
+	mu     sync.Mutex
+	counts map[string][]int64 // feed URI -> first page, one per bound, overflow
+}
+
+func newPageDepths() *pageDepths {
+	return &pageDepths{counts: make(map[string][]int64)}
+}
+
+// record counts a request for feedURI with cursor at now. Cursors without a
+// readable timestamp aren't counted.
+func (d *pageDepths) record(feedURI, cursor string, now time.Time) {
+	bucket := 0
+	if cursor != "" {
+		at, ok := cursorTime(cursor)
+		if !ok {
+			return
+		}
+		bucket = len(pageDepthBounds) + 1
+		for i, hours := range pageDepthBounds {
+			if now.Sub(at) < time.Duration(hours)*time.Hour {
+				bucket = i + 1
+				break
+			}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := d.counts[feedURI]
+	if counts == nil {
+		counts = make([]int64, len(pageDepthBounds)+2)
+		d.counts[feedURI] = counts
+	}
+	counts[bucket]++
+}
+
+// snapshot returns the counts for feedURI, one entry per bucket.
+func (d *pageDepths) snapshot(feedURI string) []DepthBucket {
+	counts := make([]int64, len(pageDepthBounds)+2)
+	d.mu.Lock()
+	copy(counts, d.counts[feedURI])
+	d.mu.Unlock()
+
+	buckets := make([]DepthBucket, 0, len(counts))
+	buckets = append(buckets, DepthBucket{Depth: "first_page", Requests: counts[0]})
+	for i, hours := range pageDepthBounds {
+		buckets = append(buckets, DepthBucket{Depth: fmt.Sprintf("<%dh", hours), Requests: counts[i+1]})
+	}
+	last := pageDepthBounds[len(pageDepthBounds)-1]
+	buckets = append(buckets, DepthBucket{Depth: fmt.Sprintf(">=%dh", last), Requests: counts[len(counts)-1]})
+	return buckets
+}
+
+// PageDepths returns, for each feed, how many getFeedSkeleton requests
+// arrived at each pagination depth since startup.
+func (s *FeedService) PageDepths() map[string][]DepthBucket {
+	depths := make(map[string][]DepthBucket, len(s.feeds))
+	for uri := range s.feeds {
+		depths[uri] = s.depths.snapshot(uri)
+	}
+	return depths
+}
+
+// topCursor returns a cursor that starts a page at the newest post indexed by
+// now, for continuing after a first page that held only pinned posts. It has
+// the millisecond prefix every PostRepository cursor starts with and sorts
+// after every post at or before now.
+func topCursor(now time.Time) string {
+	return strconv.FormatInt(now.UnixMilli()+1, 10) + "::"
+}
+
+// cursorTime returns the time a feed cursor points at: the index time of the
+// last post on the previous page, which every PostRepository cursor starts
+// with in milliseconds.
+func cursorTime(cursor string) (time.Time, bool) {
+	millis, _, ok := strings.Cut(cursor, "::")
+	if !ok {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(n), true
+}
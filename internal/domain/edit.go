@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// WantsEdits reports whether any feed has RefreshOnEdit, i.e. whether post
+// update events need to be processed at all.
+func (s *FeedService) WantsEdits() bool {
+	for _, f := range s.feeds {
+		if f.refresh {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcessUpdatedPost checks an edited post against the feeds with
+// RefreshOnEdit and upserts it into those it matches, so it surfaces at the
+// top with its new text. It is removed from the other RefreshOnEdit feeds,
+// so an edit can take a post out of a feed it no longer belongs in. Feeds
+// without RefreshOnEdit ignore edits. Returns the URIs of the feeds the post
+// was written to.
+//
+// Edits don't trigger webhooks or OnMatch, and a failed write isn't
+// buffered for retry.
+func (s *FeedService) ProcessUpdatedPost(ctx context.Context, incoming *IncomingPost) ([]string, error) {
+	if !s.WantsEdits() {
+		return nil, nil
+	}
+	matched := s.matchingFeeds(incoming)
+	if s.wantsQuotedText(incoming, matched) {
+		matched = s.matchWithQuotedText(ctx, incoming, matched)
+	}
+
+	var feedURIs []string
+	for _, uri := range matched {
+		if s.feeds[uri].refresh {
+			feedURIs = append(feedURIs, uri)
+		}
+	}
+	feedURIs = s.filterByFollowers(ctx, incoming.AuthorDID, feedURIs)
+
+	var stale []string
+	for uri, f := range s.feeds {
+		if f.refresh && !slices.Contains(feedURIs, uri) {
+			stale = append(stale, uri)
+		}
+	}
+	if len(stale) > 0 {
+		removed, err := s.opts.PostUpserts.RemovePost(ctx, incoming.URI, stale)
+		if err != nil {
+			return nil, fmt.Errorf("%w: remove edited post: %w", ErrWriteFailed, err)
+		}
+		if removed > 0 {
+			s.logger.Debug("edited post removed", "uri", incoming.URI, "feeds", removed)
+		}
+	}
+	if len(feedURIs) == 0 {
+		return nil, nil
+	}
+
+	if tombstoned, err := s.isTombstoned(ctx, incoming.URI); err != nil || tombstoned {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	post := &Post{
+		URI:       incoming.URI,
+		CID:       incoming.CID,
+		IndexedAt: now,
+		AuthorDID: incoming.AuthorDID,
+		Text:      incoming.Text,
+		Langs:     NormalizeLangs(incoming.Langs),
+
+		MatchedKeywords: s.matchedKeywords(incoming, feedURIs),
+	}
+	result, err := s.opts.PostUpserts.UpsertPost(ctx, post, feedURIs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: upsert post: %w", ErrWriteFailed, err)
+	}
+	s.markMatched(feedURIs, now)
+	s.logger.Debug("edited post written", "uri", incoming.URI, "inserted", result.Inserted, "updated", result.Updated)
+	return feedURIs, nil
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestProcessUpdatedPostRemovesStaleMatches(t *testing.T) {
+	repo := newMemRepo()
+	golang, rust, static := testFeed("golang"), testFeed("rust"), testFeed("static")
+	s, err := NewFeedService([]FeedConfig{
+		{URI: golang, Keywords: []string{"golang"}, RefreshOnEdit: true},
+		{URI: rust, Keywords: []string{"rust"}, RefreshOnEdit: true},
+		{URI: static, Keywords: []string{"golang"}},
+	}, repo, repo, ServiceOptions{PostUpserts: repo}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const uri = "at://did:plc:author/app.bsky.feed.post/1"
+
+	post := &IncomingPost{URI: uri, AuthorDID: "did:plc:author", Text: "learning golang"}
+	if _, err := s.ProcessNewPost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := &IncomingPost{URI: uri, AuthorDID: "did:plc:author", Text: "learning rust"}
+	written, err := s.ProcessUpdatedPost(ctx, edit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0] != rust {
+		t.Errorf("ProcessUpdatedPost() = %q, want [%q]", written, rust)
+	}
+
+	for _, tt := range []struct {
+		feed string
+		want int
+	}{
+		{golang, 0}, // RefreshOnEdit: the edit no longer matches
+		{rust, 1},   // RefreshOnEdit: the edit now matches
+		{static, 1}, // edits are ignored
+	} {
+		if got := len(repo.posts[tt.feed]); got != tt.want {
+			t.Errorf("%s has %d posts, want %d", tt.feed, got, tt.want)
+		}
+	}
+}
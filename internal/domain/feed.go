@@ -10,6 +10,26 @@ type FeedSkeleton struct {
 type SkeletonPost struct {
 	// Post is the AT-URI of the post.
 	Post string
+
+	// Reason explains why the post is in the feed, or nil for posts that
+	// matched on their own content.
+	Reason *SkeletonReason
+}
+
+// Skeleton reason types, from the app.bsky.feed.defs lexicon.
+const (
+	ReasonRepost = "app.bsky.feed.defs#skeletonReasonRepost"
+	ReasonPin    = "app.bsky.feed.defs#skeletonReasonPin"
+)
+
+// SkeletonReason attributes a skeleton entry, e.g. to the repost that
+// brought it into the feed.
+type SkeletonReason struct {
+	// Type is ReasonRepost or ReasonPin.
+	Type string
+
+	// Repost is the AT-URI of the repost record, for ReasonRepost.
+	Repost string
 }
 
 // FeedDescription describes a single feed served by this generator.
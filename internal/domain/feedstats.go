@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FeedStat summarizes one feed for dashboards.
+type FeedStat struct {
+	DisplayName string `json:"display_name,omitempty"`
+
+	// Posts is the number of posts currently indexed for the feed, as of
+	// CountedAt.
+	Posts     int64     `json:"posts"`
+	CountedAt time.Time `json:"counted_at"`
+
+	// LastMatchedAt is when a post was last saved to the feed, or nil if
+	// none has been since startup.
+	LastMatchedAt *time.Time `json:"last_matched_at"`
+}
+
+// feedStatsCache holds the most recent post counts so that frequent scrapes
+// don't each run a count query per feed.
+type feedStatsCache struct {
+	mu     sync.Mutex
+	at     time.Time
+	counts map[string]int64
+}
+
+// markMatched records that a post indexed at t was saved to feedURIs.
+func (s *FeedService) markMatched(feedURIs []string, t time.Time) {
+	for _, uri := range feedURIs {
+		if f, ok := s.feeds[uri]; ok {
+			f.lastMatch.Store(t.UnixNano())
+		}
+	}
+}
+
+// FeedStats returns every feed's indexed post count and last match time,
+// keyed by feed URI. Counts come from ServiceOptions.PostCounts and are
+// reused for FeedStatsTTL; last match times are always current.
+func (s *FeedService) FeedStats(ctx context.Context) (map[string]FeedStat, error) {
+	if s.opts.PostCounts == nil {
+		return nil, errors.New("feed stats require a PostCounts counter")
+	}
+
+	counts, countedAt, err := s.postCounts(ctx, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]FeedStat, len(s.feeds))
+	for uri, f := range s.feeds {
+		stat := FeedStat{DisplayName: f.name, Posts: counts[uri], CountedAt: countedAt}
+		if n := f.lastMatch.Load(); n != 0 {
+			t := time.Unix(0, n).UTC()
+			stat.LastMatchedAt = &t
+		}
+		stats[uri] = stat
+	}
+	return stats, nil
+}
+
+// postCounts returns the cached counts if they are younger than FeedStatsTTL
+// at now, counting afresh otherwise. Concurrent callers wait for a single
+// refresh rather than each running the queries.
+func (s *FeedService) postCounts(ctx context.Context, now time.Time) (map[string]int64, time.Time, error) {
+	c := &s.feedStats
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts != nil && now.Sub(c.at) < s.opts.FeedStatsTTL {
+		return c.counts, c.at, nil
+	}
+
+	counts := make(map[string]int64, len(s.feeds))
+	for uri := range s.feeds {
+		n, err := s.opts.PostCounts.CountPosts(ctx, uri)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("count posts for %s: %w", uri, err)
+		}
+		counts[uri] = n
+	}
+	c.counts, c.at = counts, now
+	return counts, now, nil
+}
+
+// EmptyFeeds returns the URIs of the feeds with no posts indexed yet, such
+// as a feed that was just published, sorted. Those feeds are still served,
+// as empty pages, until their first match arrives. Counts come from
+// ServiceOptions.PostCounts, as for FeedStats.
+func (s *FeedService) EmptyFeeds(ctx context.Context) ([]string, error) {
+	if s.opts.PostCounts == nil {
+		return nil, errors.New("empty feed check requires a PostCounts counter")
+	}
+	counts, _, err := s.postCounts(ctx, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	var empty []string
+	for uri := range s.feeds {
+		if counts[uri] == 0 {
+			empty = append(empty, uri)
+		}
+	}
+	slices.Sort(empty)
+	return empty, nil
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// followersCacheTTL and followersCacheSize bound the cache of author
+	// follower counts. Counts change slowly, so a long TTL is fine.
+	followersCacheTTL  = 6 * time.Hour
+	followersCacheSize = 50000
+
+	// followersLookupTimeout bounds a single profile lookup.
+	followersLookupTimeout = 5 * time.Second
+
+	// maxFollowersLookups caps concurrent profile lookups. Authors seen
+	// while every slot is busy are let through and looked up the next time
+	// they post.
+	maxFollowersLookups = 8
+)
+
+// followersCache holds author follower counts and resolves missing ones in
+// the background, so the firehose never waits on a profile lookup.
+type followersCache struct {
+	resolver FollowersResolver
+	counts   *ttlCache[int]
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]struct{} // DIDs being looked up
+}
+
+func newFollowersCache(resolver FollowersResolver) *followersCache {
+	return &followersCache{
+		resolver: resolver,
+		counts:   newTTLCache[int](followersCacheTTL, followersCacheSize),
+		slots:    make(chan struct{}, maxFollowersLookups),
+		inflight: make(map[string]struct{}),
+	}
+}
+
+// filterByFollowers drops the feeds in feedURIs whose MinAuthorFollowers the
+// author is known not to meet. An author whose follower count isn't cached
+// yet meets all of them, failing open so a real match is never lost; their
+// count is looked up in the background for next time.
+func (s *FeedService) filterByFollowers(ctx context.Context, authorDID string, feedURIs []string) []string {
+	if s.followers == nil {
+		return feedURIs
+	}
+
+	count, known := -1, false
+	var kept []string
+	for _, uri := range feedURIs {
+		threshold := s.feeds[uri].minFollowers
+		if threshold > 0 {
+			if count < 0 {
+				count, known = s.followers.counts.get(authorDID, time.Now())
+				if !known {
+					s.lookupFollowers(ctx, authorDID)
+				}
+			}
+			if known && count < threshold {
+				continue
+			}
+		}
+		kept = append(kept, uri)
+	}
+	return kept
+}
+
+// lookupFollowers starts a background lookup of did's follower count unless
+// one is already running or every lookup slot is busy.
+func (s *FeedService) lookupFollowers(ctx context.Context, did string) {
+	c := s.followers
+
+	c.mu.Lock()
+	if _, ok := c.inflight[did]; ok {
+		c.mu.Unlock()
+		return
+	}
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[did] = struct{}{}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), followersLookupTimeout)
+	go func() {
+		defer func() {
+			cancel()
+			c.mu.Lock()
+			delete(c.inflight, did)
+			c.mu.Unlock()
+			<-c.slots
+		}()
+
+		count, err := c.resolver.GetFollowersCount(ctx, did)
+		if err != nil {
+			s.logger.Warn("failed to look up author followers", "did", did, "error", err)
+			return
+		}
+		c.counts.put(did, count, time.Now())
+	}()
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeFollowers is a FollowersResolver over a fixed map that signals each
+// completed lookup on done.
+type fakeFollowers struct {
+	counts map[string]int
+	done   chan string
+}
+
+func (f *fakeFollowers) GetFollowersCount(_ context.Context, did string) (int, error) {
+	defer func() { f.done <- did }()
+	return f.counts[did], nil
+}
+
+func TestMinAuthorFollowers(t *testing.T) {
+	tests := []struct {
+		name      string
+		followers int
+		wantCold  bool // matched while the count isn't cached yet
+		wantWarm  bool // matched once the count is cached
+	}{
+		{"above threshold", 500, true, true},
+		{"at threshold", 100, true, true},
+		{"below threshold", 10, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const author = "did:plc:author"
+			resolver := &fakeFollowers{counts: map[string]int{author: tt.followers}, done: make(chan string, 1)}
+			repo := newMemRepo()
+			s, err := NewFeedService([]FeedConfig{
+				{URI: testFeed("popular"), Keywords: []string{"golang"}, MinAuthorFollowers: 100},
+			}, repo, repo, ServiceOptions{AuthorFollowers: resolver}, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatal(err)
+			}
+			process := func(rkey string) bool {
+				t.Helper()
+				post := IncomingPost{URI: "at://" + author + "/app.bsky.feed.post/" + rkey, AuthorDID: author, Text: "golang tip"}
+				saved, err := s.ProcessNewPost(context.Background(), &post)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return len(saved) > 0
+			}
+
+			if got := process("cold"); got != tt.wantCold {
+				t.Errorf("cold cache: matched = %t, want %t", got, tt.wantCold)
+			}
+			select {
+			case <-resolver.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("follower count was never looked up")
+			}
+			// The count is cached just after the resolver returns.
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+				if _, ok := s.followers.counts.get(author, time.Now()); ok {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("follower count was never cached")
+				}
+			}
+			if got := process("warm"); got != tt.wantWarm {
+				t.Errorf("warm cache: matched = %t, want %t", got, tt.wantWarm)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package domain
+
+// keywordIndex narrows the set of feeds that need a full match check for a
+// post. Running every feed's keyword regex against every firehose post is
+// O(feeds) regex scans per post, while nearly all posts match nothing.
+//
+// A keyword can only match (with the word-bounded pattern built by
+// compileKeywords) where the post text contains the keyword's first word as
+// a whole token, so the index maps each keyword's first token to the feeds
+// using it. Tokens follow regexp's \b rules: runs of ASCII letters, digits,
+// and underscores, compared case-insensitively. Case-sensitive feeds are
+// indexed the same way; the lookup is then a superset and the full pattern
+// check decides.
+type keywordIndex struct {
+	byToken map[string][]*feed
+
+	// always holds feeds that can't be ruled out by token lookup: feeds with
+	// no top-level keywords, a custom Matcher, or a keyword that doesn't
+	// start with a word character.
+	always []*feed
+}
+
+func newKeywordIndex(feeds map[string]*feed) *keywordIndex {
+	idx := &keywordIndex{byToken: make(map[string][]*feed)}
+
+	for _, f := range feeds {
+		if !f.hasTextRules() && f.matcher == nil {
+			continue // only fed by reposts
+		}
+		if f.pattern == nil || f.matcher != nil {
+			idx.always = append(idx.always, f)
+			continue
+		}
+
+		tokens := make(map[string]struct{}, len(f.keywords))
+		indexable := true
+		for _, kw := range f.keywords {
+			tok := firstToken(kw)
+			if tok == "" {
+				indexable = false
+				break
+			}
+			tokens[tok] = struct{}{}
+		}
+		if !indexable {
+			idx.always = append(idx.always, f)
+			continue
+		}
+		for tok := range tokens {
+			idx.byToken[tok] = append(idx.byToken[tok], f)
+		}
+	}
+
+	return idx
+}
+
+// candidates returns the feeds that might match text, without duplicates.
+func (idx *keywordIndex) candidates(text string) []*feed {
+	result := append([]*feed(nil), idx.always...)
+	if len(idx.byToken) == 0 {
+		return result
+	}
+
+	var buf [64]byte
+	tok := buf[:0]
+	flush := func() {
+		if len(tok) == 0 {
+			return
+		}
+		for _, f := range idx.byToken[string(tok)] {
+			if !containsFeed(result, f) {
+				result = append(result, f)
+			}
+		}
+		tok = tok[:0]
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if !isWordByte(c) {
+			flush()
+			continue
+		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		tok = append(tok, c)
+	}
+	flush()
+
+	return result
+}
+
+// firstToken returns the lowercased leading word token of keyword, or "" if
+// the keyword doesn't start with a word character.
+func firstToken(keyword string) string {
+	end := 0
+	for end < len(keyword) && isWordByte(keyword[end]) {
+		end++
+	}
+	tok := []byte(keyword[:end])
+	for i, c := range tok {
+		if 'A' <= c && c <= 'Z' {
+			tok[i] = c + 'a' - 'A'
+		}
+	}
+	return string(tok)
+}
+
+// isWordByte reports whether c is a word character as defined by regexp's \b.
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+func containsFeed(feeds []*feed, f *feed) bool {
+	for _, g := range feeds {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+// BenchmarkMatchingFeeds compares finding the feeds a post matches through
+// the keywordIndex with running every feed's rules against it.
+func BenchmarkMatchingFeeds(b *testing.B) {
+	post := &IncomingPost{
+		URI:   "at://did:plc:author/app.bsky.feed.post/1",
+		Text:  "Spent the afternoon benchmarking topic7 against a few other options; the results were closer than I expected, and the write-up is coming soon.",
+		Langs: []string{"en"},
+	}
+	for _, n := range []int{10, 50, 200} {
+		configs := make([]FeedConfig, n)
+		for i := range configs {
+			configs[i] = FeedConfig{
+				URI:      testFeed(fmt.Sprintf("feed%d", i)),
+				Keywords: []string{fmt.Sprintf("topic%d", i), fmt.Sprintf("subject %d", i), fmt.Sprintf("theme%d-x", i)},
+				Langs:    []string{"en"},
+			}
+		}
+		repo := newMemRepo()
+		s, err := NewFeedService(configs, repo, repo, ServiceOptions{}, slog.New(slog.DiscardHandler))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("feeds=%d/index", n), func(b *testing.B) {
+			for b.Loop() {
+				if len(s.matchingFeeds(post)) != 1 {
+					b.Fatal("expected one match")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("feeds=%d/scan", n), func(b *testing.B) {
+			for b.Loop() {
+				var matched []string
+				for _, f := range s.feeds {
+					if matchesFeed(f, post) {
+						matched = append(matched, f.uri)
+					}
+				}
+				if len(matched) != 1 {
+					b.Fatal("expected one match")
+				}
+			}
+		})
+	}
+}
+
+func TestKeywordIndexCandidates(t *testing.T) {
+	s := newTestService(t,
+		FeedConfig{URI: testFeed("go"), Keywords: []string{"golang", "go 1.26"}},
+		FeedConfig{URI: testFeed("rust"), Keywords: []string{"Rust"}},
+		FeedConfig{URI: testFeed("cpp"), Keywords: []string{"++c"}},
+	)
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"GOLANG news", []string{testFeed("go"), testFeed("cpp")}},
+		{"go 1.26 is out", []string{testFeed("go"), testFeed("cpp")}},
+		{"rust and golang", []string{testFeed("go"), testFeed("rust"), testFeed("cpp")}},
+		{"nothing here", []string{testFeed("cpp")}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range s.index.candidates(tt.text) {
+			got = append(got, f.uri)
+		}
+		for _, uri := range tt.want {
+			if !slices.Contains(got, uri) {
+				t.Errorf("candidates(%q) = %q, missing %s", tt.text, got, uri)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("candidates(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keywordStatsBuckets is the number of buckets a keyword stats window is
+// split into. Counts age out one bucket at a time.
+const keywordStatsBuckets = 24
+
+// KeywordCount is the number of posts one keyword matched within the stats
+// window.
+type KeywordCount struct {
+	Keyword string `json:"keyword"`
+	Matches int64  `json:"matches"`
+}
+
+// KeywordStats reports per-keyword match counts for each feed over a rolling
+// window. Keywords that matched nothing are included with a zero count.
+type KeywordStats struct {
+	Window time.Duration
+	Feeds  map[string][]KeywordCount // keyed by feed URI, busiest keyword first
+}
+
+// keywordStats counts which top-level keyword matched each post, in
+// time buckets covering a rolling window. It is safe for concurrent use.
+type keywordStats struct {
+	width time.Duration // of each bucket
+
+	mu      sync.Mutex
+	buckets [keywordStatsBuckets]keywordBucket
+}
+
+type keywordBucket struct {
+	start  time.Time
+	counts map[string]map[string]int64 // feed URI -> keyword -> matches
+}
+
+func newKeywordStats(window time.Duration) *keywordStats {
+	return &keywordStats{width: window / keywordStatsBuckets}
+}
+
+// record counts one match of keyword for feedURI at now.
+func (k *keywordStats) record(feedURI, keyword string, now time.Time) {
+	start := now.Truncate(k.width)
+	idx := int(start.UnixNano()/int64(k.width)) % keywordStatsBuckets
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	b := &k.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = keywordBucket{start: start, counts: make(map[string]map[string]int64)}
+	}
+	if b.counts[feedURI] == nil {
+		b.counts[feedURI] = make(map[string]int64)
+	}
+	b.counts[feedURI][keyword]++
+}
+
+// totals sums the buckets still inside the window as of now.
+func (k *keywordStats) totals(now time.Time) map[string]map[string]int64 {
+	oldest := now.Truncate(k.width).Add(-k.width * (keywordStatsBuckets - 1))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	totals := make(map[string]map[string]int64)
+	for _, b := range k.buckets {
+		if b.start.Before(oldest) {
+			continue
+		}
+		for feedURI, counts := range b.counts {
+			if totals[feedURI] == nil {
+				totals[feedURI] = make(map[string]int64)
+			}
+			for kw, n := range counts {
+				totals[feedURI][kw] += n
+			}
+		}
+	}
+	return totals
+}
+
+// KeywordStats returns per-keyword match counts for every feed with
+// top-level keywords. It returns false if keyword stats are disabled.
+func (s *FeedService) KeywordStats() (KeywordStats, bool) {
+	if s.keywordStats == nil {
+		return KeywordStats{}, false
+	}
+
+	totals := s.keywordStats.totals(time.Now())
+	stats := KeywordStats{
+		Window: s.opts.KeywordStatsWindow,
+		Feeds:  make(map[string][]KeywordCount),
+	}
+	for uri, f := range s.feeds {
+		if len(f.keywords) == 0 {
+			continue
+		}
+		counts := make([]KeywordCount, len(f.keywords))
+		for i, kw := range f.keywords {
+			counts[i] = KeywordCount{Keyword: kw, Matches: totals[uri][kw]}
+		}
+		slices.SortStableFunc(counts, func(a, b KeywordCount) int {
+			return cmp.Compare(b.Matches, a.Matches)
+		})
+		stats.Feeds[uri] = counts
+	}
+	return stats, true
+}
+
+// recordKeywords attributes each match to the configured keyword it hit.
+// Matches on RequireAll or a Matcher alone aren't counted.
+func (s *FeedService) recordKeywords(matches []Match, now time.Time) {
+	for _, m := range matches {
+		if kw := s.feeds[m.FeedURI].configuredKeyword(m.Keyword); kw != "" {
+			s.keywordStats.record(m.FeedURI, kw, now)
+		}
+	}
+}
+
+// configuredKeyword maps keyword text found in a post back to the entry in
+// the feed's keyword list it matched, or "" if there is none.
+func (f *feed) configuredKeyword(found string) string {
+	if found == "" {
+		return ""
+	}
+	if slices.Contains(f.keywords, found) {
+		return found
+	}
+	for _, kw := range f.keywords {
+		if strings.EqualFold(kw, found) {
+			return kw
+		}
+	}
+	return ""
+}
+
+// matchedKeywords returns the distinct top-level keywords, as configured,
+// found in the text the feed matches incoming against, in order of first
+// appearance.
+func (f *feed) matchedKeywords(incoming *IncomingPost) []string {
+	if f.pattern == nil {
+		return nil
+	}
+	var keywords []string
+	for _, found := range f.pattern.FindAllString(f.searchText(incoming), -1) {
+		if kw := f.configuredKeyword(found); kw != "" && !slices.Contains(keywords, kw) {
+			keywords = append(keywords, kw)
+		}
+	}
+	return keywords
+}
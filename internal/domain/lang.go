@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LangDetectionMode selects how a feed's Langs are checked: against the
+// author's language tags, against the language detected from the text, or
+// both.
+type LangDetectionMode string
+
+const (
+	// LangTagOnly matches Langs against the post's language tags. This is
+	// the default.
+	LangTagOnly LangDetectionMode = "tag-only"
+
+	// LangDetectOnly ignores the tags and matches Langs against the
+	// detected language.
+	LangDetectOnly LangDetectionMode = "detect-only"
+
+	// LangTagAndDetect requires both a matching tag and a matching detected
+	// language.
+	LangTagAndDetect LangDetectionMode = "tag-and-detect"
+)
+
+// validate reports whether m is a known mode. Empty means LangTagOnly.
+func (m LangDetectionMode) validate() error {
+	switch m {
+	case "", LangTagOnly, LangDetectOnly, LangTagAndDetect:
+		return nil
+	}
+	return fmt.Errorf("unknown language detection mode %q (want %q, %q, %q or empty)", string(m), LangTagOnly, LangDetectOnly, LangTagAndDetect)
+}
+
+// usesTags reports whether the mode checks language tags.
+func (m LangDetectionMode) usesTags() bool {
+	return m != LangDetectOnly
+}
+
+// usesDetection reports whether the mode checks the detected language.
+func (m LangDetectionMode) usesDetection() bool {
+	return m == LangDetectOnly || m == LangTagAndDetect
+}
+
+// detectLanguage fills in the post's detected language if one of the
+// candidate feeds checks it.
+func (s *FeedService) detectLanguage(incoming *IncomingPost, candidates []*feed) {
+	if s.opts.LanguageDetector == nil || incoming.DetectedLang != "" {
+		return
+	}
+	for _, f := range candidates {
+		if f.langMode.usesDetection() {
+			incoming.DetectedLang, incoming.LangConfidence = s.opts.LanguageDetector.DetectLanguage(incoming.Text)
+			return
+		}
+	}
+}
+
+// langFailure returns "langs" if the post's tags don't include one of the
+// feed's Langs, "detected_lang" if the detected language isn't one of them
+// or was detected with too little confidence, or "" if the post passes the
+// checks the feed's mode asks for. LangTagAndDetect also needs the tag and
+// the detected language to agree, so a post tagged "en" but detected as
+// "ja" doesn't match a feed for both; it fails with "langs".
+func (f *feed) langFailure(incoming *IncomingPost) string {
+	if f.langMode.usesTags() && !f.hasLangTag(incoming, "") {
+		return "langs"
+	}
+	if f.langMode.usesDetection() {
+		if incoming.DetectedLang == "" || incoming.LangConfidence < f.minLangConfidence {
+			return "detected_lang"
+		}
+		detected := langBase(incoming.DetectedLang)
+		if _, ok := f.langBases[detected]; !ok {
+			return "detected_lang"
+		}
+		if f.langMode.usesTags() && !f.hasLangTag(incoming, detected) {
+			return "langs"
+		}
+	}
+	return ""
+}
+
+// hasLangTag reports whether one of the post's tags is in the feed's Langs
+// and, if base is set, has that primary subtag.
+func (f *feed) hasLangTag(incoming *IncomingPost, base string) bool {
+	for _, l := range incoming.Langs {
+		if _, ok := f.langs[l]; ok && (base == "" || langBase(l) == base) {
+			return true
+		}
+	}
+	return false
+}
+
+// undetectableLangs returns the entries of langs whose primary subtag the
+// detector never reports.
+func undetectableLangs(langs []string, detector LanguageDetector) []string {
+	reported := make(map[string]struct{})
+	for _, l := range detector.Languages() {
+		reported[langBase(l)] = struct{}{}
+	}
+	var missing []string
+	for _, l := range langs {
+		if _, ok := reported[langBase(l)]; !ok {
+			missing = append(missing, l)
+		}
+	}
+	return missing
+}
+
+// langBase returns the lowercased primary subtag of a language code, e.g.
+// "pt" for "pt-BR".
+func langBase(lang string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	return strings.ToLower(base)
+}
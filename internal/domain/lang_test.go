@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// fakeDetector is a LanguageDetector that detects every post as lang.
+type fakeDetector struct {
+	lang  string
+	langs []string
+}
+
+func (d fakeDetector) DetectLanguage(string) (string, float64) { return d.lang, 1 }
+
+func (d fakeDetector) Languages() []string { return d.langs }
+
+func TestLangDetectionRejectsUndetectableLangs(t *testing.T) {
+	detector := fakeDetector{langs: []string{"ja", "ko"}}
+	tests := []struct {
+		name    string
+		mode    LangDetectionMode
+		langs   []string
+		wantErr string
+	}{
+		{"detectable", LangDetectOnly, []string{"ja", "ko-KR"}, ""},
+		{"undetectable", LangDetectOnly, []string{"en"}, `["en"]`},
+		{"partly undetectable", LangTagAndDetect, []string{"ja", "en-US"}, `["en-US"]`},
+		{"tags only", LangTagOnly, []string{"en"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemRepo()
+			_, err := NewFeedService([]FeedConfig{
+				{URI: testFeed("langs"), Keywords: []string{"golang"}, Langs: tt.langs, LangDetection: tt.mode},
+			}, repo, repo, ServiceOptions{LanguageDetector: detector}, slog.New(slog.DiscardHandler))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("NewFeedService() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("NewFeedService() error = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLangTagAndDetectRequiresAgreement(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		detected string
+		want     bool
+	}{
+		{"tag and detection agree", []string{"ja"}, "ja", true},
+		{"agree by primary subtag", []string{"ko-KR"}, "ko", true},
+		{"one of several tags agrees", []string{"ko", "ja"}, "ja", true},
+		{"tag and detection disagree", []string{"ko"}, "ja", false},
+		{"no tag", nil, "ja", false},
+		{"nothing detected", []string{"ja"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemRepo()
+			s, err := NewFeedService([]FeedConfig{
+				{URI: testFeed("cjk"), Keywords: []string{"golang"}, Langs: []string{"ja", "ko", "ko-KR"}, LangDetection: LangTagAndDetect},
+			}, repo, repo, ServiceOptions{
+				LanguageDetector: fakeDetector{lang: tt.detected, langs: []string{"ja", "ko"}},
+			}, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatal(err)
+			}
+			post := IncomingPost{Text: "golang", Langs: tt.tags}
+			if got := matches(s, post); got != tt.want {
+				t.Errorf("matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ResolveMentions replaces handles in each config's MentionsAny with the
+// DIDs they resolve to, so the feed matches on the stable identifier. Entries
+// that are already DIDs are left as they are. A leading '@' on a handle is
+// optional. It should be called once at startup, before NewFeedService.
+func ResolveMentions(ctx context.Context, configs []FeedConfig, resolver HandleResolver) error {
+	for i := range configs {
+		cfg := &configs[i]
+		if len(cfg.MentionsAny) == 0 {
+			continue
+		}
+		resolved := make([]string, len(cfg.MentionsAny))
+		for j, m := range cfg.MentionsAny {
+			if strings.HasPrefix(m, "did:") {
+				resolved[j] = m
+				continue
+			}
+			handle := strings.ToLower(strings.TrimPrefix(m, "@"))
+			did, err := resolver.ResolveHandle(ctx, handle)
+			if err != nil {
+				return fmt.Errorf("feed %s: resolve MentionsAny handle %q: %w", cfg.URI, m, err)
+			}
+			resolved[j] = did
+		}
+		cfg.MentionsAny = resolved
+	}
+	return nil
+}
+
+// mentionsAny reports whether any of the DIDs in mentions is in want.
+func mentionsAny(want map[string]struct{}, mentions []string) bool {
+	for _, did := range mentions {
+		if _, ok := want[did]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMentionsAny(t *testing.T) {
+	const watched = "did:plc:watched"
+	tests := []struct {
+		name     string
+		keywords []string
+		post     IncomingPost
+		want     bool
+	}{
+		{"mention alone", nil, IncomingPost{Text: "thanks!", Mentions: []string{watched}}, true},
+		{"among other mentions", nil, IncomingPost{Text: "hi all", Mentions: []string{"did:plc:other", watched}}, true},
+		{"no mention", nil, IncomingPost{Text: "thanks!"}, false},
+		{"other account mentioned", nil, IncomingPost{Text: "thanks!", Mentions: []string{"did:plc:other"}}, false},
+		{"DID in text is not a mention", nil, IncomingPost{Text: "ask " + watched}, false},
+		{"mention and keyword", []string{"release"}, IncomingPost{Text: "the release", Mentions: []string{watched}}, true},
+		{"mention without keyword", []string{"release"}, IncomingPost{Text: "hello", Mentions: []string{watched}}, false},
+		{"keyword without mention", []string{"release"}, IncomingPost{Text: "the release"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, FeedConfig{
+				URI:         testFeed("mentions"),
+				Keywords:    tt.keywords,
+				MentionsAny: []string{watched},
+			})
+			if got := matches(s, tt.post); got != tt.want {
+				t.Errorf("matches(%q, mentions %q) = %t, want %t", tt.post.Text, tt.post.Mentions, got, tt.want)
+			}
+		})
+	}
+}
+
+// handles is a HandleResolver backed by a map.
+type handles map[string]string
+
+func (h handles) ResolveHandle(_ context.Context, handle string) (string, error) {
+	if did, ok := h[handle]; ok {
+		return did, nil
+	}
+	return "", errors.New("handle not found")
+}
+
+func TestResolveMentions(t *testing.T) {
+	resolver := handles{"alice.bsky.social": "did:plc:alice"}
+	configs := []FeedConfig{
+		{URI: testFeed("a"), MentionsAny: []string{"@Alice.bsky.social", "did:plc:bob"}},
+		{URI: testFeed("b"), Keywords: []string{"go"}},
+	}
+	if err := ResolveMentions(context.Background(), configs, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"did:plc:alice", "did:plc:bob"}; !slices.Equal(configs[0].MentionsAny, want) {
+		t.Errorf("MentionsAny = %q, want %q", configs[0].MentionsAny, want)
+	}
+
+	unknown := []FeedConfig{{URI: testFeed("c"), MentionsAny: []string{"nobody.example"}}}
+	if err := ResolveMentions(context.Background(), unknown, resolver); err == nil {
+		t.Error("ResolveMentions accepted a handle that doesn't resolve")
+	}
+}
@@ -2,26 +2,89 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrInvalidCursor is returned by GetFeedPosts when the pagination cursor
+// is malformed.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnavailable is returned when the repository is refusing calls, e.g.
+// because a circuit breaker is open.
+var ErrUnavailable = errors.New("repository unavailable")
+
+// ErrOverloaded is returned when the repository turns a call away because too
+// many are already in flight. It reflects local load, not the database's
+// health.
+var ErrOverloaded = errors.New("repository overloaded")
+
+// ErrWriteFailed wraps repository errors hit while storing or deleting the
+// posts of a firehose event, including the tombstone check before a write.
+// Unlike errors about the event itself, they are usually transient, so the
+// block write failure policy retries them.
+var ErrWriteFailed = errors.New("post write failed")
+
 // PostRepository defines persistence operations for indexed posts.
 type PostRepository interface {
 	// CreatePost inserts a new post into the store, associating it with the
 	// given feed URIs. Each feed gets its own row.
 	CreatePost(ctx context.Context, post *Post, feedURIs []string) error
 
-	// DeletePost removes a post by its AT-URI across all feeds.
+	// DeletePost removes a post by its AT-URI across all feeds. If any rows
+	// were removed, a tombstone is recorded for the URI.
 	DeletePost(ctx context.Context, uri string) error
 
+	// IsTombstoned reports whether the post was deleted at or after since.
+	IsTombstoned(ctx context.Context, uri string, since time.Time) (bool, error)
+
+	// DeleteTombstonesBefore removes tombstones recorded before t. Returns
+	// rows deleted.
+	DeleteTombstonesBefore(ctx context.Context, t time.Time) (int64, error)
+
 	// DeleteOldPosts removes posts for a specific feed older than maxAge and
-	// caps the feed at maxRows, keeping the most recent. Returns rows deleted.
-	DeleteOldPosts(ctx context.Context, feedURI string, maxAge time.Duration, maxRows int) (int64, error)
+	// caps the feed at maxRows, keeping the most recent. The phases succeed or
+	// fail independently; the result reports each, and the error joins any
+	// phase errors.
+	DeleteOldPosts(ctx context.Context, feedURI string, maxAge time.Duration, maxRows int) (CleanupResult, error)
+
+	// DeletePostsBefore removes posts across all feeds indexed before t.
+	// Intended for operator-triggered maintenance. Returns rows deleted.
+	DeletePostsBefore(ctx context.Context, t time.Time) (int64, error)
 
 	// GetFeedPosts retrieves posts for the given feed URI, ordered by
-	// indexedAt descending. The cursor is opaque and implementation-defined.
-	// Returns posts and the next cursor (empty string if no more results).
-	GetFeedPosts(ctx context.Context, feedURI string, limit int, cursor string) ([]Post, string, error)
+	// indexedAt descending. The cursor is implementation-defined except that
+	// it starts with the last post's indexedAt in Unix milliseconds followed
+	// by "::", which the service reads to measure pagination depth. It
+	// must also accept a bare "<millis>::" as a cursor starting at the newest
+	// post indexed before that time.
+	// If langs is non-empty, only posts tagged with at least one of those
+	// normalized languages are returned. Returns posts and the next cursor
+	// (empty string if no more results).
+	GetFeedPosts(ctx context.Context, feedURI string, limit int, cursor string, langs []string) ([]Post, string, error)
+}
+
+// CleanupResult reports the outcome of each phase of DeleteOldPosts.
+type CleanupResult struct {
+	// ExpiredDeleted is the number of posts removed for exceeding maxAge.
+	ExpiredDeleted int64
+	// ExpiredErr is non-nil if the expiry phase failed.
+	ExpiredErr error
+
+	// ExcessDeleted is the number of posts removed for exceeding maxRows.
+	ExcessDeleted int64
+	// ExcessErr is non-nil if the cap phase failed.
+	ExcessErr error
+}
+
+// Deleted returns the total number of posts removed across both phases.
+func (r CleanupResult) Deleted() int64 {
+	return r.ExpiredDeleted + r.ExcessDeleted
+}
+
+// Err joins the phase errors, or returns nil if both phases succeeded.
+func (r CleanupResult) Err() error {
+	return errors.Join(r.ExpiredErr, r.ExcessErr)
 }
 
 // CursorRepository defines persistence operations for firehose cursors.
@@ -33,3 +96,115 @@ type CursorRepository interface {
 	// UpdateCursor persists the firehose cursor so we can resume on restart.
 	UpdateCursor(ctx context.Context, service string, cursor int64) error
 }
+
+// ReadPositionRepository persists how far each requester has paged into
+// each feed. Cursors are those returned by PostRepository.GetFeedPosts.
+type ReadPositionRepository interface {
+	// GetReadPosition returns the furthest cursor requesterDID has paged to
+	// in feedURI, or "" if none is saved.
+	GetReadPosition(ctx context.Context, requesterDID, feedURI string) (string, error)
+
+	// SaveReadPosition records cursor as requesterDID's position in feedURI
+	// if it is further down the feed than the saved one.
+	SaveReadPosition(ctx context.Context, requesterDID, feedURI, cursor string) error
+
+	// ResetReadPosition forgets requesterDID's position in feedURI.
+	ResetReadPosition(ctx context.Context, requesterDID, feedURI string) error
+
+	// DeleteReadPositions removes positions last used before t, then caps
+	// the total at maxRows (zero means no cap). Returns rows deleted.
+	DeleteReadPositions(ctx context.Context, t time.Time, maxRows int) (int64, error)
+}
+
+// PostUpserter writes posts that may already be indexed.
+type PostUpserter interface {
+	// UpsertPost adds the post to each of feedURIs. Where it is already in a
+	// feed, its indexedAt and metadata are overwritten instead, moving it to
+	// the top of the feed.
+	UpsertPost(ctx context.Context, post *Post, feedURIs []string) (UpsertResult, error)
+
+	// RemovePost takes the post out of each of feedURIs it is in, without
+	// recording a tombstone, and returns how many feeds it was removed from.
+	RemovePost(ctx context.Context, uri string, feedURIs []string) (int, error)
+}
+
+// UpsertResult counts the feeds an UpsertPost call added the post to and
+// the feeds it refreshed the post in.
+type UpsertResult struct {
+	Inserted int
+	Updated  int
+}
+
+// PostCounter counts the posts indexed for a feed.
+type PostCounter interface {
+	CountPosts(ctx context.Context, feedURI string) (int64, error)
+}
+
+// QueryGauge reports how many repository queries are running right now.
+type QueryGauge interface {
+	InFlightQueries() int64
+}
+
+// MatchedPostFinder looks up stored posts by the keyword that matched them,
+// as recorded in Post.MatchedKeywords.
+type MatchedPostFinder interface {
+	// PostsMatchedBy returns up to limit of feedURI's posts that matched
+	// keyword, newest first, with their text and author.
+	PostsMatchedBy(ctx context.Context, feedURI, keyword string, limit int) ([]Post, error)
+}
+
+// RecentPostFinder lists a feed's newest stored posts with their text and
+// author, which GetFeedPosts leaves out to keep the skeleton path lean.
+type RecentPostFinder interface {
+	// RecentPosts returns up to limit of feedURI's posts, newest first.
+	RecentPosts(ctx context.Context, feedURI string, limit int) ([]Post, error)
+}
+
+// PostTextResolver looks up the text of an existing post by AT-URI, e.g.
+// from the AppView. It returns "" and no error if the post doesn't exist.
+type PostTextResolver interface {
+	GetPostText(ctx context.Context, uri string) (string, error)
+}
+
+// LanguageDetector guesses the language of a post's text. DetectLanguage
+// returns a language code such as "en" and a confidence between 0 and 1, or
+// "" if it can't tell. It is called on the firehose hot path and must be fast.
+// Languages lists the primary subtags DetectLanguage can return, so feeds
+// asking for a language it never reports are rejected up front.
+type LanguageDetector interface {
+	DetectLanguage(text string) (lang string, confidence float64)
+	Languages() []string
+}
+
+// FollowersResolver looks up how many followers an account has, e.g. from
+// its AppView profile.
+type FollowersResolver interface {
+	GetFollowersCount(ctx context.Context, did string) (int, error)
+}
+
+// HandleResolver resolves an account handle to its DID, e.g. via
+// com.atproto.identity.resolveHandle.
+type HandleResolver interface {
+	ResolveHandle(ctx context.Context, handle string) (string, error)
+}
+
+// MatchNotifier tells external systems about posts saved to feeds with a
+// WebhookURL. NotifyMatch is called on the firehose hot path and must not
+// block.
+type MatchNotifier interface {
+	NotifyMatch(webhookURL, feedURI string, post *IncomingPost)
+}
+
+// RepositoryPinger is optionally implemented by repositories that can check
+// they are reachable without writing anything.
+type RepositoryPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// RepositoryStateReporter is optionally implemented by repositories that
+// track their own availability, such as a circuit breaker.
+type RepositoryStateReporter interface {
+	// RepositoryState returns a short description of the repository's
+	// state. "closed" means healthy.
+	RepositoryState() string
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
+)
+
+// readPosition returns the requester's saved position in the feed, or "" if
+// there is none or it can't be read. A failed lookup only costs the
+// requester their place, so it doesn't fail the request.
+func (s *FeedService) readPosition(ctx context.Context, requesterDID, feedURI string) string {
+	cursor, err := s.opts.ReadPositions.GetReadPosition(ctx, requesterDID, feedURI)
+	if err != nil {
+		logctx.From(ctx, s.logger).Warn("failed to load read position", "feedURI", feedURI, "requester", requesterDID, "error", err)
+		return ""
+	}
+	return cursor
+}
+
+// saveReadPosition records that the requester has paged to cursor. An empty
+// cursor means they reached the end of the feed, so their position is reset
+// and the next first page starts from the top. Failures are logged and
+// otherwise ignored.
+func (s *FeedService) saveReadPosition(ctx context.Context, requesterDID, feedURI, cursor string) {
+	var err error
+	if cursor == "" {
+		err = s.opts.ReadPositions.ResetReadPosition(ctx, requesterDID, feedURI)
+	} else {
+		err = s.opts.ReadPositions.SaveReadPosition(ctx, requesterDID, feedURI, cursor)
+	}
+	if err != nil {
+		logctx.From(ctx, s.logger).Warn("failed to save read position", "feedURI", feedURI, "requester", requesterDID, "error", err)
+	}
+}
+
+// UsesRequester reports whether feedURI serves requesters differently by
+// DID, i.e. has ResumeFromLastSeen, so callers can skip identifying them
+// for other feeds.
+func (s *FeedService) UsesRequester(feedURI string) bool {
+	f, ok := s.feeds[feedURI]
+	return ok && f.resume
+}
@@ -1,6 +1,12 @@
 package domain
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
 // Post represents an indexed BlueSky post stored in our database.
 type Post struct {
@@ -12,6 +18,76 @@ type Post struct {
 
 	// IndexedAt is when we indexed this post.
 	IndexedAt time.Time
+
+	// AuthorDID is the DID of the post's author.
+	AuthorDID string
+
+	// Text is the post body text. It is empty for posts added through
+	// reposts, whose text isn't on the firehose event.
+	Text string
+
+	// Langs is the post's language tags, normalized with NormalizeLangs.
+	Langs []string
+
+	// RepostURI is the AT-URI of the repost that added the post to its feed,
+	// or empty if the post matched on its own content.
+	RepostURI string
+
+	// MatchedKeywords maps the URIs of the feeds the post was saved to onto
+	// the top-level keywords it matched there, as configured. Feeds the post
+	// matched without a keyword have no entry. It is stored for analytics
+	// and not read back when serving feeds.
+	MatchedKeywords map[string][]string
+}
+
+// WebURL returns the bsky.app page of the post, or empty if its URI isn't a
+// post AT-URI.
+func (p Post) WebURL() string {
+	rest, ok := strings.CutPrefix(p.URI, "at://")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] != "app.bsky.feed.post" || parts[2] == "" {
+		return ""
+	}
+	return "https://bsky.app/profile/" + parts[0] + "/post/" + parts[2]
+}
+
+// PreviewText makes untrusted text safe to put in logs and terminal output:
+// invalid UTF-8 becomes U+FFFD and control characters, including newlines,
+// become spaces. If n is positive the result is cut to at most n bytes,
+// never inside a rune, and marked with "...". Matching should use the
+// original text.
+func PreviewText(text string, n int) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if unicode.IsControl(r) {
+			r = ' '
+		}
+		if n > 0 && b.Len()+utf8.RuneLen(r) > n {
+			b.WriteString("...")
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NormalizeLangs reduces BCP 47 language tags to their lowercased primary
+// subtags (e.g. "en-US" becomes "en") and removes duplicates and empties.
+func NormalizeLangs(tags []string) []string {
+	var langs []string
+	for _, tag := range tags {
+		primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		primary = strings.ToLower(primary)
+		if primary == "" || slices.Contains(langs, primary) {
+			continue
+		}
+		langs = append(langs, primary)
+	}
+	return langs
 }
 
 // IncomingPost represents a new post from the firehose that hasn't been
@@ -31,4 +107,44 @@ type IncomingPost struct {
 
 	// Langs is the list of language tags set by the author's client.
 	Langs []string
+
+	// CreatedAt is the record's client-declared creation time, or zero if
+	// it was missing or unparseable.
+	CreatedAt time.Time
+
+	// Tags is the list of hashtags on the post, without the leading '#'. It
+	// combines the record's out-of-text tags with hashtag facets in the text.
+	Tags []string
+
+	// Mentions is the distinct DIDs of accounts @-mentioned in the text, from
+	// mention facets.
+	Mentions []string
+
+	// Links is the distinct external link URIs in the post, from link facets
+	// and an external link card embed.
+	Links []string
+
+	// LinkCount is the number of distinct external links in the post.
+	LinkCount int
+
+	// QuotedURI is the AT-URI of the post this one quotes, if any.
+	QuotedURI string
+
+	// IsQuote reports whether the post quotes another post, with an
+	// app.bsky.embed.record embed or one combined with media.
+	IsQuote bool
+
+	// ReplyRootURI is the AT-URI of the post that started the thread, if
+	// this post is a reply.
+	ReplyRootURI string
+
+	// QuotedText is the text of the quoted post. The feed service fills it in
+	// when a feed matches on quoted text.
+	QuotedText string
+
+	// DetectedLang and LangConfidence are the language detected from Text
+	// and the detector's confidence in it. The feed service fills them in
+	// when a feed matches on detected language.
+	DetectedLang   string
+	LangConfidence float64
 }
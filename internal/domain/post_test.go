@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPreviewText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+		want string
+	}{
+		{"short text unchanged", "hello", 10, "hello"},
+		{"no limit", "hello world", 0, "hello world"},
+		{"cut at a rune boundary", "hello world", 5, "hello..."},
+		{"emoji straddling the cut", "ab😀cd", 4, "ab..."},
+		{"emoji ending at the cut", "ab😀cd", 6, "ab😀..."},
+		{"emoji just fits", "ab😀", 6, "ab😀"},
+		{"multibyte letters", "héllo", 2, "h..."},
+		{"newlines and tabs", "line one\nline two\tend", 0, "line one line two end"},
+		{"control bytes", "a\x00b\x1bc\x7fd", 0, "a b c d"},
+		{"C1 control", "a\u0085b", 0, "a b"},
+		{"invalid UTF-8", "a\xffb", 0, "a�b"},
+		{"invalid UTF-8 at the cut", "ab\xff", 3, "ab..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PreviewText(tt.text, tt.n)
+			if got != tt.want {
+				t.Errorf("PreviewText(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("PreviewText(%q, %d) = %q is not valid UTF-8", tt.text, tt.n, got)
+			}
+		})
+	}
+}
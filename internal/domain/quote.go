@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// quoteCacheTTL and quoteCacheSize bound the cache of quoted post text.
+	// Popular posts are quoted many times, so most lookups hit the cache.
+	quoteCacheTTL  = time.Hour
+	quoteCacheSize = 10000
+
+	// quoteMissTTL is how long a failed lookup is remembered, so a slow or
+	// failing AppView is asked about each quoted post at most this often.
+	quoteMissTTL = time.Minute
+
+	// quoteLookupTimeout bounds a single quoted post lookup so a slow AppView
+	// can't stall the firehose.
+	quoteLookupTimeout = 2 * time.Second
+)
+
+// QuoteFilter selects whether a feed takes quote posts.
+type QuoteFilter string
+
+const (
+	// QuotesInclude matches quote posts like any other post. This is the
+	// default.
+	QuotesInclude QuoteFilter = ""
+
+	// QuotesExclude never matches quote posts.
+	QuotesExclude QuoteFilter = "exclude"
+
+	// QuotesOnly matches only quote posts.
+	QuotesOnly QuoteFilter = "only"
+)
+
+// validate reports whether q is a known filter.
+func (q QuoteFilter) validate() error {
+	switch q {
+	case QuotesInclude, QuotesExclude, QuotesOnly:
+		return nil
+	}
+	return fmt.Errorf("unknown quote filter %q (want %q, %q or empty)", string(q), QuotesExclude, QuotesOnly)
+}
+
+// rejects reports whether the filter rules out incoming.
+func (q QuoteFilter) rejects(incoming *IncomingPost) bool {
+	switch q {
+	case QuotesExclude:
+		return incoming.IsQuote
+	case QuotesOnly:
+		return !incoming.IsQuote
+	}
+	return false
+}
+
+// quoteCache holds quoted post text by URI, and the URIs whose lookup
+// failed recently.
+type quoteCache struct {
+	texts  *ttlCache[string]
+	misses *ttlCache[struct{}]
+}
+
+func newQuoteCache() *quoteCache {
+	return &quoteCache{
+		texts:  newTTLCache[string](quoteCacheTTL, quoteCacheSize),
+		misses: newTTLCache[struct{}](quoteMissTTL, quoteCacheSize),
+	}
+}
+
+// wantsQuotedText reports whether the quoted post's text could add feeds to
+// matched: incoming is a quote post, and a feed with MatchQuotedText that it
+// didn't match fails only on its keyword rules. Only then is the text worth
+// a lookup.
+func (s *FeedService) wantsQuotedText(incoming *IncomingPost, matched []string) bool {
+	if s.quotes == nil || incoming.QuotedURI == "" || incoming.QuotedText != "" {
+		return false
+	}
+	for _, f := range s.feeds {
+		if !f.quoted || slices.Contains(matched, f.uri) || !f.sampled(incoming.URI) {
+			continue
+		}
+		s.detectLanguage(incoming, []*feed{f})
+		switch ruleFailure(f, incoming) {
+		case "keywords", "min_keyword_hits", "min_score", "require_all":
+			return true
+		}
+	}
+	return false
+}
+
+// matchWithQuotedText looks up the text of the post incoming quotes and
+// returns the feeds incoming matches with it, or matched if there is none.
+func (s *FeedService) matchWithQuotedText(ctx context.Context, incoming *IncomingPost, matched []string) []string {
+	if incoming.QuotedText = s.quotedText(ctx, incoming.QuotedURI); incoming.QuotedText == "" {
+		return matched
+	}
+	return s.matchingFeeds(incoming)
+}
+
+// quotedText returns the text of the quoted post at uri, from the cache or
+// the resolver. Lookup failures are logged, remembered for quoteMissTTL and
+// treated as empty text, so the post is still matched on its own text.
+func (s *FeedService) quotedText(ctx context.Context, uri string) string {
+	now := time.Now()
+	if text, ok := s.quotes.texts.get(uri, now); ok {
+		return text
+	}
+	if _, ok := s.quotes.misses.get(uri, now); ok {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, quoteLookupTimeout)
+	defer cancel()
+	text, err := s.opts.QuotedPosts.GetPostText(ctx, uri)
+	if err != nil {
+		s.logger.Warn("failed to look up quoted post", "uri", uri, "error", err)
+		s.quotes.misses.put(uri, struct{}{}, now)
+		return ""
+	}
+	s.quotes.texts.put(uri, text, now)
+	return text
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+// fakePostTexts is a PostTextResolver that counts its lookups.
+type fakePostTexts struct {
+	texts   map[string]string
+	lookups int
+}
+
+func (f *fakePostTexts) GetPostText(_ context.Context, uri string) (string, error) {
+	f.lookups++
+	text, ok := f.texts[uri]
+	if !ok {
+		return "", errors.New("appview unavailable")
+	}
+	return text, nil
+}
+
+func TestQuoteFilter(t *testing.T) {
+	const root = "at://did:plc:someone/app.bsky.feed.post/root"
+	posts := map[string]IncomingPost{
+		"plain":          {Text: "golang tip"},
+		"quote":          {Text: "golang tip", IsQuote: true, QuotedURI: root},
+		"reply":          {Text: "golang tip", ReplyRootURI: root},
+		"reply-to-quote": {Text: "golang tip", ReplyRootURI: "at://did:plc:someone/app.bsky.feed.post/quoting"},
+		"quoting reply":  {Text: "golang tip", IsQuote: true, QuotedURI: root, ReplyRootURI: root},
+	}
+	tests := []struct {
+		filter QuoteFilter
+		want   map[string]bool
+	}{
+		{QuotesInclude, map[string]bool{"plain": true, "quote": true, "reply": true, "reply-to-quote": true, "quoting reply": true}},
+		{QuotesExclude, map[string]bool{"plain": true, "quote": false, "reply": true, "reply-to-quote": true, "quoting reply": false}},
+		{QuotesOnly, map[string]bool{"plain": false, "quote": true, "reply": false, "reply-to-quote": false, "quoting reply": true}},
+	}
+	for _, tt := range tests {
+		s := newTestService(t, FeedConfig{URI: testFeed("quotes"), Keywords: []string{"golang"}, Quotes: tt.filter})
+		for name, post := range posts {
+			if got := matches(s, post); got != tt.want[name] {
+				t.Errorf("filter %q, %s post: matches = %t, want %t", tt.filter, name, got, tt.want[name])
+			}
+		}
+	}
+}
+
+func TestQuoteFilterValidate(t *testing.T) {
+	for _, q := range []QuoteFilter{QuotesInclude, QuotesExclude, QuotesOnly} {
+		if err := q.validate(); err != nil {
+			t.Errorf("%q.validate() = %v", q, err)
+		}
+	}
+	if err := QuoteFilter("never").validate(); err == nil {
+		t.Error(`QuoteFilter("never").validate() = nil, want an error`)
+	}
+}
+
+func TestQuotedTextLookup(t *testing.T) {
+	const (
+		quoted  = "at://did:plc:someone/app.bsky.feed.post/quoted"
+		missing = "at://did:plc:someone/app.bsky.feed.post/missing"
+	)
+	tests := []struct {
+		name        string
+		post        IncomingPost
+		wantMatch   bool
+		wantLookups int
+	}{
+		{"keyword only in quoted text", IncomingPost{Text: "this 👀", Langs: []string{"en"}, QuotedURI: quoted}, true, 1},
+		{"keyword in own text", IncomingPost{Text: "golang tip", Langs: []string{"en"}, QuotedURI: quoted}, true, 0},
+		{"fails language before keywords", IncomingPost{Text: "this 👀", Langs: []string{"de"}, QuotedURI: quoted}, false, 0},
+		{"not a quote", IncomingPost{Text: "this 👀", Langs: []string{"en"}}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			texts := &fakePostTexts{texts: map[string]string{quoted: "golang 1.26 is out"}}
+			repo := newMemRepo()
+			s, err := NewFeedService([]FeedConfig{
+				{URI: testFeed("quoted"), Keywords: []string{"golang"}, Langs: []string{"en"}, MatchQuotedText: true},
+			}, repo, repo, ServiceOptions{QuotedPosts: texts}, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatal(err)
+			}
+			post := tt.post
+			post.URI = "at://did:plc:author/app.bsky.feed.post/1"
+			saved, err := s.ProcessNewPost(context.Background(), &post)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(saved) > 0; got != tt.wantMatch {
+				t.Errorf("matched = %t, want %t", got, tt.wantMatch)
+			}
+			if texts.lookups != tt.wantLookups {
+				t.Errorf("lookups = %d, want %d", texts.lookups, tt.wantLookups)
+			}
+		})
+	}
+
+	t.Run("failed lookups are cached", func(t *testing.T) {
+		texts := &fakePostTexts{}
+		repo := newMemRepo()
+		s, err := NewFeedService([]FeedConfig{
+			{URI: testFeed("quoted"), Keywords: []string{"golang"}, MatchQuotedText: true},
+		}, repo, repo, ServiceOptions{QuotedPosts: texts}, slog.New(slog.DiscardHandler))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rkey := range []string{"a", "b", "c"} {
+			post := IncomingPost{URI: "at://did:plc:author/app.bsky.feed.post/" + rkey, Text: "this 👀", QuotedURI: missing}
+			if _, err := s.ProcessNewPost(context.Background(), &post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if texts.lookups != 1 {
+			t.Errorf("lookups = %d, want 1", texts.lookups)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// IncomingRepost represents a repost from the firehose.
+type IncomingRepost struct {
+	// ReposterDID is the DID of the account that reposted.
+	ReposterDID string
+
+	// RepostURI is the AT-URI of the repost record itself.
+	RepostURI string
+
+	// SubjectURI and SubjectCID identify the reposted record.
+	SubjectURI string
+	SubjectCID string
+}
+
+// WantsReposts reports whether any feed includes posts via reposts, i.e.
+// whether repost events need to be consumed at all.
+func (s *FeedService) WantsReposts() bool {
+	return len(s.reposters) > 0
+}
+
+// ProcessRepost adds the reposted post to every feed that lists the reposter
+// in its Reposters. A post already in a feed, e.g. from a keyword match, is
+// left as is, without repost attribution. Returns the URIs of the feeds the
+// post was saved to, or nil if the reposter isn't listed by any feed.
+//
+// Reposted posts are stored without language tags, since the repost doesn't
+// carry them, so they are excluded from language-filtered pages.
+func (s *FeedService) ProcessRepost(ctx context.Context, repost *IncomingRepost) ([]string, error) {
+	feedURIs := s.reposters[repost.ReposterDID]
+	if len(feedURIs) == 0 {
+		return nil, nil
+	}
+	if !strings.Contains(repost.SubjectURI, "/app.bsky.feed.post/") {
+		return nil, nil
+	}
+
+	if tombstoned, err := s.isTombstoned(ctx, repost.SubjectURI); err != nil || tombstoned {
+		return nil, err
+	}
+
+	post := &Post{
+		URI:       repost.SubjectURI,
+		CID:       repost.SubjectCID,
+		IndexedAt: time.Now().UTC(),
+		AuthorDID: uriAuthority(repost.SubjectURI),
+		RepostURI: repost.RepostURI,
+	}
+	return s.savePost(ctx, post, feedURIs)
+}
+
+// uriAuthority returns the repo DID of an AT-URI, e.g. "did:plc:abc" for
+// "at://did:plc:abc/app.bsky.feed.post/xyz".
+func uriAuthority(uri string) string {
+	authority, _, _ := strings.Cut(strings.TrimPrefix(uri, "at://"), "/")
+	return authority
+}
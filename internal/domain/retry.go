@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// WriteFailurePolicy decides what happens to a matched post that fails to
+// persist.
+type WriteFailurePolicy string
+
+const (
+	// WriteFailureBuffer holds failed posts in a bounded in-memory buffer
+	// and retries them in the background, dropping posts once it is full.
+	// This is the default.
+	WriteFailureBuffer WriteFailurePolicy = "buffer"
+
+	// WriteFailureDrop discards failed posts immediately.
+	WriteFailureDrop WriteFailurePolicy = "drop"
+
+	// WriteFailureBlock returns the error, wrapping ErrWriteFailed, to the
+	// caller, which is expected to retry the same event until it succeeds.
+	// The firehose subscriber does so without advancing its cursor, so no
+	// matched post is lost even across restarts, at the cost of falling
+	// behind while writes fail.
+	WriteFailureBlock WriteFailurePolicy = "block"
+)
+
+// pendingPost is a matched post whose insert failed and is waiting to be
+// retried.
+type pendingPost struct {
+	post     *Post
+	feedURIs []string
+}
+
+// Health reports the state of the service's write path.
+type Health struct {
+	// Degraded is true while posts are failing to persist.
+	Degraded bool
+
+	// PendingPosts is the number of matched posts buffered for retry.
+	PendingPosts int
+
+	// DroppedPosts is the number of matched posts discarded because the
+	// retry buffer was full, since the service started.
+	DroppedPosts int64
+
+	// LastError is the most recent write error while degraded.
+	LastError string
+
+	// RepositoryState is the repository's self-reported state (e.g. a
+	// circuit breaker's), or empty if it doesn't report one.
+	RepositoryState string
+
+	// InFlightQueries is the number of repository queries running, or -1
+	// without ServiceOptions.QueryGauge.
+	InFlightQueries int64
+}
+
+// Health returns the current write path health.
+func (s *FeedService) Health() Health {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	h := Health{
+		Degraded:     s.lastWriteErr != nil,
+		PendingPosts: len(s.pending),
+		DroppedPosts: s.dropped,
+
+		InFlightQueries: s.InFlightQueries(),
+	}
+	if s.lastWriteErr != nil {
+		h.LastError = s.lastWriteErr.Error()
+	}
+	if r, ok := s.repo.(RepositoryStateReporter); ok {
+		h.RepositoryState = r.RepositoryState()
+		if h.RepositoryState != "closed" {
+			h.Degraded = true
+		}
+	}
+	return h
+}
+
+// InFlightQueries returns the number of repository queries running, or -1
+// without ServiceOptions.QueryGauge.
+func (s *FeedService) InFlightQueries() int64 {
+	if s.opts.QueryGauge == nil {
+		return -1
+	}
+	return s.opts.QueryGauge.InFlightQueries()
+}
+
+// bufferFailedPost holds a post whose insert failed so it can be retried. It
+// reports false if the write failure policy doesn't buffer or the buffer is
+// full.
+func (s *FeedService) bufferFailedPost(post *Post, feedURIs []string, err error) bool {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	s.lastWriteErr = err
+	switch s.opts.WriteFailurePolicy {
+	case WriteFailureBlock:
+		return false // the caller retries, so nothing is dropped
+	case WriteFailureDrop:
+		s.dropped++
+		return false
+	}
+	if len(s.pending) >= s.opts.RetryBufferSize {
+		s.dropped++
+		return false
+	}
+	s.pending = append(s.pending, pendingPost{post: post, feedURIs: feedURIs})
+	return true
+}
+
+// StartRetryJob periodically retries buffered posts until the buffer drains.
+// It blocks until ctx is cancelled.
+func (s *FeedService) StartRetryJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryPending(ctx)
+		}
+	}
+}
+
+func (s *FeedService) retryPending(ctx context.Context) {
+	s.pendingMu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.pendingMu.Unlock()
+
+	for i, p := range batch {
+		if err := s.repo.CreatePost(ctx, p.post, p.feedURIs); err != nil {
+			// Still failing: put the remainder back in front of anything
+			// buffered meanwhile and try again next tick.
+			s.pendingMu.Lock()
+			s.pending = append(batch[i:], s.pending...)
+			if len(s.pending) > s.opts.RetryBufferSize {
+				s.dropped += int64(len(s.pending) - s.opts.RetryBufferSize)
+				s.pending = s.pending[:s.opts.RetryBufferSize]
+			}
+			s.lastWriteErr = err
+			s.pendingMu.Unlock()
+			s.logger.Warn("retrying buffered posts failed", "pending", len(batch)-i, "error", err)
+			return
+		}
+	}
+
+	if len(batch) > 0 {
+		s.logger.Info("flushed buffered posts", "count", len(batch))
+		s.writeSucceeded()
+		return
+	}
+
+	// With nothing buffered (a zero RetryBufferSize or a policy that doesn't
+	// buffer) there is no write to prove recovery, so ask the repository.
+	s.pendingMu.Lock()
+	degraded := s.lastWriteErr != nil
+	s.pendingMu.Unlock()
+	if !degraded {
+		return
+	}
+	pinger, ok := s.repo.(RepositoryPinger)
+	if !ok {
+		return // recovery shows on the next successful write
+	}
+	if err := pinger.Ping(ctx); err != nil {
+		s.pendingMu.Lock()
+		s.lastWriteErr = err
+		s.pendingMu.Unlock()
+		return
+	}
+	s.writeSucceeded()
+}
+
+// writeSucceeded clears the degraded state after a successful write or ping,
+// unless posts are still waiting to be retried.
+func (s *FeedService) writeSucceeded() {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if len(s.pending) == 0 && s.lastWriteErr != nil {
+		s.logger.Info("post writes recovered")
+		s.lastWriteErr = nil
+	}
+}
@@ -4,35 +4,287 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"math"
+	"net"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
 )
 
 // ErrUnknownFeed is returned when a requested feed URI is not registered.
 var ErrUnknownFeed = errors.New("unknown feed")
 
+// atURIPattern matches a record AT-URI: at://<did-or-handle>/<collection>/<rkey>.
+var atURIPattern = regexp.MustCompile(`^at://[a-zA-Z0-9._:%-]+/[a-zA-Z0-9.-]+/[a-zA-Z0-9._:~-]+$`)
+
 // FeedConfig describes a single feed's matching rules.
 type FeedConfig struct {
 	// URI is the AT-URI of the feed generator record.
 	URI string
 
+	// DisplayName is the feed's human-readable name, reported alongside its
+	// URI by FeedStats. cmd/publish --reconcile publishes it, with
+	// Description and AvatarPath, as the feed generator record; feeds
+	// without one aren't reconciled.
+	DisplayName string
+
+	// Description is the feed's description in its published record.
+	Description string
+
+	// AvatarPath is the PNG, JPEG or WebP image file used as the avatar in
+	// the feed's published record. Relative paths are resolved against the
+	// working directory of cmd/publish. Empty means no avatar.
+	AvatarPath string
+
 	// Keywords are the terms to match against post text using word boundaries.
 	Keywords []string
 
+	// KeywordAliases expands keywords into other spellings, e.g. "gpt" into
+	// "gpt-4", "gpt4" and "chatgpt". Each key must appear in Keywords or in
+	// a RequireAll group, and its aliases are matched wherever it is, exactly
+	// as if they were listed alongside it.
+	KeywordAliases map[string][]string
+
+	// MinKeywordHits requires a post to contain at least this many distinct
+	// Keywords. Where keywords overlap, only the longest one found at a
+	// position counts, so "claude opus" is one hit, not two. Zero and one
+	// both mean any single keyword is enough.
+	MinKeywordHits int
+
+	// KeywordWeights gives some Keywords more (or less) say in MinScore than
+	// others, e.g. 3 for a term that almost always means the topic and 0.5
+	// for one that only sometimes does. Keywords without a weight count as
+	// 1, and aliases take the weight of their keyword. Each key must be one
+	// of Keywords, compared ignoring case unless CaseSensitive is set, and
+	// each weight must be positive.
+	KeywordWeights map[string]float64
+
+	// MinScore requires the weights of the distinct Keywords in a post to
+	// add up to at least this much: a score equal to MinScore matches, and
+	// only lower scores are rejected. Zero means no score threshold. It is
+	// checked alongside MinKeywordHits, and suits feeds where one strong
+	// keyword should be enough but weak ones only count together.
+	MinScore float64
+
+	// CaseSensitive matches Keywords, and the keywords of RequireAll groups,
+	// with exact case, e.g. so "AI" doesn't match "ai". By default matching
+	// ignores case.
+	CaseSensitive bool
+
 	// Langs restricts matches to posts tagged with at least one of these
 	// language codes. An empty slice means no language filter.
 	Langs []string
+
+	// LangDetection selects what Langs is checked against: the author's
+	// language tags (LangTagOnly, the default), the language detected from
+	// the post text (LangDetectOnly), or both (LangTagAndDetect). Detection
+	// requires ServiceOptions.LanguageDetector.
+	LangDetection LangDetectionMode
+
+	// MinLangConfidence is the lowest detector confidence, between 0 and 1,
+	// the detection modes accept. Zero accepts any detected language.
+	MinLangConfidence float64
+
+	// MentionsAny restricts matches to posts that @-mention at least one of
+	// these accounts. Entries must be DIDs by the time NewFeedService is
+	// called; handles can be turned into DIDs with ResolveMentions. Set on
+	// its own, it matches every post mentioning one of the accounts.
+	MentionsAny []string
+
+	// ReplyRootAuthors and ReplyRootURIs match every reply in a thread
+	// started by one of these accounts (DIDs) or at one of these posts
+	// (AT-URIs), regardless of Keywords, MentionsAny and RequireAll, for
+	// feeds that follow whole conversations. The thread's root post itself
+	// isn't matched. Langs, TimeWindows and the link rules still apply.
+	ReplyRootAuthors []string
+	ReplyRootURIs    []string
+
+	// TimeWindows restricts matches to posts whose createdAt falls within
+	// one of these UTC hour ranges, e.g. {6, 10} for a morning feed. Posts
+	// without a valid createdAt never match. An empty slice means no time
+	// filter.
+	TimeWindows []HourRange
+
+	// FilterByAcceptLanguage serves each requester only the posts in their
+	// preferred languages (from the Accept-Language header BlueSky forwards).
+	// Requests without a preference get all posts.
+	FilterByAcceptLanguage bool
+
+	// PinnedPosts are AT-URIs of posts shown at the top of the first page of
+	// the feed regardless of recency, e.g. for announcements.
+	PinnedPosts []string
+
+	// MaxAge and MaxRows override the cleanup job's global retention for this
+	// feed. Zero uses the global default.
+	MaxAge  time.Duration
+	MaxRows int
+
+	// MaxCursorAge caps how far back the feed can be paged: a request whose
+	// cursor points at posts indexed longer ago than this gets an empty page
+	// with no cursor, without querying the repository. Zero means no cap.
+	MaxCursorAge time.Duration
+
+	// MinLinks and MaxLinks bound the number of distinct external links a
+	// post may contain. Zero means no constraint.
+	MinLinks int
+	MaxLinks int
+
+	// BlockedDomains rejects posts linking to any of these hosts or their
+	// subdomains. Hosts are compared case-insensitively, ignoring "www.".
+	BlockedDomains []string
+
+	// MatchQuotedText also matches Keywords and RequireAll keyword groups
+	// against the text of the post being quoted, for quote posts whose own
+	// text (e.g. "this 👀") doesn't carry the topic. Quoted text is looked up
+	// via ServiceOptions.QuotedPosts.
+	MatchQuotedText bool
+
+	// Quotes excludes quote posts from the feed (QuotesExclude) or makes it
+	// take nothing but them (QuotesOnly). A post counts as a quote when it
+	// embeds another post, with or without media, whatever else it is, so
+	// a reply that quotes is a quote. Empty includes them like any post.
+	Quotes QuoteFilter
+
+	// OriginalOnly restricts the feed to top-level original posts: replies
+	// and quote posts never match, and the feed can't take reposts. It can
+	// be combined with Quotes set to QuotesExclude, which it already
+	// implies, but not with QuotesOnly, Reposters, or reply roots, which
+	// would leave the feed nothing to match.
+	OriginalOnly bool
+
+	// RequireAll lists groups that must every one be satisfied for a post to
+	// match, in addition to Keywords when those are set. Use it to express
+	// AND rules such as "mentions release AND is tagged #golang".
+	RequireAll []MatchGroup
+
+	// SampleRate is the fraction of matching posts kept, between 0 and 1, as
+	// a pressure valve for very broad feeds. Whether a post is kept depends
+	// only on its URI, so reprocessing it gives the same outcome. Zero means
+	// 1 (keep every match).
+	SampleRate float64
+
+	// MinAuthorFollowers, if positive, rejects posts from authors with fewer
+	// followers. Follower counts are looked up in the background and cached;
+	// while an author's count isn't known their posts are let through, so
+	// no real match is lost. Requires ServiceOptions.AuthorFollowers.
+	MinAuthorFollowers int
+
+	// ResumeFromLastSeen makes a first-page request from an identified
+	// requester continue from the furthest position they have paged to,
+	// instead of the top of the feed. Requires ServiceOptions.ReadPositions.
+	ResumeFromLastSeen bool
+
+	// WebhookURL, if set, receives a POST for every post saved to the feed.
+	// Requires ServiceOptions.Webhooks.
+	WebhookURL string
+
+	// Public also serves the feed's recent posts outside Bluesky, as a JSON
+	// Feed and RSS document at /feed/{rkey}.json and /feed/{rkey}.rss.
+	Public bool
+
+	// Reposters lists account DIDs whose reposts add the reposted post to the
+	// feed, regardless of its author or text. Reposted posts don't need to
+	// satisfy the feed's other rules.
+	Reposters []string
+
+	// RefreshOnEdit makes an edited post that matches the feed surface
+	// again: it is added if new to the feed, or moved to the top with its
+	// new text if already there. An edit that no longer matches removes the
+	// post from the feed. By default edits are ignored, so editing a post
+	// can't bump it. Requires ServiceOptions.PostUpserts.
+	RefreshOnEdit bool
+
+	// Matcher is an optional hook for custom match logic. It runs after the
+	// built-in keyword, language, and RequireAll checks and decides the final
+	// outcome. nil keeps the built-in result.
+	Matcher MatchFunc
+}
+
+// MatchFunc decides whether a post belongs in a feed. matched is the result
+// of the feed's built-in rules; return it unchanged to defer to them, false to
+// veto, or true to approve a post the rules rejected.
+//
+// A MatchFunc is called for every incoming post on the firehose hot path, so
+// it must be fast and must not block. It may be called concurrently.
+type MatchFunc func(post *IncomingPost, matched bool) bool
+
+// MatchGroup is a set of alternatives within a RequireAll rule. A post
+// satisfies the group when its text contains any of the Keywords or it
+// carries any of the Hashtags.
+type MatchGroup struct {
+	// Keywords are matched against post text using word boundaries.
+	Keywords []string
+
+	// Hashtags are matched case-insensitively against the post's tags. A
+	// leading '#' is optional.
+	Hashtags []string
 }
 
 // feed holds the compiled matching state for a single feed.
 type feed struct {
-	uri     string
-	pattern *regexp.Regexp
-	langs   map[string]struct{} // nil means no filter
+	uri        string
+	name       string              // display name; may be empty
+	pattern    *regexp.Regexp      // nil means no top-level keyword list
+	langs      map[string]struct{} // nil means no filter
+	mentions   map[string]struct{} // DIDs a post must mention one of; nil means any
+	requireAll []matchGroup
+	minLinks   int           // 0 means no constraint
+	maxLinks   int           // 0 means no constraint
+	matcher    MatchFunc     // nil means built-in rules only
+	keywords   []string      // top-level keywords, indexed by keywordIndex
+	pinned     []string      // pinned post AT-URIs, in display order
+	maxAge     time.Duration // 0 means the cleanup job's default
+	maxRows    int           // 0 means the cleanup job's default
+	maxCursor  time.Duration // deepest cursor age served; 0 means no cap
+	blocked    []string      // normalized blocked domains
+	sampleRate float64       // 0 means keep every match
+	quoted     bool          // also match against quoted post text
+	quotes     QuoteFilter   // whether quote posts are excluded or required
+	original   bool          // reject replies and quote posts
+
+	langMode          LangDetectionMode
+	langBases         map[string]struct{} // primary subtags of langs, for detected languages
+	minLangConfidence float64
+
+	minFollowers int                // 0 means no constraint
+	minHits      int                // distinct keywords required; 0 or 1 means any
+	minScore     float64            // summed keyword weight required; 0 means any
+	weights      map[string]float64 // keyword -> weight, for keywords not weighted 1
+	windows      []HourRange        // UTC hours posts must be created in; nil means any
+	resume       bool               // resume first pages from the requester's read position
+	webhookURL   string             // notified of saved posts; empty means none
+	public       bool               // served at /feed/{rkey}.json and .rss
+	refresh      bool               // edited posts that match are upserted
+
+	// lastMatch is when a post was last saved to the feed, in Unix
+	// nanoseconds; zero means never since startup.
+	lastMatch atomic.Int64
+
+	// threadRoots holds the ReplyRootAuthors DIDs and ReplyRootURIs whose
+	// threads' replies match; nil means none.
+	threadRoots map[string]struct{}
+
+	filterByAcceptLanguage bool
 }
 
+// matchGroup is the compiled form of a MatchGroup.
+type matchGroup struct {
+	pattern  *regexp.Regexp      // nil if the group has no keywords
+	hashtags map[string]struct{} // nil if the group has no hashtags
+}
+
+// GetFeedConfigs returns the feeds published under publisherDID. A process
+// serving several hosts calls it once per host's publisher DID.
 func GetFeedConfigs(publisherDID string) []FeedConfig {
 	return []FeedConfig{
 		NewAgenticFeedConfig(publisherDID),
@@ -44,67 +296,578 @@ func newFeedURI(publisherDID, feedName string) string {
 }
 
 func NewAgenticFeedConfig(publisherDID string) FeedConfig {
-	feedURI := newFeedURI(publisherDID, "agentic")
-	return FeedConfig{
-		URI:      feedURI,
-		Keywords: []string{"agentic", "agentic engineering", "agentic ai", "llm agents", "multi-agent", "llm benchmarks", "ai workflows", "llm orchestration", "context window", "claude", "claude opus", "claude sonnet", "claude haiku", "gpt-", "codex", "composer-1", "gemini", "hugging face", "opencode", "meta llama"},
-		Langs:    []string{"en"},
-	}
+	return NewFeed(publisherDID, "agentic").
+		WithKeywords("agentic", "agentic engineering", "agentic ai", "llm agents", "multi-agent", "llm benchmarks", "ai workflows", "llm orchestration", "context window").
+		WithKeywords("claude", "claude opus", "claude sonnet", "claude haiku", "gpt-", "codex", "composer-1", "gemini", "hugging face", "opencode", "meta llama").
+		Langs("en").
+		MustBuild()
+}
+
+// ServiceOptions tunes optional FeedService behavior. The zero value
+// disables every option.
+type ServiceOptions struct {
+	// TombstoneWindow is how long a deleted post's URI is remembered. A create
+	// event for a tombstoned URI within the window (e.g. replayed after a
+	// restart) is ignored so user-deleted posts don't resurrect. Zero disables
+	// the check.
+	TombstoneWindow time.Duration
+
+	// RetryBufferSize is the number of matched posts held in memory for
+	// retry when the repository fails to persist them, e.g. while the
+	// database is unavailable. Posts beyond the bound are dropped. Zero
+	// disables buffering.
+	RetryBufferSize int
+
+	// WriteFailurePolicy selects how failed post writes are handled. Empty
+	// means WriteFailureBuffer, bounded by RetryBufferSize.
+	WriteFailurePolicy WriteFailurePolicy
+
+	// DedupWindow and DedupSize bound the set of recently saved post URIs
+	// used to skip duplicate create events, such as ones replayed when the
+	// firehose reconnects with an overlapping cursor. Duplicates are dropped
+	// before reaching the repository and aren't reported as matches. Either
+	// zero disables deduplication.
+	DedupWindow time.Duration
+	DedupSize   int
+
+	// QuotedPosts looks up quoted post text for feeds with MatchQuotedText.
+	// Lookups are cached. nil disables quoted text matching.
+	QuotedPosts PostTextResolver
+
+	// AuthorFollowers looks up author follower counts for feeds with
+	// MinAuthorFollowers.
+	AuthorFollowers FollowersResolver
+
+	// LanguageDetector guesses the language of post text for feeds with a
+	// LangDetection mode that uses detection. It only runs on posts that
+	// such a feed could still match.
+	LanguageDetector LanguageDetector
+
+	// Webhooks delivers notifications for feeds with a WebhookURL.
+	Webhooks MatchNotifier
+
+	// ReadPositions stores requesters' positions for feeds with
+	// ResumeFromLastSeen. Positions unused for ReadPositionTTL are removed
+	// by the cleanup job, which also caps them at ReadPositionMaxRows.
+	ReadPositions       ReadPositionRepository
+	ReadPositionTTL     time.Duration
+	ReadPositionMaxRows int
+
+	// KeywordStatsWindow is the rolling window over which matches are
+	// attributed to the top-level keyword that caused them, for
+	// KeywordStats. Zero disables keyword stats.
+	KeywordStatsWindow time.Duration
+
+	// PostCounts counts each feed's indexed posts for FeedStats, which
+	// caches the counts for FeedStatsTTL. nil disables FeedStats.
+	PostCounts   PostCounter
+	FeedStatsTTL time.Duration
+
+	// MatchedPosts looks up stored posts by matched keyword for
+	// PostsMatchedBy. nil disables it.
+	MatchedPosts MatchedPostFinder
+
+	// RecentPosts lists posts with their text for PublicPosts. nil serves
+	// public feeds without post text.
+	RecentPosts RecentPostFinder
+
+	// PostUpserts writes and removes edited posts for feeds with
+	// RefreshOnEdit.
+	PostUpserts PostUpserter
+
+	// QueryGauge reports the repository's in-flight queries for Health and
+	// stats. nil leaves them out.
+	QueryGauge QueryGauge
+
+	// OnMatch, if set, is called with every new post that matches at least
+	// one feed, just before it is persisted. It runs on the firehose hot path
+	// and must not block.
+	OnMatch func(post *IncomingPost, matches []Match)
+}
+
+// Match describes one feed an incoming post was matched to.
+type Match struct {
+	FeedURI string
+
+	// Keyword is the first top-level keyword found in the post text, as it
+	// appears there. It is empty when the feed matched on RequireAll or its
+	// Matcher alone.
+	Keyword string
 }
 
 // FeedService is the core domain service. It owns the business logic for
 // matching incoming posts against feed rules, persisting matched posts, and
 // serving feed skeletons.
 type FeedService struct {
-	feeds   map[string]*feed // keyed by feed URI
-	repo    PostRepository
-	cursors CursorRepository
-	logger  *slog.Logger
+	feeds     map[string]*feed // keyed by feed URI
+	index     *keywordIndex
+	reposters map[string][]string // reposter DID -> feed URIs
+	threads   map[string][]*feed  // thread root URI or author DID -> feeds
+	repo      PostRepository
+	cursors   CursorRepository
+	opts      ServiceOptions
+	logger    *slog.Logger
+	recent    *recentURIs // nil when deduplication is disabled
+	quotes    *quoteCache // nil unless a feed matches quoted text
+
+	keywordStats *keywordStats   // nil when keyword stats are disabled
+	followers    *followersCache // nil unless a feed has MinAuthorFollowers
+	depths       *pageDepths
+	feedStats    feedStatsCache
+	tracer       tracer
+
+	pendingMu    sync.Mutex
+	pending      []pendingPost
+	dropped      int64
+	lastWriteErr error // non-nil while writes are failing
 }
 
 // NewFeedService creates a FeedService with the given feed configurations.
-func NewFeedService(configs []FeedConfig, repo PostRepository, cursors CursorRepository, logger *slog.Logger) (*FeedService, error) {
+func NewFeedService(configs []FeedConfig, repo PostRepository, cursors CursorRepository, opts ServiceOptions, logger *slog.Logger) (*FeedService, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no feed configs given")
+	}
+
 	feeds := make(map[string]*feed, len(configs))
+	seen := make(map[string]int, len(configs)) // feed URI -> index in configs
+	reposters := make(map[string][]string)     // reposter DID -> feed URIs
+	threads := make(map[string][]*feed)        // thread root URI or author DID -> feeds
 
-	for _, cfg := range configs {
-		if len(cfg.Keywords) == 0 {
-			return nil, fmt.Errorf("feed %s: at least one keyword is required", cfg.URI)
+	for i, cfg := range configs {
+		if j, ok := seen[cfg.URI]; ok {
+			return nil, fmt.Errorf("feed %s: configs %d and %d share the same URI (duplicate rkey?)", cfg.URI, j, i)
 		}
+		seen[cfg.URI] = i
 
-		escaped := make([]string, len(cfg.Keywords))
-		for i, kw := range cfg.Keywords {
-			escaped[i] = regexp.QuoteMeta(kw)
+		if len(cfg.Keywords) == 0 && len(cfg.RequireAll) == 0 && len(cfg.MentionsAny) == 0 && len(cfg.Reposters) == 0 &&
+			len(cfg.ReplyRootAuthors) == 0 && len(cfg.ReplyRootURIs) == 0 {
+			return nil, fmt.Errorf("feed %s: at least one keyword, RequireAll group, mention, reposter, or reply root is required", cfg.URI)
+		}
+		for _, m := range cfg.MentionsAny {
+			if !strings.HasPrefix(m, "did:") {
+				return nil, fmt.Errorf("feed %s: MentionsAny entry %q is not a DID (resolve handles with ResolveMentions first)", cfg.URI, m)
+			}
+		}
+		for _, did := range cfg.ReplyRootAuthors {
+			if !strings.HasPrefix(did, "did:") {
+				return nil, fmt.Errorf("feed %s: ReplyRootAuthors entry %q is not a DID", cfg.URI, did)
+			}
+		}
+		for _, uri := range cfg.ReplyRootURIs {
+			if !atURIPattern.MatchString(uri) {
+				return nil, fmt.Errorf("feed %s: ReplyRootURIs entry %q is not a valid AT-URI", cfg.URI, uri)
+			}
 		}
 
-		expr := `(?i)\b(?:` + strings.Join(escaped, "|") + `)\b`
-		pattern, err := regexp.Compile(expr)
-		if err != nil {
-			return nil, fmt.Errorf("feed %s: compile keyword pattern: %w", cfg.URI, err)
+		if err := validateWeights(cfg); err != nil {
+			return nil, fmt.Errorf("feed %s: %w", cfg.URI, err)
+		}
+		if len(cfg.KeywordAliases) > 0 {
+			if err := expandAliases(&cfg); err != nil {
+				return nil, fmt.Errorf("feed %s: KeywordAliases: %w", cfg.URI, err)
+			}
+		}
+
+		if len(cfg.Keywords) > 0 {
+			keywords, err := cleanKeywords(cfg.Keywords)
+			if err != nil {
+				return nil, fmt.Errorf("feed %s: Keywords: %w", cfg.URI, err)
+			}
+			cfg.Keywords = keywords
+		}
+
+		if cfg.MaxAge < 0 || cfg.MaxRows < 0 {
+			return nil, fmt.Errorf("feed %s: MaxAge and MaxRows must not be negative", cfg.URI)
+		}
+		if cfg.MaxCursorAge < 0 {
+			return nil, fmt.Errorf("feed %s: MaxCursorAge must not be negative", cfg.URI)
+		}
+		if cfg.MinLinks < 0 || cfg.MaxLinks < 0 {
+			return nil, fmt.Errorf("feed %s: MinLinks and MaxLinks must not be negative", cfg.URI)
+		}
+		if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+			return nil, fmt.Errorf("feed %s: SampleRate must be between 0 and 1, got %g", cfg.URI, cfg.SampleRate)
+		}
+		if cfg.MinKeywordHits < 0 || cfg.MinKeywordHits > max(len(cfg.Keywords), 1) {
+			return nil, fmt.Errorf("feed %s: MinKeywordHits must be between 0 and the number of Keywords (%d), got %d", cfg.URI, len(cfg.Keywords), cfg.MinKeywordHits)
+		}
+		for _, w := range cfg.TimeWindows {
+			if err := w.validate(); err != nil {
+				return nil, fmt.Errorf("feed %s: TimeWindows: %w", cfg.URI, err)
+			}
+		}
+		if err := cfg.Quotes.validate(); err != nil {
+			return nil, fmt.Errorf("feed %s: Quotes: %w", cfg.URI, err)
+		}
+		if cfg.OriginalOnly {
+			switch {
+			case cfg.Quotes == QuotesOnly:
+				return nil, fmt.Errorf("feed %s: OriginalOnly excludes quote posts and can't be combined with QuotesOnly", cfg.URI)
+			case len(cfg.Reposters) > 0:
+				return nil, fmt.Errorf("feed %s: OriginalOnly excludes reposts and can't be combined with Reposters", cfg.URI)
+			case len(cfg.ReplyRootAuthors) > 0 || len(cfg.ReplyRootURIs) > 0:
+				return nil, fmt.Errorf("feed %s: OriginalOnly excludes replies and can't be combined with ReplyRootAuthors or ReplyRootURIs", cfg.URI)
+			}
+		}
+		if err := cfg.LangDetection.validate(); err != nil {
+			return nil, fmt.Errorf("feed %s: LangDetection: %w", cfg.URI, err)
+		}
+		if cfg.MinLangConfidence < 0 || cfg.MinLangConfidence > 1 {
+			return nil, fmt.Errorf("feed %s: MinLangConfidence must be between 0 and 1, got %v", cfg.URI, cfg.MinLangConfidence)
+		}
+		if cfg.LangDetection.usesDetection() {
+			if len(cfg.Langs) == 0 {
+				return nil, fmt.Errorf("feed %s: LangDetection %q requires Langs", cfg.URI, cfg.LangDetection)
+			}
+			if opts.LanguageDetector == nil {
+				return nil, fmt.Errorf("feed %s: LangDetection %q requires a LanguageDetector", cfg.URI, cfg.LangDetection)
+			}
+			if undetectable := undetectableLangs(cfg.Langs, opts.LanguageDetector); len(undetectable) > 0 {
+				return nil, fmt.Errorf("feed %s: LangDetection %q can't work for Langs %q: the language detector never reports them", cfg.URI, cfg.LangDetection, undetectable)
+			}
+		}
+		if cfg.MinAuthorFollowers < 0 {
+			return nil, fmt.Errorf("feed %s: MinAuthorFollowers must not be negative", cfg.URI)
+		}
+		if cfg.RefreshOnEdit && opts.PostUpserts == nil {
+			return nil, fmt.Errorf("feed %s: RefreshOnEdit requires a PostUpserts writer", cfg.URI)
+		}
+		if cfg.MinAuthorFollowers > 0 && opts.AuthorFollowers == nil {
+			return nil, fmt.Errorf("feed %s: MinAuthorFollowers requires an AuthorFollowers resolver", cfg.URI)
+		}
+		if cfg.WebhookURL != "" {
+			if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("feed %s: WebhookURL %q is not an http or https URL", cfg.URI, cfg.WebhookURL)
+			}
+			if opts.Webhooks == nil {
+				return nil, fmt.Errorf("feed %s: WebhookURL requires a Webhooks notifier", cfg.URI)
+			}
+		}
+		if cfg.ResumeFromLastSeen && opts.ReadPositions == nil {
+			return nil, fmt.Errorf("feed %s: ResumeFromLastSeen requires a ReadPositions repository", cfg.URI)
+		}
+		if cfg.MaxLinks > 0 && cfg.MinLinks > cfg.MaxLinks {
+			return nil, fmt.Errorf("feed %s: MinLinks (%d) exceeds MaxLinks (%d)", cfg.URI, cfg.MinLinks, cfg.MaxLinks)
+		}
+
+		for _, uri := range cfg.PinnedPosts {
+			if !atURIPattern.MatchString(uri) {
+				return nil, fmt.Errorf("feed %s: pinned post %q is not a valid AT-URI", cfg.URI, uri)
+			}
 		}
 
 		f := &feed{
-			uri:     cfg.URI,
-			pattern: pattern,
+			uri:        cfg.URI,
+			name:       cfg.DisplayName,
+			pinned:     cfg.PinnedPosts,
+			maxAge:     cfg.MaxAge,
+			maxRows:    cfg.MaxRows,
+			maxCursor:  cfg.MaxCursorAge,
+			blocked:    normalizeDomains(cfg.BlockedDomains),
+			minLinks:   cfg.MinLinks,
+			maxLinks:   cfg.MaxLinks,
+			matcher:    cfg.Matcher,
+			sampleRate: cfg.SampleRate,
+			quoted:     cfg.MatchQuotedText,
+			quotes:     cfg.Quotes,
+			original:   cfg.OriginalOnly,
+
+			langMode:          cfg.LangDetection,
+			minLangConfidence: cfg.MinLangConfidence,
+
+			minFollowers: cfg.MinAuthorFollowers,
+			minHits:      cfg.MinKeywordHits,
+			minScore:     cfg.MinScore,
+			weights:      keywordWeights(cfg),
+			windows:      cfg.TimeWindows,
+			resume:       cfg.ResumeFromLastSeen,
+			webhookURL:   cfg.WebhookURL,
+			public:       cfg.Public,
+			refresh:      cfg.RefreshOnEdit,
+
+			filterByAcceptLanguage: cfg.FilterByAcceptLanguage,
+		}
+
+		if len(cfg.Keywords) > 0 {
+			pattern, err := compileKeywords(cfg.Keywords, cfg.CaseSensitive)
+			if err != nil {
+				return nil, fmt.Errorf("feed %s: %w", cfg.URI, err)
+			}
+			f.pattern = pattern
+			f.keywords = cfg.Keywords
+		}
+
+		for i, g := range cfg.RequireAll {
+			if len(g.Keywords) == 0 && len(g.Hashtags) == 0 {
+				return nil, fmt.Errorf("feed %s: RequireAll group %d is empty", cfg.URI, i)
+			}
+			var mg matchGroup
+			if len(g.Keywords) > 0 {
+				keywords, err := cleanKeywords(g.Keywords)
+				if err != nil {
+					return nil, fmt.Errorf("feed %s: RequireAll group %d: %w", cfg.URI, i, err)
+				}
+				pattern, err := compileKeywords(keywords, cfg.CaseSensitive)
+				if err != nil {
+					return nil, fmt.Errorf("feed %s: RequireAll group %d: %w", cfg.URI, i, err)
+				}
+				mg.pattern = pattern
+			}
+			if len(g.Hashtags) > 0 {
+				mg.hashtags = make(map[string]struct{}, len(g.Hashtags))
+				for _, tag := range g.Hashtags {
+					mg.hashtags[normalizeTag(tag)] = struct{}{}
+				}
+			}
+			f.requireAll = append(f.requireAll, mg)
+		}
+
+		if len(cfg.MentionsAny) > 0 {
+			f.mentions = make(map[string]struct{}, len(cfg.MentionsAny))
+			for _, did := range cfg.MentionsAny {
+				f.mentions[did] = struct{}{}
+			}
 		}
 
 		if len(cfg.Langs) > 0 {
 			f.langs = make(map[string]struct{}, len(cfg.Langs))
+			f.langBases = make(map[string]struct{}, len(cfg.Langs))
 			for _, l := range cfg.Langs {
 				f.langs[l] = struct{}{}
+				f.langBases[langBase(l)] = struct{}{}
+			}
+		}
+
+		for _, did := range cfg.Reposters {
+			reposters[did] = append(reposters[did], cfg.URI)
+		}
+
+		if n := len(cfg.ReplyRootAuthors) + len(cfg.ReplyRootURIs); n > 0 {
+			f.threadRoots = make(map[string]struct{}, n)
+			for _, root := range slices.Concat(cfg.ReplyRootAuthors, cfg.ReplyRootURIs) {
+				if _, dup := f.threadRoots[root]; !dup {
+					f.threadRoots[root] = struct{}{}
+					threads[root] = append(threads[root], f)
+				}
 			}
 		}
 
 		feeds[cfg.URI] = f
 	}
 
+	var recent *recentURIs
+	if opts.DedupWindow > 0 && opts.DedupSize > 0 {
+		recent = newRecentURIs(opts.DedupWindow, opts.DedupSize)
+	}
+
+	var quotes *quoteCache
+	for _, f := range feeds {
+		if f.quoted && opts.QuotedPosts != nil {
+			quotes = newQuoteCache()
+			break
+		}
+	}
+
+	var followers *followersCache
+	for _, f := range feeds {
+		if f.minFollowers > 0 {
+			followers = newFollowersCache(opts.AuthorFollowers)
+			break
+		}
+	}
+
+	var kwStats *keywordStats
+	if opts.KeywordStatsWindow > 0 {
+		kwStats = newKeywordStats(opts.KeywordStatsWindow)
+	}
+
 	return &FeedService{
-		feeds:   feeds,
-		repo:    repo,
-		cursors: cursors,
-		logger:  logger,
+		quotes:    quotes,
+		feeds:     feeds,
+		index:     newKeywordIndex(feeds),
+		reposters: reposters,
+		threads:   threads,
+		repo:      repo,
+		cursors:   cursors,
+		opts:      opts,
+		logger:    logger,
+		recent:    recent,
+
+		keywordStats: kwStats,
+		followers:    followers,
+		depths:       newPageDepths(),
 	}, nil
 }
 
+// cleanKeywords trims surrounding whitespace from keywords and drops the ones
+// left empty. It returns an error if none are left, or if a keyword could
+// never match between the word boundaries compileKeywords puts around it:
+// one with no letters or digits, or one that starts or ends with a non-ASCII
+// letter or digit such as "日本" or "café", since regexp's \b only treats
+// ASCII letters, digits and '_' as word characters.
+func cleanKeywords(keywords []string) ([]string, error) {
+	cleaned := make([]string, 0, len(keywords))
+	for _, kw := range keywords {
+		kw = strings.TrimSpace(kw)
+		if kw == "" {
+			continue
+		}
+		if !strings.ContainsFunc(kw, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			return nil, fmt.Errorf("keyword %q has no letters or digits", kw)
+		}
+		first, _ := utf8.DecodeRuneInString(kw)
+		last, _ := utf8.DecodeLastRuneInString(kw)
+		if nonASCIIWordRune(first) || nonASCIIWordRune(last) {
+			return nil, fmt.Errorf("keyword %q starts or ends with a non-ASCII letter or digit, so it can never match: word boundaries only recognize ASCII letters, digits and '_'", kw)
+		}
+		cleaned = append(cleaned, kw)
+	}
+	if len(cleaned) == 0 {
+		return nil, errors.New("no usable keywords after removing blank entries")
+	}
+	return cleaned, nil
+}
+
+// nonASCIIWordRune reports whether r is a letter or digit that regexp's \b
+// doesn't count as a word character.
+func nonASCIIWordRune(r rune) bool {
+	return r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// expandAliases adds the KeywordAliases of every keyword in cfg.Keywords and
+// its RequireAll groups right after the keyword. It returns an error for an
+// alias key that isn't one of those keywords or an alias that could never
+// match. cfg.RequireAll is replaced rather than modified, since it shares its
+// backing array with the caller's config.
+func expandAliases(cfg *FeedConfig) error {
+	used := make(map[string]bool, len(cfg.KeywordAliases))
+	for canonical, aliases := range cfg.KeywordAliases {
+		if _, err := cleanKeywords(aliases); err != nil {
+			return fmt.Errorf("%q: %w", canonical, err)
+		}
+		used[strings.TrimSpace(canonical)] = false
+	}
+
+	expand := func(keywords []string) []string {
+		var expanded []string
+		for _, kw := range keywords {
+			expanded = append(expanded, kw)
+			for canonical, aliases := range cfg.KeywordAliases {
+				if strings.TrimSpace(canonical) == strings.TrimSpace(kw) {
+					used[strings.TrimSpace(canonical)] = true
+					expanded = append(expanded, aliases...)
+				}
+			}
+		}
+		return expanded
+	}
+
+	cfg.Keywords = expand(cfg.Keywords)
+	groups := make([]MatchGroup, len(cfg.RequireAll))
+	for i, g := range cfg.RequireAll {
+		groups[i] = MatchGroup{Keywords: expand(g.Keywords), Hashtags: g.Hashtags}
+	}
+	cfg.RequireAll = groups
+
+	for canonical, ok := range used {
+		if !ok {
+			return fmt.Errorf("%q is not one of the feed's keywords", canonical)
+		}
+	}
+	return nil
+}
+
+// validateWeights checks cfg's KeywordWeights and MinScore against its
+// Keywords, before aliases are expanded. Weight keys name keywords the way matching does: ignoring case
+// unless the feed is CaseSensitive.
+func validateWeights(cfg FeedConfig) error {
+	if cfg.MinScore < 0 {
+		return fmt.Errorf("MinScore must not be negative, got %g", cfg.MinScore)
+	}
+	if cfg.MinScore > 0 && len(cfg.Keywords) == 0 {
+		return errors.New("MinScore requires Keywords")
+	}
+	seen := make([]string, 0, len(cfg.KeywordWeights))
+	for kw, w := range cfg.KeywordWeights {
+		if !slices.ContainsFunc(cfg.Keywords, func(k string) bool { return sameKeyword(k, kw, cfg.CaseSensitive) }) {
+			return fmt.Errorf("KeywordWeights: %q is not one of the feed's Keywords", kw)
+		}
+		if w <= 0 {
+			return fmt.Errorf("KeywordWeights: weight of %q must be positive, got %g", kw, w)
+		}
+		if i := slices.IndexFunc(seen, func(k string) bool { return sameKeyword(k, kw, cfg.CaseSensitive) }); i >= 0 {
+			return fmt.Errorf("KeywordWeights: %q and %q weigh the same keyword", seen[i], kw)
+		}
+		seen = append(seen, kw)
+	}
+	return nil
+}
+
+// sameKeyword reports whether a and b name the same keyword, ignoring
+// surrounding space and, unless caseSensitive is set, case.
+func sameKeyword(a, b string, caseSensitive bool) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if caseSensitive {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// keywordWeights returns the weight of each weighted keyword and of its
+// aliases, keyed as the keywords appear in cfg.Keywords once cleaned, or nil
+// if none are weighted.
+func keywordWeights(cfg FeedConfig) map[string]float64 {
+	if len(cfg.KeywordWeights) == 0 {
+		return nil
+	}
+	out := make(map[string]float64, len(cfg.KeywordWeights))
+	set := func(name string, w float64) {
+		for _, kw := range cfg.Keywords {
+			if sameKeyword(kw, name, cfg.CaseSensitive) {
+				out[kw] = w
+			}
+		}
+	}
+	for name, w := range cfg.KeywordWeights {
+		set(name, w)
+		for canonical, list := range cfg.KeywordAliases {
+			if !sameKeyword(canonical, name, cfg.CaseSensitive) {
+				continue
+			}
+			for _, alias := range list {
+				set(alias, w)
+			}
+		}
+	}
+	return out
+}
+
+// compileKeywords builds a word-bounded alternation of the given keywords,
+// ignoring case unless caseSensitive is set. Longer keywords come first so
+// that a match reports the most specific keyword at its position.
+func compileKeywords(keywords []string, caseSensitive bool) (*regexp.Regexp, error) {
+	escaped := make([]string, len(keywords))
+	for i, kw := range keywords {
+		escaped[i] = regexp.QuoteMeta(kw)
+	}
+	slices.SortStableFunc(escaped, func(a, b string) int { return len(b) - len(a) })
+
+	expr := `\b(?:` + strings.Join(escaped, "|") + `)\b`
+	if !caseSensitive {
+		expr = `(?i)` + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("compile keyword pattern: %w", err)
+	}
+	return pattern, nil
+}
+
+// normalizeTag lowercases a hashtag and strips its leading '#'.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
 // FeedURIs returns the AT-URIs of all registered feeds.
 func (s *FeedService) FeedURIs() []string {
 	uris := make([]string, 0, len(s.feeds))
@@ -115,27 +878,108 @@ func (s *FeedService) FeedURIs() []string {
 }
 
 // ProcessNewPost checks an incoming post against all feed rules. If any feed
-// matches, the post is persisted. Returns true if the post was saved.
-func (s *FeedService) ProcessNewPost(ctx context.Context, incoming *IncomingPost) (bool, error) {
+// matches, the post is persisted. Returns the URIs of the feeds the post was
+// saved to, or nil if it matched none.
+func (s *FeedService) ProcessNewPost(ctx context.Context, incoming *IncomingPost) ([]string, error) {
 	feedURIs := s.matchingFeeds(incoming)
+	quoted := s.wantsQuotedText(incoming, feedURIs)
+	if len(feedURIs) == 0 && !quoted {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	if s.recent != nil && s.recent.contains(incoming.URI, now) {
+		s.logger.Debug("ignoring duplicate create", "uri", incoming.URI)
+		return nil, nil
+	}
+
+	if quoted {
+		feedURIs = s.matchWithQuotedText(ctx, incoming, feedURIs)
+	}
+	feedURIs = s.filterByFollowers(ctx, incoming.AuthorDID, feedURIs)
 	if len(feedURIs) == 0 {
-		return false, nil
+		return nil, nil
+	}
+
+	if tombstoned, err := s.isTombstoned(ctx, incoming.URI); err != nil || tombstoned {
+		return nil, err
+	}
+
+	if s.opts.OnMatch != nil || s.keywordStats != nil {
+		matches := s.describeMatches(incoming, feedURIs)
+		if s.keywordStats != nil {
+			s.recordKeywords(matches, now)
+		}
+		if s.opts.OnMatch != nil {
+			s.opts.OnMatch(incoming, matches)
+		}
 	}
 
 	post := &Post{
 		URI:       incoming.URI,
 		CID:       incoming.CID,
-		IndexedAt: time.Now().UTC(),
+		IndexedAt: now,
+		AuthorDID: incoming.AuthorDID,
+		Text:      incoming.Text,
+		Langs:     NormalizeLangs(incoming.Langs),
+
+		MatchedKeywords: s.matchedKeywords(incoming, feedURIs),
+	}
+	saved, err := s.savePost(ctx, post, feedURIs)
+	if err != nil {
+		return nil, err
 	}
+	if s.recent != nil {
+		s.recent.add(incoming.URI, now)
+	}
+	for _, uri := range saved {
+		if hook := s.feeds[uri].webhookURL; hook != "" {
+			s.opts.Webhooks.NotifyMatch(hook, uri, incoming)
+		}
+	}
+	return saved, nil
+}
+
+// isTombstoned reports whether uri was deleted within the tombstone window,
+// so a replayed create for it should be ignored.
+func (s *FeedService) isTombstoned(ctx context.Context, uri string) (bool, error) {
+	if s.opts.TombstoneWindow <= 0 {
+		return false, nil
+	}
+	since := time.Now().UTC().Add(-s.opts.TombstoneWindow)
+	tombstoned, err := s.repo.IsTombstoned(ctx, uri, since)
+	if err != nil {
+		return false, fmt.Errorf("%w: check tombstone: %w", ErrWriteFailed, err)
+	}
+	if tombstoned {
+		s.logger.Debug("ignoring create for deleted post", "uri", uri)
+	}
+	return tombstoned, nil
+}
+
+// savePost persists post to the given feeds, buffering it for retry if the
+// repository fails. It returns the feed URIs the post was saved (or
+// buffered) to.
+func (s *FeedService) savePost(ctx context.Context, post *Post, feedURIs []string) ([]string, error) {
 	if err := s.repo.CreatePost(ctx, post, feedURIs); err != nil {
-		return false, fmt.Errorf("create post: %w", err)
+		if s.bufferFailedPost(post, feedURIs, err) {
+			s.logger.Warn("create post failed, buffered for retry", "uri", post.URI, "error", err)
+			s.markMatched(feedURIs, post.IndexedAt)
+			return feedURIs, nil
+		}
+		return nil, fmt.Errorf("%w: create post: %w", ErrWriteFailed, err)
 	}
-	return true, nil
+	s.writeSucceeded()
+	s.markMatched(feedURIs, post.IndexedAt)
+	return feedURIs, nil
 }
 
 // ProcessDeletePost removes a post by URI.
 func (s *FeedService) ProcessDeletePost(ctx context.Context, uri string) error {
-	return s.repo.DeletePost(ctx, uri)
+	if err := s.repo.DeletePost(ctx, uri); err != nil {
+		return fmt.Errorf("%w: delete post: %w", ErrWriteFailed, err)
+	}
+	return nil
 }
 
 // GetCursor retrieves the last-processed firehose cursor for the given service.
@@ -149,37 +993,172 @@ func (s *FeedService) UpdateCursor(ctx context.Context, service string, cursor i
 }
 
 // GetFeedSkeleton returns a page of the feed skeleton for the given feed URI.
-func (s *FeedService) GetFeedSkeleton(ctx context.Context, feedURI string, limit int, cursor string) (*FeedSkeleton, error) {
-	s.logger.Debug("GetFeedSkeleton called", "feedURI", feedURI, "limit", limit, "cursor", cursor)
+// acceptLangs are the requester's preferred languages; they only filter the
+// page for feeds with FilterByAcceptLanguage set. requesterDID identifies the
+// requester, or is empty if unknown; it is only used by feeds with
+// ResumeFromLastSeen. A known feed with no posts yet gets an empty page, not
+// an error, so a newly published feed passes Bluesky's validity check.
+func (s *FeedService) GetFeedSkeleton(ctx context.Context, feedURI string, limit int, cursor string, acceptLangs []string, requesterDID string) (*FeedSkeleton, error) {
+	logger := logctx.From(ctx, s.logger)
+	logger.Debug("GetFeedSkeleton called", "feedURI", feedURI, "limit", limit, "cursor", cursor, "accept_langs", acceptLangs, "requester", requesterDID)
 
-	if _, ok := s.feeds[feedURI]; !ok {
-		s.logger.Warn("unknown feed requested", "feedURI", feedURI, "registered_feeds", s.FeedURIs())
+	f, ok := s.feeds[feedURI]
+	if !ok {
+		logger.Warn("unknown feed requested", "feedURI", feedURI, "registered_feeds", s.FeedURIs())
 		return nil, fmt.Errorf("%w: %s", ErrUnknownFeed, feedURI)
 	}
+	now := time.Now()
+	s.depths.record(feedURI, cursor, now)
+	if f.cursorTooDeep(cursor, now) {
+		logger.Debug("cursor is older than MaxCursorAge, ending pagination", "feedURI", feedURI, "cursor", cursor)
+		return &FeedSkeleton{Posts: []SkeletonPost{}}, nil
+	}
 
-	s.logger.Debug("feed validated, querying repository", "feedURI", feedURI)
+	var langs []string
+	if f.filterByAcceptLanguage {
+		langs = NormalizeLangs(acceptLangs)
+	}
 
-	posts, nextCursor, err := s.repo.GetFeedPosts(ctx, feedURI, limit, cursor)
-	if err != nil {
-		s.logger.Error("repository query failed", "feedURI", feedURI, "limit", limit, "cursor", cursor, "error", err)
-		return nil, fmt.Errorf("get feed posts: %w", err)
+	// Pinned posts lead the first page and take up part of its limit.
+	var pinned []string
+	if cursor == "" {
+		pinned = f.pinned
+		if len(pinned) > limit {
+			pinned = pinned[:limit]
+		}
+	}
+	organicLimit := max(limit-len(pinned), 0)
+
+	resume := f.resume && requesterDID != ""
+	resumed := false
+	if resume && cursor == "" {
+		cursor = s.readPosition(ctx, requesterDID, feedURI)
+		if f.cursorTooDeep(cursor, now) {
+			cursor = "" // the saved position is past the cap; start over
+		}
+		resumed = cursor != ""
+	}
+
+	logger.Debug("feed validated, querying repository", "feedURI", feedURI, "langs", langs)
+
+	var (
+		posts      []Post
+		nextCursor string
+	)
+	if organicLimit == 0 {
+		// Pins fill the page. The next page starts with the organic posts,
+		// from the reader's saved position if resuming.
+		nextCursor = cursor
+		if nextCursor == "" {
+			nextCursor = topCursor(now)
+		}
+	} else {
+		var err error
+		posts, nextCursor, err = s.repo.GetFeedPosts(ctx, feedURI, organicLimit, cursor, langs)
+		if err == nil && resumed && len(posts) == 0 {
+			// Nothing left past the saved position; start over from the top.
+			cursor = ""
+			posts, nextCursor, err = s.repo.GetFeedPosts(ctx, feedURI, organicLimit, cursor, langs)
+		}
+		if err != nil {
+			logger.Error("repository query failed", "feedURI", feedURI, "limit", limit, "cursor", cursor, "error", err)
+			return nil, fmt.Errorf("get feed posts: %w", err)
+		}
+		if resume {
+			s.saveReadPosition(ctx, requesterDID, feedURI, nextCursor)
+		}
 	}
 
-	s.logger.Debug("repository query succeeded", "posts_count", len(posts), "next_cursor", nextCursor)
+	logger.Debug("repository query succeeded", "posts_count", len(posts), "next_cursor", nextCursor)
 
 	skeleton := &FeedSkeleton{
 		Cursor: nextCursor,
-		Posts:  make([]SkeletonPost, len(posts)),
+		Posts:  make([]SkeletonPost, 0, len(pinned)+len(posts)),
 	}
-	for i, p := range posts {
-		skeleton.Posts[i] = SkeletonPost{Post: p.URI}
+	for _, uri := range pinned {
+		skeleton.Posts = append(skeleton.Posts, SkeletonPost{
+			Post:   uri,
+			Reason: &SkeletonReason{Type: ReasonPin},
+		})
+	}
+	for _, p := range posts {
+		// Pinned posts are never repeated organically, on any page. The
+		// cursor still comes from the repository page, so skipping them
+		// doesn't affect pagination.
+		if slices.Contains(f.pinned, p.URI) {
+			continue
+		}
+		item := SkeletonPost{Post: p.URI}
+		if p.RepostURI != "" {
+			item.Reason = &SkeletonReason{Type: ReasonRepost, Repost: p.RepostURI}
+		}
+		skeleton.Posts = append(skeleton.Posts, item)
 	}
 	return skeleton, nil
 }
 
-// StartCleanupJob runs a background loop that removes posts older than maxAge
-// and caps the total at maxRows. It runs immediately on start and then repeats
-// at the given interval. It blocks until ctx is cancelled.
+// cursorTooDeep reports whether cursor points further back than the feed's
+// MaxCursorAge as of now.
+func (f *feed) cursorTooDeep(cursor string, now time.Time) bool {
+	if f.maxCursor <= 0 || cursor == "" {
+		return false
+	}
+	at, ok := cursorTime(cursor)
+	return ok && now.Sub(at) > f.maxCursor
+}
+
+// PublicPosts returns the newest limit posts of a feed configured as Public,
+// newest first, for serving outside Bluesky. The posts carry their text and
+// author if a RecentPosts finder is configured. Pinned posts and
+// per-requester filtering don't apply. Feeds that aren't public are reported
+// as ErrUnknownFeed.
+func (s *FeedService) PublicPosts(ctx context.Context, feedURI string, limit int) ([]Post, error) {
+	f, ok := s.feeds[feedURI]
+	if !ok || !f.public {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFeed, feedURI)
+	}
+	if s.opts.RecentPosts != nil {
+		posts, err := s.opts.RecentPosts.RecentPosts(ctx, feedURI, limit)
+		if err != nil {
+			return nil, fmt.Errorf("get public feed posts: %w", err)
+		}
+		return posts, nil
+	}
+	posts, _, err := s.repo.GetFeedPosts(ctx, feedURI, limit, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("get public feed posts: %w", err)
+	}
+	return posts, nil
+}
+
+// PostsMatchedBy returns up to limit of the feed's stored posts that matched
+// keyword, newest first. keyword is compared the way the feed matches, so
+// for a case-insensitive feed "Claude" finds posts matched by "claude".
+func (s *FeedService) PostsMatchedBy(ctx context.Context, feedURI, keyword string, limit int) ([]Post, error) {
+	f, ok := s.feeds[feedURI]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFeed, feedURI)
+	}
+	if s.opts.MatchedPosts == nil {
+		return nil, errors.New("matched post lookups require a MatchedPosts finder")
+	}
+	keyword = strings.TrimSpace(keyword)
+	// Keywords since removed from the config are still looked up as given.
+	if kw := f.configuredKeyword(keyword); kw != "" {
+		keyword = kw
+	}
+	posts, err := s.opts.MatchedPosts.PostsMatchedBy(ctx, feedURI, keyword, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get posts matched by %q: %w", keyword, err)
+	}
+	return posts, nil
+}
+
+// StartCleanupJob runs a background loop that, for each feed, removes posts
+// older than the feed's MaxAge and caps it at the feed's MaxRows, falling back
+// to maxAge and maxRows for feeds that don't set their own. It runs
+// immediately on start and then repeats at the given interval. It blocks
+// until ctx is cancelled.
 func (s *FeedService) StartCleanupJob(ctx context.Context, interval time.Duration, maxAge time.Duration, maxRows int) {
 	s.runCleanup(ctx, maxAge, maxRows)
 
@@ -195,44 +1174,299 @@ func (s *FeedService) StartCleanupJob(ctx context.Context, interval time.Duratio
 	}
 }
 
-func (s *FeedService) runCleanup(ctx context.Context, maxAge time.Duration, maxRows int) {
+// runCleanup applies retention to every feed and returns the number of posts
+// deleted per feed URI. Feeds whose cleanup failed entirely are omitted;
+// partially failed feeds report what was deleted.
+func (s *FeedService) runCleanup(ctx context.Context, maxAge time.Duration, maxRows int) map[string]int64 {
+	deletedByFeed := make(map[string]int64, len(s.feeds))
 	var totalDeleted int64
-	for uri := range s.feeds {
-		deleted, err := s.repo.DeleteOldPosts(ctx, uri, maxAge, maxRows)
+	for uri, f := range s.feeds {
+		feedMaxAge, feedMaxRows := maxAge, maxRows
+		if f.maxAge > 0 {
+			feedMaxAge = f.maxAge
+		}
+		if f.maxRows > 0 {
+			feedMaxRows = f.maxRows
+		}
+
+		result, err := s.repo.DeleteOldPosts(ctx, uri, feedMaxAge, feedMaxRows)
 		if err != nil {
-			s.logger.Error("post cleanup failed", "feedURI", uri, "error", err)
-		} else {
+			s.logger.Error("post cleanup failed",
+				"feedURI", uri,
+				"expired_deleted", result.ExpiredDeleted,
+				"expired_error", result.ExpiredErr,
+				"excess_deleted", result.ExcessDeleted,
+				"excess_error", result.ExcessErr,
+			)
+		}
+		if deleted := result.Deleted(); deleted > 0 || err == nil {
+			deletedByFeed[uri] = deleted
 			totalDeleted += deleted
 		}
 	}
 	if totalDeleted > 0 {
-		s.logger.Info("post cleanup complete", "deleted", totalDeleted)
+		perFeed := make([]any, 0, len(deletedByFeed))
+		for uri, n := range deletedByFeed {
+			perFeed = append(perFeed, slog.Int64(uri, n))
+		}
+		s.logger.Info("post cleanup complete", "deleted", totalDeleted, slog.Group("deleted_by_feed", perFeed...))
+	}
+
+	if s.opts.TombstoneWindow > 0 {
+		cutoff := time.Now().UTC().Add(-s.opts.TombstoneWindow)
+		if _, err := s.repo.DeleteTombstonesBefore(ctx, cutoff); err != nil {
+			s.logger.Error("tombstone cleanup failed", "error", err)
+		}
+	}
+
+	if s.opts.ReadPositions != nil && s.opts.ReadPositionTTL > 0 {
+		cutoff := time.Now().UTC().Add(-s.opts.ReadPositionTTL)
+		if _, err := s.opts.ReadPositions.DeleteReadPositions(ctx, cutoff, s.opts.ReadPositionMaxRows); err != nil {
+			s.logger.Error("read position cleanup failed", "error", err)
+		}
 	}
+
+	return deletedByFeed
 }
 
 // matchingFeeds returns the URIs of all feeds that match the incoming post.
+// Only feeds the keyword index can't rule out are checked in full.
 func (s *FeedService) matchingFeeds(incoming *IncomingPost) []string {
+	candidates := s.index.candidates(incoming.Text)
+	for _, f := range s.threadCandidates(incoming) {
+		if !containsFeed(candidates, f) {
+			candidates = append(candidates, f)
+		}
+	}
+	if incoming.QuotedText != "" {
+		for _, f := range s.index.candidates(incoming.QuotedText) {
+			if f.quoted && !containsFeed(candidates, f) {
+				candidates = append(candidates, f)
+			}
+		}
+	}
+
+	s.detectLanguage(incoming, candidates)
+
 	var matched []string
-	for _, f := range s.feeds {
-		if matchesFeed(f, incoming) {
+	for _, f := range candidates {
+		if matchesFeed(f, incoming) && f.sampled(incoming.URI) {
 			matched = append(matched, f.uri)
 		}
 	}
+	if s.tracer.enabled.Load() {
+		s.tracePost(incoming, candidates, matched)
+	}
+	return matched
+}
+
+// describeMatches builds the Match for each feed URI the post matched.
+func (s *FeedService) describeMatches(incoming *IncomingPost, feedURIs []string) []Match {
+	matches := make([]Match, len(feedURIs))
+	for i, uri := range feedURIs {
+		matches[i].FeedURI = uri
+		if f := s.feeds[uri]; f.pattern != nil {
+			matches[i].Keyword = f.pattern.FindString(f.searchText(incoming))
+		}
+	}
+	return matches
+}
+
+// matchedKeywords returns the top-level keywords incoming matched in each of
+// feedURIs, omitting feeds it matched without one.
+func (s *FeedService) matchedKeywords(incoming *IncomingPost, feedURIs []string) map[string][]string {
+	var matched map[string][]string
+	for _, uri := range feedURIs {
+		if keywords := s.feeds[uri].matchedKeywords(incoming); len(keywords) > 0 {
+			if matched == nil {
+				matched = make(map[string][]string, len(feedURIs))
+			}
+			matched[uri] = keywords
+		}
+	}
 	return matched
 }
 
 func matchesFeed(f *feed, incoming *IncomingPost) bool {
+	matched := matchesRules(f, incoming)
+	if f.matcher != nil {
+		return f.matcher(incoming, matched)
+	}
+	return matched
+}
+
+// matchesRules applies the feed's built-in keyword, language, and RequireAll
+// rules.
+func matchesRules(f *feed, incoming *IncomingPost) bool {
+	return ruleFailure(f, incoming) == ""
+}
+
+// ruleFailure returns the first of the feed's built-in rules the post fails,
+// or "" if it passes them all. The names appear in trace logs.
+func ruleFailure(f *feed, incoming *IncomingPost) string {
+	if !f.hasTextRules() && f.threadRoots == nil {
+		return "reposts_only"
+	}
 	if f.langs != nil {
-		matched := false
-		for _, l := range incoming.Langs {
-			if _, ok := f.langs[l]; ok {
-				matched = true
-				break
+		if reason := f.langFailure(incoming); reason != "" {
+			return reason
+		}
+	}
+	if len(f.windows) > 0 && !inTimeWindows(f.windows, incoming.CreatedAt) {
+		return "time_windows"
+	}
+	if f.minLinks > 0 && incoming.LinkCount < f.minLinks {
+		return "min_links"
+	}
+	if f.maxLinks > 0 && incoming.LinkCount > f.maxLinks {
+		return "max_links"
+	}
+	if len(f.blocked) > 0 && linksBlockedDomain(incoming.Links, f.blocked) {
+		return "blocked_domains"
+	}
+	if f.quotes.rejects(incoming) {
+		return "quotes"
+	}
+	if f.original && (incoming.IsQuote || incoming.ReplyRootURI != "") {
+		return "original_only"
+	}
+	if f.inWatchedThread(incoming) {
+		return ""
+	}
+	if !f.hasTextRules() {
+		return "reply_root"
+	}
+	if f.mentions != nil && !mentionsAny(f.mentions, incoming.Mentions) {
+		return "mentions_any"
+	}
+	text := f.searchText(incoming)
+	if f.pattern != nil {
+		if f.minHits > 1 {
+			if !f.hasKeywordHits(text, f.minHits) {
+				return "min_keyword_hits"
 			}
+		} else if !f.pattern.MatchString(text) {
+			return "keywords"
+		}
+		if f.minScore > 0 && f.keywordScore(text) < f.minScore {
+			return "min_score"
+		}
+	}
+	for i := range f.requireAll {
+		if !f.requireAll[i].matches(text, incoming.Tags) {
+			return "require_all"
+		}
+	}
+	return ""
+}
+
+// hasKeywordHits reports whether text contains at least n distinct
+// top-level keywords.
+func (f *feed) hasKeywordHits(text string, n int) bool {
+	hits := make(map[string]struct{}, n)
+	for _, found := range f.pattern.FindAllString(text, -1) {
+		hits[f.configuredKeyword(found)] = struct{}{}
+		if len(hits) >= n {
+			return true
 		}
-		if !matched {
-			return false
+	}
+	return false
+}
+
+// keywordScore returns the summed weights of the distinct top-level keywords
+// in text.
+func (f *feed) keywordScore(text string) float64 {
+	seen := make(map[string]struct{})
+	var score float64
+	for _, found := range f.pattern.FindAllString(text, -1) {
+		kw := f.configuredKeyword(found)
+		if _, ok := seen[kw]; ok || kw == "" {
+			continue
+		}
+		seen[kw] = struct{}{}
+		if w, ok := f.weights[kw]; ok {
+			score += w
+		} else {
+			score++
+		}
+	}
+	return score
+}
+
+// searchText returns the text the feed's keywords are matched against: the
+// post text, followed by the quoted post's text for feeds that match quotes.
+func (f *feed) searchText(incoming *IncomingPost) string {
+	if f.quoted && incoming.QuotedText != "" {
+		return incoming.Text + "\n" + incoming.QuotedText
+	}
+	return incoming.Text
+}
+
+// normalizeHost lowercases a host, strips any port, and strips a leading
+// "www.".
+func normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+func normalizeDomains(domains []string) []string {
+	var normalized []string
+	for _, d := range domains {
+		if d = normalizeHost(strings.TrimSpace(d)); d != "" {
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
+
+// linksBlockedDomain reports whether any link's host is one of blocked or a
+// subdomain of one. Unparseable links are ignored.
+func linksBlockedDomain(links []string, blocked []string) bool {
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := normalizeHost(u.Host)
+		for _, d := range blocked {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sampled reports whether a matching post with the given URI survives the
+// feed's sample rate. The decision is a pure function of the URI.
+func (f *feed) sampled(uri string) bool {
+	if f.sampleRate == 0 || f.sampleRate == 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(uri))
+	return float64(h.Sum64())/math.MaxUint64 < f.sampleRate
+}
+
+// hasTextRules reports whether the feed can match posts on their content,
+// as opposed to only through reposts.
+func (f *feed) hasTextRules() bool {
+	return f.pattern != nil || len(f.requireAll) > 0 || f.mentions != nil
+}
+
+func (g *matchGroup) matches(text string, tags []string) bool {
+	if g.pattern != nil && g.pattern.MatchString(text) {
+		return true
+	}
+	if g.hashtags != nil {
+		for _, tag := range tags {
+			if _, ok := g.hashtags[normalizeTag(tag)]; ok {
+				return true
+			}
 		}
 	}
-	return f.pattern.MatchString(incoming.Text)
+	return false
 }
@@ -0,0 +1,454 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPublisher = "did:plc:publisher"
+
+// memRepo is an in-memory PostRepository and CursorRepository. It keeps
+// posts per feed in insertion order and doesn't paginate.
+type memRepo struct {
+	mu      sync.Mutex
+	posts   map[string][]Post // feed URI -> posts, oldest first
+	cursors map[string]int64
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{posts: make(map[string][]Post), cursors: make(map[string]int64)}
+}
+
+func (r *memRepo) CreatePost(_ context.Context, post *Post, feedURIs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, uri := range feedURIs {
+		r.posts[uri] = append(r.posts[uri], *post)
+	}
+	return nil
+}
+
+func (r *memRepo) DeletePost(_ context.Context, uri string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for feed, posts := range r.posts {
+		r.posts[feed] = slices.DeleteFunc(posts, func(p Post) bool { return p.URI == uri })
+	}
+	return nil
+}
+
+func (r *memRepo) UpsertPost(_ context.Context, post *Post, feedURIs []string) (UpsertResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result UpsertResult
+	for _, uri := range feedURIs {
+		posts := slices.DeleteFunc(r.posts[uri], func(p Post) bool { return p.URI == post.URI })
+		if len(posts) < len(r.posts[uri]) {
+			result.Updated++
+		} else {
+			result.Inserted++
+		}
+		r.posts[uri] = append(posts, *post)
+	}
+	return result, nil
+}
+
+func (r *memRepo) RemovePost(_ context.Context, uri string, feedURIs []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := 0
+	for _, feed := range feedURIs {
+		posts := slices.DeleteFunc(r.posts[feed], func(p Post) bool { return p.URI == uri })
+		if len(posts) < len(r.posts[feed]) {
+			removed++
+		}
+		r.posts[feed] = posts
+	}
+	return removed, nil
+}
+
+func (r *memRepo) IsTombstoned(context.Context, string, time.Time) (bool, error) { return false, nil }
+
+func (r *memRepo) DeleteTombstonesBefore(context.Context, time.Time) (int64, error) { return 0, nil }
+
+func (r *memRepo) DeleteOldPosts(context.Context, string, time.Duration, int) (CleanupResult, error) {
+	return CleanupResult{}, nil
+}
+
+func (r *memRepo) DeletePostsBefore(context.Context, time.Time) (int64, error) { return 0, nil }
+
+func (r *memRepo) GetFeedPosts(_ context.Context, feedURI string, limit int, _ string, _ []string) ([]Post, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts := slices.Clone(r.posts[feedURI])
+	slices.Reverse(posts)
+	return posts[:min(limit, len(posts))], "", nil
+}
+
+func (r *memRepo) GetCursor(_ context.Context, service string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursors[service], nil
+}
+
+func (r *memRepo) UpdateCursor(_ context.Context, service string, cursor int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursors[service] = cursor
+	return nil
+}
+
+// newTestService builds a FeedService over an in-memory repository.
+func newTestService(t *testing.T, configs ...FeedConfig) *FeedService {
+	t.Helper()
+	repo := newMemRepo()
+	s, err := NewFeedService(configs, repo, repo, ServiceOptions{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testFeed returns the URI of a test feed named rkey.
+func testFeed(rkey string) string {
+	return newFeedURI(testPublisher, rkey)
+}
+
+// matches reports whether post matches the single feed s serves.
+func matches(s *FeedService, post IncomingPost) bool {
+	if post.URI == "" {
+		post.URI = "at://did:plc:author/app.bsky.feed.post/1"
+	}
+	return len(s.matchingFeeds(&post)) > 0
+}
+
+func TestCleanKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		keywords []string
+		want     []string
+		wantErr  bool
+	}{
+		{"drops blank entries", []string{"", "  ", "ai"}, []string{"ai"}, false},
+		{"trims whitespace", []string{" llm ", "ai"}, []string{"llm", "ai"}, false},
+		{"all blank", []string{"", "  "}, nil, true},
+		{"empty list", nil, nil, true},
+		{"no letters or digits", []string{"ai", "!!"}, nil, true},
+		{"non-ASCII inside", []string{"naïve"}, []string{"naïve"}, false},
+		{"non-ASCII only", []string{"日本"}, nil, true},
+		{"non-ASCII at the end", []string{"café"}, nil, true},
+		{"non-ASCII at the start", []string{"éclair"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanKeywords(tt.keywords)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cleanKeywords(%q) error = %v, wantErr %t", tt.keywords, err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("cleanKeywords(%q) = %q, want %q", tt.keywords, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileKeywordsMatchesAcceptedKeywords(t *testing.T) {
+	keywords, err := cleanKeywords([]string{"naïve", "ai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := compileKeywords(keywords, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, want := range map[string]bool{
+		"a naïve approach": true,
+		"AI agents":        true,
+		"said":             false,
+	} {
+		if got := pattern.MatchString(text); got != want {
+			t.Errorf("pattern.MatchString(%q) = %t, want %t", text, got, want)
+		}
+	}
+}
+
+func TestRequireAll(t *testing.T) {
+	s := newTestService(t, FeedConfig{
+		URI:      testFeed("releases"),
+		Keywords: []string{"golang", "go"},
+		RequireAll: []MatchGroup{
+			{Keywords: []string{"release", "released"}},
+			{Hashtags: []string{"#golang", "go"}},
+		},
+	})
+	tests := []struct {
+		name string
+		post IncomingPost
+		want bool
+	}{
+		{"every condition", IncomingPost{Text: "Go 1.26 released", Tags: []string{"golang"}}, true},
+		{"hashtag in another case", IncomingPost{Text: "go release notes", Tags: []string{"GoLang"}}, true},
+		{"keyword and first group, no hashtag", IncomingPost{Text: "Go 1.26 released"}, false},
+		{"keyword and hashtag, no release", IncomingPost{Text: "writing go today", Tags: []string{"golang"}}, false},
+		{"groups without the keyword", IncomingPost{Text: "rust released", Tags: []string{"golang"}}, false},
+		{"nothing", IncomingPost{Text: "hello world"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(s, tt.post); got != tt.want {
+				t.Errorf("matches(%q, tags %q) = %t, want %t", tt.post.Text, tt.post.Tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFeedServiceRejectsSharedRKey(t *testing.T) {
+	repo := newMemRepo()
+	logger := slog.New(slog.DiscardHandler)
+	tests := []struct {
+		name    string
+		configs []FeedConfig
+		wantErr bool
+	}{
+		{"distinct rkeys", []FeedConfig{
+			{URI: testFeed("ai"), Keywords: []string{"ai"}},
+			{URI: testFeed("golang"), Keywords: []string{"golang"}},
+		}, false},
+		{"shared rkey", []FeedConfig{
+			{URI: testFeed("ai"), Keywords: []string{"ai"}},
+			{URI: testFeed("ai"), Keywords: []string{"llm"}},
+		}, true},
+		{"same rkey, other publisher", []FeedConfig{
+			{URI: testFeed("ai"), Keywords: []string{"ai"}},
+			{URI: newFeedURI("did:plc:other", "ai"), Keywords: []string{"llm"}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFeedService(tt.configs, repo, repo, ServiceOptions{}, logger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFeedService() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), testFeed("ai")) {
+				t.Errorf("error %q doesn't name the conflicting feed", err)
+			}
+		})
+	}
+}
+
+func TestBlockedDomains(t *testing.T) {
+	s := newTestService(t, FeedConfig{
+		URI:            testFeed("links"),
+		Keywords:       []string{"deal"},
+		BlockedDomains: []string{"spam.example", " WWW.Scam.Test "},
+	})
+	tests := []struct {
+		name  string
+		links []string
+		want  bool
+	}{
+		{"exact host", []string{"https://spam.example/offer"}, false},
+		{"www and case", []string{"https://WWW.Spam.Example/offer"}, false},
+		{"subdomain", []string{"https://shop.spam.example/offer"}, false},
+		{"blocked with www in config", []string{"http://scam.test:8080/x"}, false},
+		{"one of several links", []string{"https://news.example/a", "https://deep.shop.spam.example/"}, false},
+		{"other host", []string{"https://news.example/a"}, true},
+		{"suffix but not a subdomain", []string{"https://notspam.example/"}, true},
+		{"blocked name in path", []string{"https://news.example/spam.example"}, true},
+		{"no links", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := IncomingPost{Text: "great deal", Links: tt.links, LinkCount: len(tt.links)}
+			if got := matches(s, post); got != tt.want {
+				t.Errorf("matches with links %q = %t, want %t", tt.links, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseSensitive(t *testing.T) {
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		text          string
+		want          bool
+	}{
+		{"insensitive exact", false, "AI is everywhere", true},
+		{"insensitive other case", false, "ai is everywhere", true},
+		{"sensitive exact", true, "AI is everywhere", true},
+		{"sensitive other case", true, "ai is everywhere", false},
+		{"sensitive RequireAll other case", true, "AI RELEASE", false},
+		{"insensitive RequireAll other case", false, "AI RELEASE", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, FeedConfig{
+				URI:           testFeed("ai"),
+				Keywords:      []string{"AI"},
+				RequireAll:    []MatchGroup{{Keywords: []string{"release", "is"}}},
+				CaseSensitive: tt.caseSensitive,
+			})
+			if got := matches(s, IncomingPost{Text: tt.text}); got != tt.want {
+				t.Errorf("matches(%q) = %t, want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinKeywordHits(t *testing.T) {
+	s := newTestService(t, FeedConfig{
+		URI:            testFeed("agents"),
+		Keywords:       []string{"agent", "llm", "claude", "claude opus"},
+		MinKeywordHits: 2,
+	})
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"one keyword", "building an agent", false},
+		{"one keyword repeated", "agent after agent after agent", false},
+		{"overlapping keywords count once", "claude opus is out", false},
+		{"two keywords", "an llm agent", true},
+		{"two keywords in other case", "An LLM Agent", true},
+		{"three keywords", "claude as an llm agent", true},
+		{"no keywords", "hello world", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(s, IncomingPost{Text: tt.text}); got != tt.want {
+				t.Errorf("matches(%q) = %t, want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginalOnly(t *testing.T) {
+	const root = "at://did:plc:someone/app.bsky.feed.post/root"
+	tests := []struct {
+		name   string
+		quotes QuoteFilter
+		post   IncomingPost
+		want   bool
+	}{
+		{"original post", "", IncomingPost{Text: "golang tip"}, true},
+		{"reply", "", IncomingPost{Text: "golang tip", ReplyRootURI: root}, false},
+		{"quote", "", IncomingPost{Text: "golang tip", IsQuote: true, QuotedURI: root}, false},
+		{"quoting reply", "", IncomingPost{Text: "golang tip", IsQuote: true, QuotedURI: root, ReplyRootURI: root}, false},
+		{"original with QuotesExclude", QuotesExclude, IncomingPost{Text: "golang tip"}, true},
+		{"quote with QuotesExclude", QuotesExclude, IncomingPost{Text: "golang tip", IsQuote: true, QuotedURI: root}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, FeedConfig{URI: testFeed("fresh"), Keywords: []string{"golang"}, OriginalOnly: true, Quotes: tt.quotes})
+			if got := matches(s, tt.post); got != tt.want {
+				t.Errorf("matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginalOnlyConflicts(t *testing.T) {
+	repo := newMemRepo()
+	logger := slog.New(slog.DiscardHandler)
+	tests := []struct {
+		name string
+		cfg  FeedConfig
+	}{
+		{"reposts", FeedConfig{Reposters: []string{"did:plc:curator"}}},
+		{"quotes only", FeedConfig{Quotes: QuotesOnly}},
+		{"reply root authors", FeedConfig{ReplyRootAuthors: []string{"did:plc:curator"}}},
+		{"reply root URIs", FeedConfig{ReplyRootURIs: []string{"at://did:plc:someone/app.bsky.feed.post/root"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.URI, cfg.Keywords, cfg.OriginalOnly = testFeed("fresh"), []string{"golang"}, true
+			if _, err := NewFeedService([]FeedConfig{cfg}, repo, repo, ServiceOptions{}, logger); err == nil {
+				t.Error("NewFeedService accepted OriginalOnly with a setting it excludes")
+			}
+		})
+	}
+}
+
+func TestMinScore(t *testing.T) {
+	cfg := FeedConfig{
+		URI:            testFeed("weighted"),
+		Keywords:       []string{"claude", "anthropic", "model", "prompt"},
+		KeywordAliases: map[string][]string{"claude": {"claude opus"}},
+		KeywordWeights: map[string]float64{"claude": 3, "anthropic": 2, "model": 0.5},
+		MinScore:       3,
+	}
+	s := newTestService(t, cfg)
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"strong keyword alone", "claude wrote this", true}, // exactly MinScore
+		{"alias takes its keyword's weight", "claude opus wrote this", true},
+		{"two mid keywords", "anthropic ships a prompt guide", true}, // 2 + 1
+		{"mid keyword alone", "anthropic news", false},
+		{"weak keywords together", "a model prompt", false}, // 0.5 + 1
+		{"weak keyword repeated", "model model model model model model", false},
+		{"every keyword", "claude, anthropic, model and prompt", true},
+		{"no keywords", "hello world", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(s, IncomingPost{Text: tt.text}); got != tt.want {
+				t.Errorf("matches(%q) = %t, want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinScoreWeightKeyCase(t *testing.T) {
+	cfg, err := NewFeed(testPublisher, "weighted").
+		WithKeywords("claude", "prompt").
+		KeywordWeight("Claude", 3).
+		MinScore(3).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, cfg)
+	if !matches(s, IncomingPost{Text: "claude wrote this"}) {
+		t.Error("weight keyed in another case wasn't applied")
+	}
+	if matches(s, IncomingPost{Text: "a prompt"}) {
+		t.Error("unweighted keyword alone matched")
+	}
+}
+
+func TestValidateWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     FeedConfig
+		wantErr bool
+	}{
+		{"weights and score", FeedConfig{Keywords: []string{"a1", "b1"}, KeywordWeights: map[string]float64{"a1": 2}, MinScore: 2}, false},
+		{"score without weights", FeedConfig{Keywords: []string{"a1"}, MinScore: 1}, false},
+		{"weight for an unknown keyword", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"c1": 2}}, true},
+		{"zero weight", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"a1": 0}}, true},
+		{"negative weight", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"a1": -1}}, true},
+		{"negative score", FeedConfig{Keywords: []string{"a1"}, MinScore: -1}, true},
+		{"score without keywords", FeedConfig{MentionsAny: []string{"did:plc:a"}, MinScore: 1}, true},
+		{"weight key in another case", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"A1": 2}}, false},
+		{"case-sensitive weight key in another case", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"A1": 2}, CaseSensitive: true}, true},
+		{"keyword weighed twice", FeedConfig{Keywords: []string{"a1"}, KeywordWeights: map[string]float64{"a1": 2, "A1": 3}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateWeights(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateWeights() = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package domain
+
+// inWatchedThread reports whether incoming is a reply in a thread whose root
+// post, or the root's author, is one of the feed's ReplyRootURIs or
+// ReplyRootAuthors.
+func (f *feed) inWatchedThread(incoming *IncomingPost) bool {
+	if f.threadRoots == nil || incoming.ReplyRootURI == "" {
+		return false
+	}
+	if _, ok := f.threadRoots[incoming.ReplyRootURI]; ok {
+		return true
+	}
+	_, ok := f.threadRoots[uriAuthority(incoming.ReplyRootURI)]
+	return ok
+}
+
+// threadCandidates returns the feeds watching incoming's thread root or its
+// author, which the keyword index can't find for replies without keywords.
+func (s *FeedService) threadCandidates(incoming *IncomingPost) []*feed {
+	if len(s.threads) == 0 || incoming.ReplyRootURI == "" {
+		return nil
+	}
+	feeds := s.threads[incoming.ReplyRootURI]
+	if byAuthor := s.threads[uriAuthority(incoming.ReplyRootURI)]; len(byAuthor) > 0 {
+		feeds = append(feeds[:len(feeds):len(feeds)], byAuthor...)
+	}
+	return feeds
+}
@@ -0,0 +1,75 @@
+package domain
+
+import "testing"
+
+func TestReplyRoots(t *testing.T) {
+	const (
+		author    = "did:plc:curator"
+		rootPost  = "at://did:plc:someone/app.bsky.feed.post/root"
+		otherRoot = "at://did:plc:someone/app.bsky.feed.post/other"
+	)
+	tests := []struct {
+		name   string
+		config FeedConfig
+		post   IncomingPost
+		want   bool
+	}{
+		{
+			"reply in a thread started by a watched author",
+			FeedConfig{ReplyRootAuthors: []string{author}},
+			IncomingPost{Text: "nice", ReplyRootURI: "at://" + author + "/app.bsky.feed.post/abc"},
+			true,
+		},
+		{
+			"reply in another author's thread",
+			FeedConfig{ReplyRootAuthors: []string{author}},
+			IncomingPost{Text: "nice", ReplyRootURI: otherRoot},
+			false,
+		},
+		{
+			"watched author's own top-level post",
+			FeedConfig{ReplyRootAuthors: []string{author}},
+			IncomingPost{URI: "at://" + author + "/app.bsky.feed.post/abc", Text: "new thread", AuthorDID: author},
+			false,
+		},
+		{
+			"reply under a watched root post",
+			FeedConfig{ReplyRootURIs: []string{rootPost}},
+			IncomingPost{Text: "agreed", ReplyRootURI: rootPost},
+			true,
+		},
+		{
+			"reply under another post by the same author",
+			FeedConfig{ReplyRootURIs: []string{rootPost}},
+			IncomingPost{Text: "agreed", ReplyRootURI: otherRoot},
+			false,
+		},
+		{
+			"thread reply skips keywords",
+			FeedConfig{Keywords: []string{"golang"}, ReplyRootURIs: []string{rootPost}},
+			IncomingPost{Text: "agreed", ReplyRootURI: rootPost},
+			true,
+		},
+		{
+			"keywords still match outside the thread",
+			FeedConfig{Keywords: []string{"golang"}, ReplyRootURIs: []string{rootPost}},
+			IncomingPost{Text: "golang is nice"},
+			true,
+		},
+		{
+			"thread reply still needs the language",
+			FeedConfig{Langs: []string{"en"}, ReplyRootAuthors: []string{author}},
+			IncomingPost{Text: "bonjour", Langs: []string{"fr"}, ReplyRootURI: "at://" + author + "/app.bsky.feed.post/abc"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.URI = testFeed("thread")
+			s := newTestService(t, tt.config)
+			if got := matches(s, tt.post); got != tt.want {
+				t.Errorf("matches(root %q) = %t, want %t", tt.post.ReplyRootURI, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// HourRange is a window of UTC hours of the day, from Start (inclusive) to
+// End (exclusive). A range whose End is before its Start wraps past
+// midnight, so {22, 2} covers 22:00 to 01:59.
+type HourRange struct {
+	Start int // 0-23
+	End   int // 0-24
+}
+
+// validate reports whether r is a usable range.
+func (r HourRange) validate() error {
+	if r.Start < 0 || r.Start > 23 {
+		return fmt.Errorf("start hour must be between 0 and 23, got %d", r.Start)
+	}
+	if r.End < 0 || r.End > 24 {
+		return fmt.Errorf("end hour must be between 0 and 24, got %d", r.End)
+	}
+	if r.Start == r.End%24 {
+		return fmt.Errorf("range %d-%d is empty or covers the whole day", r.Start, r.End)
+	}
+	return nil
+}
+
+// contains reports whether hour (0-23) falls within r.
+func (r HourRange) contains(hour int) bool {
+	if r.Start < r.End {
+		return hour >= r.Start && hour < r.End
+	}
+	return hour >= r.Start || hour < r.End
+}
+
+// inTimeWindows reports whether t falls within any of windows. A zero t,
+// i.e. a post without a parseable createdAt, is never within them.
+func inTimeWindows(windows []HourRange, t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	hour := t.UTC().Hour()
+	for _, w := range windows {
+		if w.contains(hour) {
+			return true
+		}
+	}
+	return false
+}
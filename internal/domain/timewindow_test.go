@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInTimeWindows(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	morning := []HourRange{{Start: 6, End: 10}}
+	overnight := []HourRange{{Start: 22, End: 2}}
+	tests := []struct {
+		name    string
+		windows []HourRange
+		t       time.Time
+		want    bool
+	}{
+		{"start is inclusive", morning, at(6, 0), true},
+		{"just before start", morning, at(5, 59), false},
+		{"last minute before end", morning, at(9, 59), true},
+		{"end is exclusive", morning, at(10, 0), false},
+		{"wrap: start", overnight, at(22, 0), true},
+		{"wrap: before midnight", overnight, at(23, 59), true},
+		{"wrap: midnight", overnight, at(0, 0), true},
+		{"wrap: last hour", overnight, at(1, 59), true},
+		{"wrap: end is exclusive", overnight, at(2, 0), false},
+		{"wrap: just before start", overnight, at(21, 59), false},
+		{"end of day", []HourRange{{Start: 20, End: 24}}, at(23, 30), true},
+		{"end of day excludes midnight", []HourRange{{Start: 20, End: 24}}, at(0, 0), false},
+		{"second window", []HourRange{{6, 10}, {18, 20}}, at(19, 0), true},
+		{"converted to UTC", morning, time.Date(2026, 3, 1, 3, 0, 0, 0, time.FixedZone("UTC-5", -5*3600)), true},
+		{"no createdAt", morning, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inTimeWindows(tt.windows, tt.t); got != tt.want {
+				t.Errorf("inTimeWindows(%v, %s) = %t, want %t", tt.windows, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHourRangeValidate(t *testing.T) {
+	tests := []struct {
+		r       HourRange
+		wantErr bool
+	}{
+		{HourRange{6, 10}, false},
+		{HourRange{22, 2}, false},
+		{HourRange{0, 24}, true},
+		{HourRange{5, 5}, true},
+		{HourRange{24, 2}, true},
+		{HourRange{-1, 2}, true},
+		{HourRange{2, 25}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.r.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v.validate() = %v, wantErr %t", tt.r, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceStatus describes the matching trace mode.
+type TraceStatus struct {
+	Enabled    bool
+	SampleRate float64
+	Until      time.Time // zero if the trace runs until turned off
+}
+
+// tracer holds the trace mode state. enabled is checked on every post, so it
+// is the only field read when tracing is off.
+type tracer struct {
+	enabled atomic.Bool
+	rate    atomic.Uint64 // math.Float64bits of the sample rate
+
+	mu    sync.Mutex
+	until time.Time
+	timer *time.Timer
+}
+
+// SetTrace turns the matching trace on or off. While on, a sampleRate
+// fraction of incoming posts (between 0 and 1; 0 means 1) are logged at debug
+// level with each feed's decision and the first rule that rejected them. If
+// d is positive, tracing turns itself off after d.
+func (s *FeedService) SetTrace(enabled bool, sampleRate float64, d time.Duration) {
+	t := &s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.until = time.Time{}
+
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+	t.rate.Store(math.Float64bits(sampleRate))
+	t.enabled.Store(enabled)
+
+	if enabled && d > 0 {
+		t.until = time.Now().Add(d)
+		t.timer = time.AfterFunc(d, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.enabled.Store(false)
+			t.until = time.Time{}
+			s.logger.Info("matching trace expired")
+		})
+	}
+	s.logger.Info("matching trace updated", "enabled", enabled, "sample_rate", sampleRate, "duration", d)
+}
+
+// TraceStatus reports whether the matching trace is on.
+func (s *FeedService) TraceStatus() TraceStatus {
+	t := &s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return TraceStatus{
+		Enabled:    t.enabled.Load(),
+		SampleRate: math.Float64frombits(t.rate.Load()),
+		Until:      t.until,
+	}
+}
+
+// tracePost logs, for a sampled post, every feed's decision: "matched", or
+// why it didn't match. candidates are the feeds the keyword index let
+// through and matched the URIs of the feeds the post matched.
+func (s *FeedService) tracePost(incoming *IncomingPost, candidates []*feed, matched []string) {
+	if rate := math.Float64frombits(s.tracer.rate.Load()); rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	decisions := make(map[string]string, len(s.feeds))
+	for uri, f := range s.feeds {
+		decisions[uri] = traceDecision(f, incoming, containsFeed(candidates, f))
+	}
+	s.logger.Debug("matching trace",
+		"uri", incoming.URI,
+		"author", incoming.AuthorDID,
+		"text", PreviewText(incoming.Text, 0),
+		"matched", matched,
+		"decisions", decisions,
+	)
+}
+
+// traceDecision explains one feed's decision on a post, re-running its
+// rules. Follower thresholds, applied after matching, aren't reflected.
+func traceDecision(f *feed, incoming *IncomingPost, candidate bool) string {
+	if !candidate {
+		return "keyword_index"
+	}
+	failure := ruleFailure(f, incoming)
+	matched := failure == ""
+	decided := matched
+	if f.matcher != nil {
+		decided = f.matcher(incoming, matched)
+	}
+	if !decided {
+		if matched {
+			return "matcher"
+		}
+		return failure
+	}
+	if !f.sampled(incoming.URI) {
+		return "sample_rate"
+	}
+	return "matched"
+}
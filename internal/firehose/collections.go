@@ -0,0 +1,86 @@
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// collectionHandler processes commits for one record collection.
+type collectionHandler struct {
+	// decode parses a record of the collection and attaches it to commit.
+	decode func(commit *jetstreamCommit, record json.RawMessage) error
+
+	// wanted reports whether the subscriber needs this collection. nil means
+	// always.
+	wanted func(s *Subscriber) bool
+
+	// handle applies a commit to the feed service. It returns the URIs of
+	// the feeds a newly created post was saved to, if any.
+	handle func(s *Subscriber, ctx context.Context, event *jetstreamEvent) ([]string, error)
+}
+
+// collectionHandlers maps AT Proto collection NSIDs to their handlers. The
+// subscriber requests exactly these collections from Jetstream, so supporting
+// a new record type only takes an entry here.
+var collectionHandlers = map[string]collectionHandler{
+	"app.bsky.feed.post": {
+		decode: decodePostRecord,
+		handle: (*Subscriber).handlePostCommit,
+	},
+	"app.bsky.feed.repost": {
+		decode: decodeRepostRecord,
+		wanted: func(s *Subscriber) bool { return s.feedService.WantsReposts() },
+		handle: (*Subscriber).handleRepostCommit,
+	},
+}
+
+// wantedCollections returns the registered collection NSIDs the subscriber
+// needs, sorted so the subscription URL is stable.
+func (s *Subscriber) wantedCollections() []string {
+	nsids := make([]string, 0, len(collectionHandlers))
+	for nsid, h := range collectionHandlers {
+		if h.wanted == nil || h.wanted(s) {
+			nsids = append(nsids, nsid)
+		}
+	}
+	slices.Sort(nsids)
+	return nsids
+}
+
+func decodePostRecord(commit *jetstreamCommit, record json.RawMessage) error {
+	var r postRecord
+	if err := json.Unmarshal(record, &r); err != nil {
+		return fmt.Errorf("unmarshal post record: %w", err)
+	}
+	commit.Record = &r
+	return nil
+}
+
+func decodeRepostRecord(commit *jetstreamCommit, record json.RawMessage) error {
+	var r repostRecord
+	if err := json.Unmarshal(record, &r); err != nil {
+		return fmt.Errorf("unmarshal repost record: %w", err)
+	}
+	commit.Repost = &r
+	return nil
+}
+
+// handleRepostCommit adds reposted posts to the feeds that include the
+// reposter. Deleting a repost doesn't remove the post: the delete event only
+// names the repost record, not its subject.
+func (s *Subscriber) handleRepostCommit(ctx context.Context, event *jetstreamEvent) ([]string, error) {
+	commit := event.Commit
+	if commit.Operation != "create" || commit.Repost == nil {
+		return nil, nil
+	}
+	return s.feedService.ProcessRepost(ctx, &domain.IncomingRepost{
+		ReposterDID: event.DID,
+		RepostURI:   fmt.Sprintf("at://%s/%s/%s", event.DID, commit.Collection, commit.RKey),
+		SubjectURI:  commit.Repost.Subject.URI,
+		SubjectCID:  commit.Repost.Subject.CID,
+	})
+}
@@ -1,5 +1,28 @@
 package firehose
 
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Parse failure stages, reported via StatsReporter.ParseFailed.
+const (
+	ParseStageFrame  = "frame"  // the WebSocket message is not a JSON frame
+	ParseStageEvent  = "event"  // the event envelope is not valid JSON
+	ParseStageCommit = "commit" // the commit payload could not be decoded
+	ParseStageRecord = "record" // the post record could not be decoded
+)
+
+// parseError records which stage of event decoding failed.
+type parseError struct {
+	stage string
+	err   error
+}
+
+func (e *parseError) Error() string { return e.err.Error() }
+func (e *parseError) Unwrap() error { return e.err }
+
 // jetstreamEvent is the raw JSON structure from Jetstream.
 type jetstreamEvent struct {
 	DID    string           `json:"did"`
@@ -16,6 +39,9 @@ type jetstreamCommit struct {
 	RKey       string      `json:"rkey"`
 	Record     *postRecord `json:"record,omitempty"`
 	CID        string      `json:"cid"`
+
+	// Repost is set instead of Record for app.bsky.feed.repost creates.
+	Repost *repostRecord `json:"-"`
 }
 
 // postRecord is the parsed content of an app.bsky.feed.post record.
@@ -26,6 +52,51 @@ type postRecord struct {
 	Langs     []string  `json:"langs"`
 	Reply     *replyRef `json:"reply,omitempty"`
 	Tags      []string  `json:"tags,omitempty"`
+	Facets    []facet   `json:"facets,omitempty"`
+	Embed     *embed    `json:"embed,omitempty"`
+}
+
+// repostRecord is the parsed content of an app.bsky.feed.repost record.
+type repostRecord struct {
+	Subject   strongRef `json:"subject"`
+	CreatedAt string    `json:"createdAt"`
+}
+
+// embed is the subset of a post embed needed for matching. Only
+// app.bsky.embed.external populates External; app.bsky.embed.record and
+// app.bsky.embed.recordWithMedia populate Record.
+type embed struct {
+	Type     string         `json:"$type"`
+	External *externalEmbed `json:"external,omitempty"`
+	Record   *embedRecord   `json:"record,omitempty"`
+}
+
+// embedRecord is the record field of a record embed. For
+// app.bsky.embed.record it is the quoted record's strong ref; for
+// app.bsky.embed.recordWithMedia it wraps that ref one level deeper.
+type embedRecord struct {
+	URI    string     `json:"uri"`
+	CID    string     `json:"cid"`
+	Record *strongRef `json:"record,omitempty"`
+}
+
+// externalEmbed is a link card attached to a post.
+type externalEmbed struct {
+	URI string `json:"uri"`
+}
+
+// facet annotates a byte range of the post text with rich-text features.
+type facet struct {
+	Features []facetFeature `json:"features"`
+}
+
+// facetFeature is a single rich-text feature. Only the fields relevant to
+// the feature's $type are populated.
+type facetFeature struct {
+	Type string `json:"$type"`
+	Tag  string `json:"tag,omitempty"` // app.bsky.richtext.facet#tag
+	DID  string `json:"did,omitempty"` // app.bsky.richtext.facet#mention
+	URI  string `json:"uri,omitempty"` // app.bsky.richtext.facet#link
 }
 
 // replyRef contains references to the parent and root of a reply chain.
@@ -39,3 +110,94 @@ type strongRef struct {
 	URI string `json:"uri"`
 	CID string `json:"cid"`
 }
+
+// hashtags returns the record's out-of-text tags together with any hashtag
+// facets in the text.
+func (r *postRecord) hashtags() []string {
+	tags := append([]string(nil), r.Tags...)
+	for _, f := range r.Facets {
+		for _, feat := range f.Features {
+			if feat.Type == "app.bsky.richtext.facet#tag" && feat.Tag != "" {
+				tags = append(tags, feat.Tag)
+			}
+		}
+	}
+	return tags
+}
+
+// mentions returns the distinct DIDs of accounts mentioned in the record's
+// facets, in order of appearance.
+func (r *postRecord) mentions() []string {
+	var dids []string
+	for _, f := range r.Facets {
+		for _, feat := range f.Features {
+			if feat.Type == "app.bsky.richtext.facet#mention" && feat.DID != "" && !slices.Contains(dids, feat.DID) {
+				dids = append(dids, feat.DID)
+			}
+		}
+	}
+	return dids
+}
+
+// createdAt parses the record's createdAt timestamp, returning zero if it is
+// missing or not RFC 3339.
+func (r *postRecord) createdAt() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, r.CreatedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// replyRootURI returns the AT-URI of the thread's root post if the record is
+// a reply, or "".
+func (r *postRecord) replyRootURI() string {
+	if r.Reply == nil {
+		return ""
+	}
+	return r.Reply.Root.URI
+}
+
+// quotedURI returns the AT-URI of the post this record quotes, or "" if it
+// doesn't quote a post. Quoted feeds, lists, and other records are ignored.
+func (r *postRecord) quotedURI() string {
+	if r.Embed == nil || r.Embed.Record == nil {
+		return ""
+	}
+	var uri string
+	switch r.Embed.Type {
+	case "app.bsky.embed.record":
+		uri = r.Embed.Record.URI
+	case "app.bsky.embed.recordWithMedia":
+		if r.Embed.Record.Record != nil {
+			uri = r.Embed.Record.Record.URI
+		}
+	}
+	if !strings.Contains(uri, "/app.bsky.feed.post/") {
+		return ""
+	}
+	return uri
+}
+
+// links returns the distinct external link URIs in the record, from link
+// facets in the text and an external link card embed, in order of
+// appearance.
+func (r *postRecord) links() []string {
+	var links []string
+	add := func(uri string) {
+		if uri != "" && !slices.Contains(links, uri) {
+			links = append(links, uri)
+		}
+	}
+	for _, f := range r.Facets {
+		for _, feat := range f.Features {
+			if feat.Type == "app.bsky.richtext.facet#link" {
+				add(feat.URI)
+			}
+		}
+	}
+	if r.Embed != nil && r.Embed.Type == "app.bsky.embed.external" && r.Embed.External != nil {
+		add(r.Embed.External.URI)
+	}
+	return links
+}
@@ -0,0 +1,61 @@
+package firehose
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIncomingPostMentions(t *testing.T) {
+	tests := []struct {
+		name   string
+		facets string
+		want   []string
+	}{
+		{"mention", `[{"features":[{"$type":"app.bsky.richtext.facet#mention","did":"did:plc:alice"}]}]`, []string{"did:plc:alice"}},
+		{"repeated mention", `[{"features":[{"$type":"app.bsky.richtext.facet#mention","did":"did:plc:alice"}]},{"features":[{"$type":"app.bsky.richtext.facet#mention","did":"did:plc:alice"},{"$type":"app.bsky.richtext.facet#mention","did":"did:plc:bob"}]}]`, []string{"did:plc:alice", "did:plc:bob"}},
+		{"tag and link only", `[{"features":[{"$type":"app.bsky.richtext.facet#tag","tag":"go"},{"$type":"app.bsky.richtext.facet#link","uri":"https://go.dev"}]}]`, nil},
+		{"no facets", `[]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"did":"did:plc:author","time_us":1,"kind":"commit","commit":{"rev":"1","operation":"create","collection":"app.bsky.feed.post","rkey":"1","cid":"bafy","record":{"text":"hi","facets":` + tt.facets + `}}}`
+			event, err := parseEvent([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := incomingPost(event).Mentions; !slices.Equal(got, tt.want) {
+				t.Errorf("Mentions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncomingPostQuote(t *testing.T) {
+	const quoted = "at://did:plc:other/app.bsky.feed.post/q"
+	tests := []struct {
+		name      string
+		record    string
+		wantQuote string
+		wantRoot  string
+	}{
+		{"plain", `{"text":"hi"}`, "", ""},
+		{"quote", `{"text":"hi","embed":{"$type":"app.bsky.embed.record","record":{"uri":"` + quoted + `","cid":"c"}}}`, quoted, ""},
+		{"quote with media", `{"text":"hi","embed":{"$type":"app.bsky.embed.recordWithMedia","record":{"record":{"uri":"` + quoted + `","cid":"c"}}}}`, quoted, ""},
+		{"embedded feed generator", `{"text":"hi","embed":{"$type":"app.bsky.embed.record","record":{"uri":"at://did:plc:other/app.bsky.feed.generator/f","cid":"c"}}}`, "", ""},
+		{"reply to a quote", `{"text":"hi","reply":{"root":{"uri":"` + quoted + `","cid":"c"},"parent":{"uri":"` + quoted + `","cid":"c"}}}`, "", quoted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"did":"did:plc:author","time_us":1,"kind":"commit","commit":{"rev":"1","operation":"create","collection":"app.bsky.feed.post","rkey":"1","cid":"bafy","record":` + tt.record + `}}`
+			event, err := parseEvent([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			post := incomingPost(event)
+			if post.QuotedURI != tt.wantQuote || post.IsQuote != (tt.wantQuote != "") || post.ReplyRootURI != tt.wantRoot {
+				t.Errorf("QuotedURI = %q, IsQuote = %t, ReplyRootURI = %q; want %q, %t, %q",
+					post.QuotedURI, post.IsQuote, post.ReplyRootURI, tt.wantQuote, tt.wantQuote != "", tt.wantRoot)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package firehose
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// StatsReporter receives firehose processing events. Implementations can
+// forward them to any telemetry backend (e.g. Prometheus or StatsD). Methods
+// are called from the subscriber's read loop and must not block.
+type StatsReporter interface {
+	// EventReceived is called for every successfully parsed firehose event.
+	EventReceived()
+
+	// CommitProcessed is called for every commit event handed to the feed service.
+	CommitProcessed()
+
+	// PostMatched is called once per feed that a new post was saved to.
+	PostMatched(feedURI string)
+
+	// ParseFailed is called when a firehose message cannot be decoded. stage
+	// is one of ParseStageFrame, ParseStageEvent, ParseStageCommit, or
+	// ParseStageRecord.
+	ParseFailed(stage string)
+
+	// EventSlow is called when handling one event took longer than
+	// FEEDGEN_FIREHOSE_SLOW_EVENT_THRESHOLD.
+	EventSlow()
+
+	// EventAbandoned is called when the subscriber gave up waiting for an
+	// event after FEEDGEN_FIREHOSE_EVENT_DEADLINE and moved past it.
+	EventAbandoned()
+}
+
+// LogStatsReporter is a StatsReporter that accumulates counters and writes
+// them to a slog.Logger at a fixed interval.
+type LogStatsReporter struct {
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu               sync.Mutex
+	lastLog          time.Time
+	eventsReceived   int64
+	commitsProcessed int64
+	postsMatched     map[string]int64 // keyed by feed URI
+	parseFailures    map[string]int64 // keyed by parse stage
+	slowEvents       int64
+	abandonedEvents  int64
+}
+
+// NewLogStatsReporter creates a LogStatsReporter that logs cumulative
+// counters at most once per interval.
+func NewLogStatsReporter(logger *slog.Logger, interval time.Duration) *LogStatsReporter {
+	return &LogStatsReporter{
+		logger:        logger,
+		interval:      interval,
+		lastLog:       time.Now(),
+		postsMatched:  make(map[string]int64),
+		parseFailures: make(map[string]int64),
+	}
+}
+
+// EventReceived implements StatsReporter.
+func (r *LogStatsReporter) EventReceived() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.eventsReceived++
+	r.maybeLog()
+}
+
+// CommitProcessed implements StatsReporter.
+func (r *LogStatsReporter) CommitProcessed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commitsProcessed++
+}
+
+// PostMatched implements StatsReporter.
+func (r *LogStatsReporter) PostMatched(feedURI string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.postsMatched[feedURI]++
+}
+
+// ParseFailed implements StatsReporter.
+func (r *LogStatsReporter) ParseFailed(stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parseFailures[stage]++
+	r.maybeLog()
+}
+
+// EventSlow implements StatsReporter.
+func (r *LogStatsReporter) EventSlow() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.slowEvents++
+}
+
+// EventAbandoned implements StatsReporter.
+func (r *LogStatsReporter) EventAbandoned() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abandonedEvents++
+}
+
+// maybeLog writes the counters if the interval has elapsed. Caller must hold mu.
+func (r *LogStatsReporter) maybeLog() {
+	if time.Since(r.lastLog) < r.interval {
+		return
+	}
+
+	var total int64
+	perFeed := make([]any, 0, len(r.postsMatched))
+	for uri, n := range r.postsMatched {
+		total += n
+		perFeed = append(perFeed, slog.Int64(uri, n))
+	}
+
+	r.logger.Info("firehose stats",
+		"events_received", r.eventsReceived,
+		"commits_received", r.commitsProcessed,
+		"posts_matched", total,
+		"slow_events", r.slowEvents,
+		"abandoned_events", r.abandonedEvents,
+		slog.Group("posts_matched_by_feed", perFeed...),
+		slog.Group("parse_failures",
+			ParseStageFrame, r.parseFailures[ParseStageFrame],
+			ParseStageEvent, r.parseFailures[ParseStageEvent],
+			ParseStageCommit, r.parseFailures[ParseStageCommit],
+			ParseStageRecord, r.parseFailures[ParseStageRecord],
+		),
+	)
+	r.lastLog = time.Now()
+}
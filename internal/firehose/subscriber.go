@@ -1,62 +1,194 @@
 package firehose
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"net/http"
 	"net/url"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/blackmichael/bluesky-feeds/internal/config"
 	"github.com/blackmichael/bluesky-feeds/internal/domain"
 	"github.com/gorilla/websocket"
 )
 
+// CursorService is the service name the firehose cursor is saved under.
+const CursorService = "jetstream"
+
 const (
-	cursorServiceName  = "jetstream"
-	cursorSaveInterval = 5 * time.Second
-)
+	// defaultCursorSaveInterval applies when the config leaves
+	// FirehoseCursorSaveInterval unset.
+	defaultCursorSaveInterval = 5 * time.Second
 
-// wantedCollections is the set of AT Proto collection NSIDs this subscriber
-// requests from Jetstream. Only post events are needed for feed matching.
-var wantedCollections = []string{
-	"app.bsky.feed.post",
-}
+	// cursorSaveJitter is the largest fraction of the cursor save interval
+	// added or removed from each wait.
+	cursorSaveJitter = 0.1
+
+	// maxBlockBackoff caps the delay between retries of a failed commit
+	// under the block write failure policy.
+	maxBlockBackoff = 30 * time.Second
+
+	// maxPayloadSampleLen bounds the size of malformed payloads written to logs.
+	maxPayloadSampleLen = 1024
+)
 
 // Subscriber connects to the Jetstream firehose and processes events.
 type Subscriber struct {
-	url         string
+	cfg         *config.Config
 	feedService *domain.FeedService
+	stats       StatsReporter
 	logger      *slog.Logger
+
+	parseFailures int64 // total parse failures, used for payload sampling
+	warnedBinary  bool  // whether a binary JSON frame has been logged
+
+	latest      atomic.Int64 // time_us of the last processed event
+	lastEventAt atomic.Int64 // wall clock, in Unix nanoseconds, when it was processed
+
+	// mu guards repositioning: pending is the cursor requested by
+	// Reposition, and cancelConn drops the current connection.
+	mu         sync.Mutex
+	pending    *int64
+	cancelConn context.CancelFunc
+	wake       chan struct{}
+
+	// handlers tracks commits running under the event deadline, including
+	// ones the watchdog abandoned, so shutdown can wait for them.
+	handlers sync.WaitGroup
 }
 
-// NewSubscriber creates a new firehose subscriber.
+// NewSubscriber creates a new firehose subscriber that reports processing
+// counters to stats.
 func NewSubscriber(
-	firehoseURL string,
+	cfg *config.Config,
 	feedService *domain.FeedService,
+	stats StatsReporter,
 	logger *slog.Logger,
 ) *Subscriber {
 	return &Subscriber{
-		url:         firehoseURL,
+		cfg:         cfg,
 		feedService: feedService,
+		stats:       stats,
 		logger:      logger,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Reposition moves the subscriber to timeUS: the cursor is saved, and the
+// current connection is dropped and reopened from there. It returns the
+// cursor of the last event processed before the move, or the saved cursor
+// if none has been processed yet.
+func (s *Subscriber) Reposition(ctx context.Context, timeUS int64) (int64, error) {
+	old := s.latest.Load()
+	if old == 0 {
+		saved, err := s.feedService.GetCursor(ctx, CursorService)
+		if err != nil {
+			return 0, fmt.Errorf("load cursor: %w", err)
+		}
+		old = saved
 	}
+
+	s.mu.Lock()
+	s.pending = &timeUS
+	if s.cancelConn != nil {
+		s.cancelConn()
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return old, nil
+}
+
+// Position returns the cursor of the last processed event and the wall-clock
+// time it was processed. Both are zero until an event has been processed.
+// Since Jetstream cursors are event timestamps, time.Since of the cursor is
+// how far behind live the subscriber is.
+func (s *Subscriber) Position() (int64, time.Time) {
+	cursor := s.latest.Load()
+	at := s.lastEventAt.Load()
+	if cursor == 0 || at == 0 {
+		return 0, time.Time{}
+	}
+	return cursor, time.Unix(0, at)
 }
 
+// takePending returns and clears the cursor requested by Reposition.
+func (s *Subscriber) takePending() (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		return 0, false
+	}
+	cursor := *s.pending
+	s.pending = nil
+	return cursor, true
+}
+
+func (s *Subscriber) repositioning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending != nil
+}
+
+// ErrCursorRequired is returned by Start when FEEDGEN_REQUIRE_CURSOR is set
+// and no saved cursor is available to resume from.
+var ErrCursorRequired = errors.New("saved firehose cursor required but not available")
+
+// ErrTooManyFailures is returned by Start when the connection has failed
+// FEEDGEN_FIREHOSE_MAX_FAILURES times in a row.
+var ErrTooManyFailures = errors.New("too many consecutive firehose failures")
+
+// stableConnectionAge is how long a connection must stay up before its
+// failure starts a new run of consecutive failures.
+const stableConnectionAge = time.Minute
+
 // Start connects to the firehose and processes events until the context is
-// cancelled. It automatically reconnects on transient errors.
+// cancelled. It automatically reconnects on transient errors, logging the
+// number of consecutive failures with each. It returns early with
+// ErrCursorRequired if the start position is refused, or ErrTooManyFailures
+// once FEEDGEN_FIREHOSE_MAX_FAILURES is reached.
 func (s *Subscriber) Start(ctx context.Context) error {
+	failures := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			started := time.Now()
 			if err := s.subscribe(ctx); err != nil {
-				s.logger.Error("firehose connection error, reconnecting", "error", err)
+				if errors.Is(err, ErrCursorRequired) {
+					return err
+				}
+				if s.repositioning() {
+					continue // reconnect at once from the requested cursor
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if time.Since(started) >= stableConnectionAge {
+					failures = 0
+				}
+				failures++
+				if limit := s.cfg.FirehoseMaxFailures; limit > 0 && failures >= limit {
+					s.logger.Error("firehose connection error, giving up", "error", err, "consecutive_failures", failures)
+					return fmt.Errorf("%w (%d): %w", ErrTooManyFailures, failures, err)
+				}
+				s.logger.Error("firehose connection error, reconnecting", "error", err, "consecutive_failures", failures)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
+				case <-s.wake:
+					// repositioned while waiting
 				case <-time.After(5 * time.Second):
 					// backoff before reconnecting
 				}
@@ -66,11 +198,14 @@ func (s *Subscriber) Start(ctx context.Context) error {
 }
 
 func (s *Subscriber) buildURL(cursor int64) string {
-	u, _ := url.Parse(s.url)
+	u, _ := url.Parse(s.cfg.FirehoseURL)
 	q := u.Query()
-	for _, c := range wantedCollections {
+	for _, c := range s.wantedCollections() {
 		q.Add("wantedCollections", c)
 	}
+	for _, did := range s.cfg.FirehoseWantedDIDs {
+		q.Add("wantedDids", did)
+	}
 	if cursor > 0 {
 		q.Set("cursor", fmt.Sprintf("%d", cursor))
 	}
@@ -78,28 +213,108 @@ func (s *Subscriber) buildURL(cursor int64) string {
 	return u.String()
 }
 
+// startCursor decides where to start reading the firehose. It prefers a
+// cursor requested by Reposition, which it saves, then the last event
+// processed on an earlier connection, then the saved cursor, then a
+// configured backfill window, then live. When a cursor is required and none
+// is available, it refuses unless explicitly overridden.
+//
+// Only the first connection reads the saved cursor: after that the
+// subscriber's own position is at least as recent, so reconnects during a
+// flapping outage don't each cost a database read.
+func (s *Subscriber) startCursor(ctx context.Context) (int64, error) {
+	if cursor, ok := s.takePending(); ok {
+		if err := s.feedService.UpdateCursor(ctx, CursorService, cursor); err != nil {
+			s.logger.Error("failed to save repositioned cursor", "error", err)
+		}
+		s.latest.Store(cursor)
+		s.logger.Info("repositioning firehose",
+			"cursor", cursor,
+			"start_ts", time.UnixMicro(cursor).UTC().Format(time.RFC3339Nano),
+		)
+		return cursor, nil
+	}
+
+	if cursor := s.latest.Load(); cursor > 0 {
+		s.logger.Info("resuming firehose from last processed event",
+			"cursor", cursor,
+			"start_ts", time.UnixMicro(cursor).UTC().Format(time.RFC3339Nano),
+		)
+		return cursor, nil
+	}
+
+	cursor, err := s.feedService.GetCursor(ctx, CursorService)
+	if err != nil {
+		s.logger.Warn("failed to load cursor", "error", err)
+		cursor = 0
+	}
+	if cursor > 0 {
+		s.logger.Info("resuming firehose from saved cursor",
+			"cursor", cursor,
+			"start_ts", time.UnixMicro(cursor).UTC().Format(time.RFC3339Nano),
+		)
+		return cursor, nil
+	}
+
+	if s.cfg.FirehoseRequireCursor && !s.cfg.FirehoseAllowStartWithoutCursor {
+		s.logger.Error("no saved firehose cursor and FEEDGEN_REQUIRE_CURSOR is set; " +
+			"set FEEDGEN_ALLOW_START_WITHOUT_CURSOR=true to start anyway")
+		return 0, ErrCursorRequired
+	}
+
+	if s.cfg.FirehoseBackfill > 0 {
+		start := time.Now().Add(-s.cfg.FirehoseBackfill)
+		s.logger.Info("no saved firehose cursor, backfilling",
+			"backfill", s.cfg.FirehoseBackfill,
+			"start_ts", start.UTC().Format(time.RFC3339Nano),
+		)
+		return start.UnixMicro(), nil
+	}
+
+	s.logger.Info("no saved firehose cursor, starting from live")
+	return 0, nil
+}
+
 func (s *Subscriber) subscribe(ctx context.Context) error {
-	cursor, err := s.feedService.GetCursor(ctx, cursorServiceName)
+	cursor, err := s.startCursor(ctx)
 	if err != nil {
-		s.logger.Warn("failed to load cursor, starting from live", "error", err)
+		return err
 	}
 
 	wsURL := s.buildURL(cursor)
 	s.logger.Info("connecting to firehose", "url", wsURL)
 
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	header := http.Header{}
+	if s.cfg.UserAgent != "" {
+		header.Set("User-Agent", s.cfg.UserAgent)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
 	if err != nil {
 		return fmt.Errorf("dial firehose: %w", err)
 	}
 	defer conn.Close()
 
+	// Closing the connection is the only way to interrupt a blocked read, so
+	// do it when ctx ends or Reposition asks for a new position.
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	if s.pending != nil {
+		cancel() // repositioned while dialing
+	}
+	s.cancelConn = cancel
+	s.mu.Unlock()
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
 	s.logger.Info("connected to firehose")
-	s.logger.Info("starting firehose processing", "start_ts", time.UnixMicro(cursor).Format(time.RFC3339Nano))
 
-	lastCursorSave := time.Now()
-	var latestCursor int64
-	var eventsReceived, commitsReceived, postsMatched int64
-	lastStatsLog := time.Now()
+	nextCursorSave := time.Now().Add(s.cursorSaveWait())
+	var latestCursor, savedCursor int64
+	var sinceSave int
+	minAdvance := s.cfg.FirehoseCursorMinAdvance.Microseconds()
 
 	for {
 		select {
@@ -108,93 +323,303 @@ func (s *Subscriber) subscribe(ctx context.Context) error {
 		default:
 		}
 
-		_, message, err := conn.ReadMessage()
+		msgType, message, err := conn.ReadMessage()
 		if err != nil {
 			return fmt.Errorf("read message: %w", err)
 		}
 
-		event, err := parseEvent(message)
+		payload, err := s.framePayload(msgType, message)
 		if err != nil {
-			s.logger.Error("failed to parse event", "error", err)
+			s.handleParseError(message, err)
 			continue
 		}
 
-		eventsReceived++
-		latestCursor = event.TimeUS
+		event, err := parseEvent(payload)
+		if err != nil {
+			s.handleParseError(message, err)
+			continue
+		}
+
+		s.stats.EventReceived()
 
 		if event.Kind == "commit" && event.Commit != nil {
-			commitsReceived++
-			if matched, err := s.handleCommit(ctx, event); err != nil {
+			s.stats.CommitProcessed()
+			matched, err := s.processCommit(connCtx, event)
+			if connCtx.Err() != nil {
+				return connCtx.Err() // don't advance past an unapplied event
+			}
+			switch {
+			case errors.Is(err, errEventAbandoned):
+				// already logged and counted; move past it
+			case err != nil:
 				s.logger.Error("failed to handle commit", "error", err)
-			} else if matched {
-				postsMatched++
+			default:
+				for _, feedURI := range matched {
+					s.stats.PostMatched(feedURI)
+				}
 			}
 		}
-
-		// Log stats every 30 seconds
-		if time.Since(lastStatsLog) >= 30*time.Second {
-			s.logger.Info("firehose stats",
-				"events_received", eventsReceived,
-				"commits_received", commitsReceived,
-				"posts_matched", postsMatched,
-			)
-			lastStatsLog = time.Now()
-		}
-
-		// Periodically save cursor
-		if time.Since(lastCursorSave) >= cursorSaveInterval {
-			if err := s.feedService.UpdateCursor(ctx, cursorServiceName, latestCursor); err != nil {
+		latestCursor = event.TimeUS
+		s.latest.Store(latestCursor)
+		s.lastEventAt.Store(time.Now().UnixNano())
+
+		// Periodically save cursor, or sooner after a burst of events,
+		// unless it has barely moved
+		sinceSave++
+		due := time.Now().After(nextCursorSave) ||
+			(s.cfg.FirehoseCursorSaveEvents > 0 && sinceSave >= s.cfg.FirehoseCursorSaveEvents)
+		if due && latestCursor-savedCursor >= minAdvance {
+			if err := s.feedService.UpdateCursor(ctx, CursorService, latestCursor); err != nil {
 				s.logger.Error("failed to save cursor", "error", err)
 			} else {
-				lastCursorSave = time.Now()
+				nextCursorSave = time.Now().Add(s.cursorSaveWait())
+				savedCursor = latestCursor
+				sinceSave = 0
 			}
 		}
 	}
 }
 
-func (s *Subscriber) handleCommit(ctx context.Context, event *jetstreamEvent) (matched bool, err error) {
-	commit := event.Commit
-	if commit.Collection != "app.bsky.feed.post" {
-		return false, nil
+// cursorSaveWait returns the configured cursor save interval with up to
+// cursorSaveJitter of random jitter either way.
+func (s *Subscriber) cursorSaveWait() time.Duration {
+	interval := s.cfg.FirehoseCursorSaveInterval
+	if interval <= 0 {
+		interval = defaultCursorSaveInterval
 	}
+	jitter := (rand.Float64()*2 - 1) * cursorSaveJitter
+	return interval + time.Duration(float64(interval)*jitter)
+}
 
-	uri := fmt.Sprintf("at://%s/%s/%s", event.DID, commit.Collection, commit.RKey)
+// zstdMagic starts every zstd frame. Jetstream sends zstd-compressed events
+// as binary messages when a client asks for compression.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// framePayload returns the JSON event carried by a WebSocket message.
+// Jetstream sends events as text messages; binary messages go to
+// binaryPayload. Other message types fail at the frame stage.
+func (s *Subscriber) framePayload(msgType int, message []byte) ([]byte, error) {
+	switch msgType {
+	case websocket.TextMessage:
+		return message, nil
+	case websocket.BinaryMessage:
+		return s.binaryPayload(message)
+	default:
+		return nil, &parseError{ParseStageFrame, fmt.Errorf("unexpected WebSocket message type %d", msgType)}
+	}
+}
 
-	switch commit.Operation {
-	case "create":
-		if commit.Record == nil {
-			return false, nil
+// binaryPayload handles a binary message. The subscriber doesn't request
+// compression, so zstd frames are rejected rather than decompressed; this is
+// where a decompressor would plug in. A binary message holding plain JSON is
+// parsed like a text one, with a warning the first time.
+func (s *Subscriber) binaryPayload(message []byte) ([]byte, error) {
+	if bytes.HasPrefix(message, zstdMagic) {
+		return nil, &parseError{ParseStageFrame, errors.New("zstd-compressed binary message, but compression isn't enabled")}
+	}
+	if trimmed := bytes.TrimLeft(message, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, &parseError{ParseStageFrame, fmt.Errorf("binary message of %d bytes is not JSON", len(message))}
+	}
+	if !s.warnedBinary {
+		s.logger.Warn("firehose sent JSON in a binary message; parsing it as text")
+		s.warnedBinary = true
+	}
+	return message, nil
+}
+
+// handleParseError records a parse failure and, if sampling is enabled, logs
+// a truncated copy of the offending payload at debug level.
+func (s *Subscriber) handleParseError(message []byte, err error) {
+	stage := ParseStageEvent
+	var perr *parseError
+	if errors.As(err, &perr) {
+		stage = perr.stage
+	}
+	s.stats.ParseFailed(stage)
+	s.parseFailures++
+	s.logger.Error("failed to parse event", "stage", stage, "error", err)
+
+	if n := s.cfg.FirehoseBadPayloadSampleRate; n > 0 && s.parseFailures%int64(n) == 0 {
+		s.logger.Debug("malformed firehose payload sample",
+			"stage", stage,
+			"payload", domain.PreviewText(string(message), maxPayloadSampleLen),
+		)
+	}
+}
+
+// WaitHandlers blocks until event handlers abandoned by the watchdog have
+// finished, or ctx is done. Call it after Start returns and before closing
+// the repository.
+func (s *Subscriber) WaitHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errEventAbandoned is returned by processCommit when an event ran past
+// FirehoseEventDeadline.
+var errEventAbandoned = errors.New("event abandoned after deadline")
+
+// processCommit applies a commit under the slow event watchdog. Events that
+// take longer than FirehoseSlowEventThreshold are logged and counted. If
+// FirehoseEventDeadline is set, the commit runs with that timeout and the
+// subscriber stops waiting for it once the deadline passes, so one poison
+// event can't wedge the read loop; the abandoned handler's context is
+// cancelled and it finishes in the background.
+func (s *Subscriber) processCommit(ctx context.Context, event *jetstreamEvent) ([]string, error) {
+	start := time.Now()
+	deadline := s.cfg.FirehoseEventDeadline
+	if deadline <= 0 {
+		matched, err := s.applyCommit(ctx, event)
+		s.checkSlow(event, time.Since(start))
+		return matched, err
+	}
+
+	eventCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	type result struct {
+		matched []string
+		err     error
+	}
+	done := make(chan result, 1)
+	s.handlers.Go(func() {
+		matched, err := s.applyCommit(eventCtx, event)
+		done <- result{matched, err}
+	})
+
+	select {
+	case r := <-done:
+		if r.err == nil || ctx.Err() != nil || !errors.Is(eventCtx.Err(), context.DeadlineExceeded) {
+			s.checkSlow(event, time.Since(start))
+			return r.matched, r.err
 		}
+		// The handler gave up because the deadline passed, e.g. while
+		// retrying under the block write failure policy.
+	case <-eventCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
 
-		incoming := &domain.IncomingPost{
-			URI:       uri,
-			CID:       commit.CID,
-			AuthorDID: event.DID,
-			Text:      commit.Record.Text,
-			Langs:     commit.Record.Langs,
+	s.stats.EventAbandoned()
+	s.logger.Error("abandoning firehose event after deadline",
+		"uri", commitURI(event),
+		"operation", event.Commit.Operation,
+		"time_us", event.TimeUS,
+		"deadline", deadline,
+	)
+	return nil, errEventAbandoned
+}
+
+// checkSlow warns about an event whose handling took longer than
+// FirehoseSlowEventThreshold.
+func (s *Subscriber) checkSlow(event *jetstreamEvent, took time.Duration) {
+	threshold := s.cfg.FirehoseSlowEventThreshold
+	if threshold <= 0 || took < threshold {
+		return
+	}
+	s.stats.EventSlow()
+	s.logger.Warn("slow firehose event",
+		"uri", commitURI(event),
+		"operation", event.Commit.Operation,
+		"time_us", event.TimeUS,
+		"duration", took,
+	)
+}
+
+// commitURI returns the AT URI of the record a commit event touches.
+func commitURI(event *jetstreamEvent) string {
+	return fmt.Sprintf("at://%s/%s/%s", event.DID, event.Commit.Collection, event.Commit.RKey)
+}
+
+// applyCommit handles a commit. Under the block write failure policy it
+// retries failed repository writes with backoff until the commit succeeds or
+// ctx is cancelled, so the cursor never moves past an event whose writes
+// failed. Other errors depend on the event itself and would fail every
+// retry, so they are returned for the event to be skipped.
+func (s *Subscriber) applyCommit(ctx context.Context, event *jetstreamEvent) ([]string, error) {
+	backoff := time.Second
+	for {
+		matched, err := s.handleCommit(ctx, event)
+		if err == nil || s.cfg.WriteFailurePolicy != string(domain.WriteFailureBlock) || !errors.Is(err, domain.ErrWriteFailed) {
+			return matched, err
+		}
+		s.logger.Error("failed to handle commit, retrying before advancing", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, maxBlockBackoff)
+	}
+}
 
-		matched, err := s.feedService.ProcessNewPost(ctx, incoming)
-		if err != nil {
-			return false, err
+// handleCommit dispatches a commit to the handler registered for its
+// collection. It returns the URIs of the feeds a newly created post was saved
+// to, if any.
+func (s *Subscriber) handleCommit(ctx context.Context, event *jetstreamEvent) (matched []string, err error) {
+	h, ok := collectionHandlers[event.Commit.Collection]
+	if !ok {
+		return nil, nil
+	}
+	return h.handle(s, ctx, event)
+}
+
+// handlePostCommit applies an app.bsky.feed.post commit to the feed service.
+func (s *Subscriber) handlePostCommit(ctx context.Context, event *jetstreamEvent) ([]string, error) {
+	commit := event.Commit
+
+	switch commit.Operation {
+	case "create":
+		if commit.Record == nil {
+			return nil, nil
 		}
+		return s.feedService.ProcessNewPost(ctx, incomingPost(event))
 
-		return matched, nil
+	case "update":
+		if commit.Record == nil {
+			return nil, nil
+		}
+		return s.feedService.ProcessUpdatedPost(ctx, incomingPost(event))
 
 	case "delete":
-		return false, s.feedService.ProcessDeletePost(ctx, uri)
+		return nil, s.feedService.ProcessDeletePost(ctx, commitURI(event))
 
 	default:
-		return false, nil
+		return nil, nil
 	}
 }
 
-// truncate returns the first n characters of s, appending "..." if truncated.
-func truncate(s string, n int) string {
-	if len(s) <= n {
-		return s
+// incomingPost converts a post commit that carries a record.
+func incomingPost(event *jetstreamEvent) *domain.IncomingPost {
+	commit := event.Commit
+	links := commit.Record.links()
+	quoted := commit.Record.quotedURI()
+	return &domain.IncomingPost{
+		URI:       commitURI(event),
+		CID:       commit.CID,
+		AuthorDID: event.DID,
+		Text:      commit.Record.Text,
+		Langs:     commit.Record.Langs,
+		CreatedAt: commit.Record.createdAt(),
+		Tags:      commit.Record.hashtags(),
+		Mentions:  commit.Record.mentions(),
+		Links:     links,
+		LinkCount: len(links),
+		QuotedURI: quoted,
+		IsQuote:   quoted != "",
+
+		ReplyRootURI: commit.Record.replyRootURI(),
 	}
-	return s[:n] + "..."
 }
 
 func parseEvent(data []byte) (*jetstreamEvent, error) {
@@ -206,7 +631,7 @@ func parseEvent(data []byte) (*jetstreamEvent, error) {
 	}
 
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("unmarshal event: %w", err)
+		return nil, &parseError{ParseStageEvent, fmt.Errorf("unmarshal event: %w", err)}
 	}
 
 	event := &jetstreamEvent{
@@ -225,7 +650,7 @@ func parseEvent(data []byte) (*jetstreamEvent, error) {
 			CID        string          `json:"cid"`
 		}
 		if err := json.Unmarshal(raw.Commit, &rc); err != nil {
-			return nil, fmt.Errorf("unmarshal commit: %w", err)
+			return nil, &parseError{ParseStageCommit, fmt.Errorf("unmarshal commit: %w", err)}
 		}
 
 		commit := &jetstreamCommit{
@@ -236,12 +661,10 @@ func parseEvent(data []byte) (*jetstreamEvent, error) {
 			CID:        rc.CID,
 		}
 
-		if len(rc.Record) > 0 && strings.HasPrefix(rc.Collection, "app.bsky.feed.post") {
-			var record postRecord
-			if err := json.Unmarshal(rc.Record, &record); err != nil {
-				return nil, fmt.Errorf("unmarshal post record: %w", err)
+		if h, ok := collectionHandlers[rc.Collection]; ok && len(rc.Record) > 0 {
+			if err := h.decode(commit, rc.Record); err != nil {
+				return nil, &parseError{ParseStageRecord, err}
 			}
-			commit.Record = &record
 		}
 
 		event.Commit = commit
@@ -0,0 +1,203 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/sqlite"
+	"github.com/gorilla/websocket"
+)
+
+const testFeedURI = "at://did:plc:publisher/app.bsky.feed.generator/golang"
+
+// newTestSubscriber wires a subscriber to a feed service backed by a fresh
+// SQLite database with a single feed matching "golang".
+func newTestSubscriber(t *testing.T) (*Subscriber, *domain.FeedService) {
+	t.Helper()
+	repo, err := sqlite.NewRepository(t.TempDir()+"/db", sqlite.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	logger := slog.New(slog.DiscardHandler)
+	svc, err := domain.NewFeedService([]domain.FeedConfig{
+		{URI: testFeedURI, Keywords: []string{"golang"}},
+	}, repo, repo, domain.ServiceOptions{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSubscriber(&config.Config{}, svc, NewLogStatsReporter(logger, time.Hour), logger), svc
+}
+
+func postEvent(rkey, operation, text string) string {
+	commit := fmt.Sprintf(`{"rev":"1","operation":%q,"collection":"app.bsky.feed.post","rkey":%q`, operation, rkey)
+	if operation != "delete" {
+		commit += fmt.Sprintf(`,"cid":"bafyrei%s","record":{"$type":"app.bsky.feed.post","text":%q,"langs":["en"],"createdAt":%q}`,
+			rkey, text, time.Now().UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf(`{"did":"did:plc:author","time_us":%d,"kind":"commit","commit":%s}}`, time.Now().UnixMicro(), commit)
+}
+
+func TestCommitPipeline(t *testing.T) {
+	s, svc := newTestSubscriber(t)
+	ctx := context.Background()
+	const matchURI = "at://did:plc:author/app.bsky.feed.post/match"
+
+	feedPosts := func() []string {
+		t.Helper()
+		skeleton, err := svc.GetFeedSkeleton(ctx, testFeedURI, 10, "", nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var uris []string
+		for _, p := range skeleton.Posts {
+			uris = append(uris, p.Post)
+		}
+		return uris
+	}
+
+	steps := []struct {
+		name        string
+		event       string
+		wantMatched []string
+		wantFeed    []string
+	}{
+		{"matching create", postEvent("match", "create", "Writing more golang today"), []string{testFeedURI}, []string{matchURI}},
+		{"non-matching create", postEvent("miss", "create", "Writing more rust today"), nil, []string{matchURI}},
+		{"delete", postEvent("match", "delete", ""), nil, nil},
+	}
+	for _, step := range steps {
+		event, err := parseEvent([]byte(step.event))
+		if err != nil {
+			t.Fatalf("%s: parseEvent: %v", step.name, err)
+		}
+		matched, err := s.handleCommit(ctx, event)
+		if err != nil {
+			t.Fatalf("%s: handleCommit: %v", step.name, err)
+		}
+		if !slices.Equal(matched, step.wantMatched) {
+			t.Errorf("%s: matched feeds = %q, want %q", step.name, matched, step.wantMatched)
+		}
+		if got := feedPosts(); !slices.Equal(got, step.wantFeed) {
+			t.Errorf("%s: feed posts = %q, want %q", step.name, got, step.wantFeed)
+		}
+	}
+}
+
+func TestFramePayload(t *testing.T) {
+	event := []byte(`{"did":"did:plc:author","time_us":1,"kind":"identity"}`)
+	tests := []struct {
+		name    string
+		msgType int
+		message []byte
+		wantErr bool
+	}{
+		{"text frame", websocket.TextMessage, event, false},
+		{"binary frame with JSON", websocket.BinaryMessage, event, false},
+		{"binary frame with leading whitespace", websocket.BinaryMessage, append([]byte("\n "), event...), false},
+		{"binary zstd frame", websocket.BinaryMessage, append([]byte{0x28, 0xb5, 0x2f, 0xfd}, "compressed"...), true},
+		{"binary frame with other bytes", websocket.BinaryMessage, []byte{0x00, 0x01, 0x02}, true},
+		{"empty binary frame", websocket.BinaryMessage, nil, true},
+		{"other message type", websocket.PingMessage, event, true},
+	}
+	s, _ := newTestSubscriber(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := s.framePayload(tt.msgType, tt.message)
+			if tt.wantErr {
+				var perr *parseError
+				if !errors.As(err, &perr) || perr.stage != ParseStageFrame {
+					t.Fatalf("framePayload() error = %v, want a frame stage parse error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("framePayload() error = %v", err)
+			}
+			if _, err := parseEvent(payload); err != nil {
+				t.Errorf("parseEvent(framePayload()) error = %v", err)
+			}
+		})
+	}
+	if !s.warnedBinary {
+		t.Error("binary JSON frames weren't logged")
+	}
+}
+
+func TestApplyCommitBlockRetriesOnlyWriteFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"write failure", fmt.Errorf("%w: create post: database is locked", domain.ErrWriteFailed), 2},
+		{"event error", errors.New("invalid record"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestSubscriber(t)
+			s.cfg.WriteFailurePolicy = string(domain.WriteFailureBlock)
+
+			const collection = "test.failing"
+			calls := 0
+			collectionHandlers[collection] = collectionHandler{
+				handle: func(*Subscriber, context.Context, *jetstreamEvent) ([]string, error) {
+					calls++
+					if calls == 1 {
+						return nil, tt.err
+					}
+					return nil, nil
+				},
+			}
+			t.Cleanup(func() { delete(collectionHandlers, collection) })
+
+			event := &jetstreamEvent{DID: "did:plc:author", Commit: &jetstreamCommit{Operation: "create", Collection: collection, RKey: "1"}}
+			_, err := s.applyCommit(context.Background(), event)
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			if wantErr := tt.wantCalls == 1; (err != nil) != wantErr {
+				t.Errorf("applyCommit() error = %v, want error: %t", err, wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitHandlersWaitsForAbandonedEvents(t *testing.T) {
+	s, _ := newTestSubscriber(t)
+	s.cfg.FirehoseEventDeadline = 10 * time.Millisecond
+
+	const collection = "test.stuck"
+	release := make(chan struct{})
+	collectionHandlers[collection] = collectionHandler{
+		handle: func(*Subscriber, context.Context, *jetstreamEvent) ([]string, error) {
+			<-release // ignores its context, like CPU-bound matching
+			return nil, nil
+		},
+	}
+	t.Cleanup(func() { delete(collectionHandlers, collection) })
+
+	event := &jetstreamEvent{DID: "did:plc:author", Commit: &jetstreamCommit{Operation: "create", Collection: collection, RKey: "1"}}
+	if _, err := s.processCommit(context.Background(), event); !errors.Is(err, errEventAbandoned) {
+		t.Fatalf("processCommit() error = %v, want %v", err, errEventAbandoned)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.WaitHandlers(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitHandlers() with the handler running = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := s.WaitHandlers(context.Background()); err != nil {
+		t.Errorf("WaitHandlers() after the handler finished = %v", err)
+	}
+}
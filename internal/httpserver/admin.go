@@ -0,0 +1,208 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// maxAdminBodyBytes bounds admin request bodies.
+const maxAdminBodyBytes = 4 << 10
+
+// maxKeywordPosts bounds the page size of GET /admin/posts.
+const maxKeywordPosts = 500
+
+// Firehose is the running firehose subscriber, as seen by the server.
+type Firehose interface {
+	// Reposition saves timeUS as the firehose cursor and reconnects from it,
+	// returning the previous cursor.
+	Reposition(ctx context.Context, timeUS int64) (int64, error)
+
+	// Position returns the cursor of the last processed event and when it
+	// was processed, or zeros if none has been.
+	Position() (int64, time.Time)
+}
+
+// SetFirehose enables POST /admin/cursor, which repositions f, and adds f's
+// lag behind live to /stats.
+func (s *Server) SetFirehose(f Firehose) {
+	s.firehose = f
+}
+
+// requireAdmin wraps an admin handler so it only runs for requests bearing
+// the configured admin token. Without a token configured, admin endpoints
+// don't exist.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "AuthenticationRequired", "valid admin token required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// cursorRequest is the body of POST /admin/cursor. Exactly one field is set.
+type cursorRequest struct {
+	// TimeUS is the Jetstream cursor, in microseconds since the epoch, to
+	// resume from.
+	TimeUS int64 `json:"time_us"`
+
+	// Position is "live" or "now" to skip to the present.
+	Position string `json:"position"`
+}
+
+func (s *Server) handleAdminCursor(w http.ResponseWriter, r *http.Request) {
+	if s.firehose == nil {
+		writeError(w, http.StatusServiceUnavailable, "Unavailable", "firehose subscriber is not running")
+		return
+	}
+
+	var req cursorRequest
+	if !decodeJSON(w, r, &req, maxAdminBodyBytes) {
+		return
+	}
+
+	now := time.Now()
+	var cursor int64
+	switch {
+	case req.TimeUS != 0 && req.Position != "":
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "set only one of time_us and position")
+		return
+	case req.Position == "live" || req.Position == "now":
+		cursor = now.UnixMicro()
+	case req.Position != "":
+		writeError(w, http.StatusBadRequest, "InvalidRequest", `position must be "live" or "now"`)
+		return
+	case req.TimeUS <= 0 || req.TimeUS > now.Add(time.Minute).UnixMicro():
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "time_us must be a positive microsecond timestamp not in the future")
+		return
+	default:
+		cursor = req.TimeUS
+	}
+
+	old, err := s.firehose.Reposition(r.Context(), cursor)
+	if err != nil {
+		s.logger.Error("failed to reposition firehose", "cursor", cursor, "error", err)
+		writeError(w, http.StatusInternalServerError, "InternalError", "failed to reposition firehose")
+		return
+	}
+	s.logger.Warn("firehose repositioned by admin request", "old_cursor", old, "new_cursor", cursor, "remote_addr", remoteAddr(r, s.cfg.TrustedProxies))
+
+	writeJSON(w, http.StatusOK, map[string]int64{
+		"old_cursor": old,
+		"new_cursor": cursor,
+	})
+}
+
+// traceRequest is the body of POST /admin/trace.
+type traceRequest struct {
+	Enabled bool `json:"enabled"`
+
+	// SampleRate is the fraction of posts traced, between 0 and 1. Zero
+	// means 1.
+	SampleRate float64 `json:"sample_rate"`
+
+	// Duration, e.g. "5m", turns tracing off again after that long. Empty
+	// leaves it on until turned off.
+	Duration string `json:"duration"`
+}
+
+func (s *Server) handleSetTrace(w http.ResponseWriter, r *http.Request) {
+	var req traceRequest
+	if !decodeJSON(w, r, &req, maxAdminBodyBytes) {
+		return
+	}
+	if req.SampleRate < 0 || req.SampleRate > 1 {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "sample_rate must be between 0 and 1")
+		return
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", `duration must be a positive duration such as "5m"`)
+			return
+		}
+	}
+
+	s.feedService.SetTrace(req.Enabled, req.SampleRate, d)
+	s.logger.Warn("matching trace changed by admin request", "enabled", req.Enabled, "remote_addr", remoteAddr(r, s.cfg.TrustedProxies))
+	s.handleGetTrace(w, r)
+}
+
+func (s *Server) handleGetTrace(w http.ResponseWriter, _ *http.Request) {
+	status := s.feedService.TraceStatus()
+	resp := map[string]any{
+		"enabled":     status.Enabled,
+		"sample_rate": status.SampleRate,
+		"until":       nil,
+	}
+	if !status.Until.IsZero() {
+		resp["until"] = status.Until.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// keywordPost is one post in the GET /admin/posts response.
+type keywordPost struct {
+	URI             string   `json:"uri"`
+	AuthorDID       string   `json:"author_did"`
+	Text            string   `json:"text"`
+	IndexedAt       string   `json:"indexed_at"`
+	MatchedKeywords []string `json:"matched_keywords"`
+}
+
+// handleKeywordPosts serves GET /admin/posts?feed=...&keyword=...&limit=...,
+// listing the feed's stored posts that matched keyword, newest first.
+func (s *Server) handleKeywordPosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	feedURI, keyword := q.Get("feed"), q.Get("keyword")
+	if feedURI == "" || keyword == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "feed and keyword are required")
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxKeywordPosts {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", "limit must be between 1 and "+strconv.Itoa(maxKeywordPosts))
+			return
+		}
+		limit = n
+	}
+
+	posts, err := s.feedService.PostsMatchedBy(r.Context(), feedURI, keyword, limit)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownFeed) {
+			writeError(w, http.StatusNotFound, "NotFound", "feed not found")
+			return
+		}
+		s.logger.Error("failed to get posts by keyword", "feed", feedURI, "keyword", keyword, "error", err)
+		writeError(w, http.StatusInternalServerError, "InternalError", "failed to get posts")
+		return
+	}
+
+	resp := make([]keywordPost, len(posts))
+	for i, p := range posts {
+		resp[i] = keywordPost{
+			URI:             p.URI,
+			AuthorDID:       p.AuthorDID,
+			Text:            p.Text,
+			IndexedAt:       p.IndexedAt.UTC().Format(time.RFC3339Nano),
+			MatchedKeywords: p.MatchedKeywords[feedURI],
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"posts": resp})
+}
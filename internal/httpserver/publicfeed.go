@@ -0,0 +1,219 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
+)
+
+// publicFeedLimit is how many posts the public feed documents list.
+const publicFeedLimit = 50
+
+// jsonFeed is a JSON Feed 1.1 document (https://jsonfeed.org/version/1.1).
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	ContentText   string `json:"content_text"`
+	DatePublished string `json:"date_published"`
+}
+
+// rssFeed is an RSS 2.0 document.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string  `xml:"title"`
+	Link    string  `xml:"link"`
+	GUID    rssGUID `xml:"guid"`
+	PubDate string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// handlePublicFeed serves GET /feed/{file}, where file is a feed's rkey with
+// a .json (JSON Feed) or .rss (RSS) extension. Only feeds configured as
+// Public are served; everything else is a 404.
+func (s *Server) handlePublicFeed(w http.ResponseWriter, r *http.Request) {
+	logger := logctx.From(r.Context(), s.logger)
+
+	file := r.PathValue("file")
+	ext := path.Ext(file)
+	rkey := strings.TrimSuffix(file, ext)
+	if (ext != ".json" && ext != ".rss") || rkey == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.publicLimiter.allow(remoteAddr(r, s.cfg.TrustedProxies), time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusTooManyRequests, "RateLimitExceeded", "too many requests")
+		return
+	}
+
+	host := s.cfg.HostFor(r.Host)
+	var feedURI string
+	for _, uri := range s.hostFeedURIs(host) {
+		if path.Base(uri) == rkey {
+			feedURI = uri
+			break
+		}
+	}
+	if feedURI == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts, err := s.feedService.PublicPosts(r.Context(), feedURI, publicFeedLimit)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownFeed) {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error("failed to get public feed posts", "feed", feedURI, "error", err)
+		writeError(w, http.StatusInternalServerError, "InternalServerError", "failed to get feed")
+		return
+	}
+
+	base := "https://" + host.Hostname
+	home := "https://bsky.app/profile/" + feedAuthority(feedURI) + "/feed/" + rkey
+	w.Header().Set("Cache-Control", "public, max-age=60")
+
+	if ext == ".json" {
+		doc := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       rkey,
+			HomePageURL: home,
+			FeedURL:     base + "/feed/" + file,
+			Items:       make([]jsonFeedItem, 0, len(posts)),
+		}
+		for _, p := range posts {
+			doc.Items = append(doc.Items, jsonFeedItem{
+				ID:            p.URI,
+				URL:           p.WebURL(),
+				ContentText:   publicPostText(p),
+				DatePublished: p.IndexedAt.UTC().Format(time.RFC3339),
+			})
+		}
+		w.Header().Set("Content-Type", "application/feed+json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(doc)
+		return
+	}
+
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       rkey,
+			Link:        home,
+			Description: "Posts in the " + rkey + " Bluesky feed",
+		},
+	}
+	for _, p := range posts {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:   domain.PreviewText(publicPostText(p), 0),
+			Link:    p.WebURL(),
+			GUID:    rssGUID{Value: p.URI},
+			PubDate: p.IndexedAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(doc); err != nil {
+		logger.Warn("failed to write RSS feed", "feed", feedURI, "error", err)
+	}
+}
+
+// publicPostText is the text shown for a post in the public feed documents:
+// its stored text, or a line naming the author for posts without text, such
+// as those added through reposts.
+func publicPostText(p domain.Post) string {
+	if p.Text != "" {
+		return p.Text
+	}
+	return "Post by " + feedAuthority(p.URI)
+}
+
+// rateLimiter is a per-client token bucket allowing perMinute requests a
+// minute, with bursts of up to perMinute.
+type rateLimiter struct {
+	perMinute int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow reports whether client may make a request at now, using up a token
+// if so.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(l.perMinute)
+	refill := func(b *tokenBucket) {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Minutes()*capacity)
+		b.last = now
+	}
+
+	// Forget clients whose buckets have refilled, so the map stays bounded
+	// by the clients seen in the last minute or so.
+	if now.Sub(l.swept) > time.Minute {
+		for c, b := range l.buckets {
+			if refill(b); b.tokens >= capacity {
+				delete(l.buckets, c)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[client] = b
+	}
+	refill(b)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,56 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
+)
+
+// requesterAuthTimeout bounds the DID document lookup behind a requester's
+// first verified token. A slow lookup only costs the requester their saved
+// position, so the feed isn't held up for long.
+const requesterAuthTimeout = 2 * time.Second
+
+// getFeedSkeletonMethod is the XRPC method service auth tokens for feed
+// requests may be scoped to.
+const getFeedSkeletonMethod = "app.bsky.feed.getFeedSkeleton"
+
+// TokenVerifier checks a service auth JWT and returns the DID that signed
+// it. *serviceauth.Verifier implements it.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token, audience, method string) (string, error)
+}
+
+// SetTokenVerifier lets feeds with ResumeFromLastSeen identify requesters by
+// their verified service auth token. Without a verifier no requester is
+// identified, so read positions are never used.
+func (s *Server) SetTokenVerifier(v TokenVerifier) {
+	s.tokens = v
+}
+
+// requesterDID returns the DID of the account making a request for feedURI,
+// taken from the service auth JWT the AppView forwards in the Authorization
+// header once its signature has been verified against the issuer's signing
+// key. It returns "" if the feed doesn't use the requester, there is no
+// verifier, or the token doesn't verify.
+func (s *Server) requesterDID(r *http.Request, host config.Host, feedURI string) string {
+	if s.tokens == nil || !s.feedService.UsesRequester(feedURI) {
+		return ""
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), requesterAuthTimeout)
+	defer cancel()
+	did, err := s.tokens.Verify(ctx, token, host.ServiceDID(), getFeedSkeletonMethod)
+	if err != nil {
+		logctx.From(r.Context(), s.logger).Debug("ignoring requester token", "error", err)
+		return ""
+	}
+	return did
+}
@@ -1,17 +1,31 @@
 package httpserver
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blackmichael/bluesky-feeds/internal/config"
 	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
 )
 
 // Server is the HTTP server that serves feed generator XRPC endpoints.
@@ -20,6 +34,21 @@ type Server struct {
 	feedService *domain.FeedService
 	logger      *slog.Logger
 	httpServer  *http.Server
+
+	// redirectServer redirects plain HTTP to HTTPS. nil unless TLS and a
+	// redirect port are configured.
+	redirectServer *http.Server
+	cert           atomic.Pointer[tls.Certificate] // swapped on reload
+
+	firehose Firehose      // nil until SetFirehose is called
+	tokens   TokenVerifier // nil until SetTokenVerifier is called
+
+	// lastGood caches the most recent successful first page per feed URI for
+	// degraded serving. Only used when cfg.DegradedServing is set.
+	lastGoodMu sync.RWMutex
+	lastGood   map[string][]domain.SkeletonPost
+
+	publicLimiter *rateLimiter // rate limits the public /feed documents
 }
 
 // NewServer creates a new HTTP server with the given feed service.
@@ -28,127 +57,505 @@ func NewServer(cfg *config.Config, feedService *domain.FeedService, logger *slog
 		cfg:         cfg,
 		feedService: feedService,
 		logger:      logger,
+		lastGood:    make(map[string][]domain.SkeletonPost),
+
+		publicLimiter: newRateLimiter(cfg.PublicFeedRateLimit),
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /.well-known/did.json", s.handleDIDDoc)
 	mux.HandleFunc("GET /xrpc/app.bsky.feed.describeFeedGenerator", s.handleDescribeFeedGenerator)
 	mux.HandleFunc("GET /xrpc/app.bsky.feed.getFeedSkeleton", s.handleGetFeedSkeleton)
+	if cfg.SkeletonPost {
+		mux.HandleFunc("POST /xrpc/app.bsky.feed.getFeedSkeleton", s.handlePostFeedSkeleton)
+	}
 	mux.HandleFunc("GET /health", s.handleHealth)
 
+	// Optional subsystems are only routed when their feature is on
+	features := cfg.Features
+	if features.PublicFeeds {
+		mux.HandleFunc("GET /feed/{file}", s.handlePublicFeed)
+	}
+	if features.Stats {
+		mux.HandleFunc("GET /stats", s.handleStats)
+		mux.HandleFunc("GET /stats/feeds", s.handleFeedStats)
+	}
+	if features.Admin {
+		mux.HandleFunc("POST /admin/cursor", s.requireAdmin(s.handleAdminCursor))
+		mux.HandleFunc("GET /admin/posts", s.requireAdmin(s.handleKeywordPosts))
+		if features.Trace {
+			mux.HandleFunc("GET /admin/trace", s.requireAdmin(s.handleGetTrace))
+			mux.HandleFunc("POST /admin/trace", s.requireAdmin(s.handleSetTrace))
+		}
+	}
+
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      withLogging(logger, mux),
+		Handler:      withLogging(logger, cfg.TrustedProxies, mux),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if s.tlsEnabled() {
+		s.httpServer.TLSConfig = s.tlsConfig()
+		if cfg.HTTPRedirectPort > 0 {
+			s.redirectServer = &http.Server{
+				Addr:         fmt.Sprintf(":%d", cfg.HTTPRedirectPort),
+				Handler:      s.redirectHandler(),
+				ReadTimeout:  10 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			}
+		}
+	}
 
 	return s
 }
 
-// Start begins listening for HTTP requests. It blocks until the server is
-// shut down or an error occurs.
+// Start begins listening for HTTP requests, or HTTPS with HTTP/2 when TLS is
+// configured, along with the HTTP-to-HTTPS redirect listener if enabled. It
+// blocks until the server is shut down or an error occurs.
 func (s *Server) Start() error {
-	s.logger.Info("starting HTTP server", "addr", s.httpServer.Addr)
-	return s.httpServer.ListenAndServe()
+	if !s.tlsEnabled() {
+		s.logger.Info("starting HTTP server", "addr", s.httpServer.Addr)
+		return s.httpServer.ListenAndServe()
+	}
+
+	if s.cert.Load() == nil {
+		if err := s.ReloadCertificate(); err != nil {
+			return err
+		}
+	}
+	if s.redirectServer != nil {
+		go func() {
+			s.logger.Info("starting HTTP redirect server", "addr", s.redirectServer.Addr)
+			if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.logger.Error("http redirect server exited with error", "error", err)
+			}
+		}()
+	}
+	s.logger.Info("starting HTTPS server", "addr", s.httpServer.Addr)
+	return s.httpServer.ListenAndServeTLS("", "")
 }
 
-// Shutdown gracefully shuts down the HTTP server.
+// Shutdown gracefully shuts down the HTTP server and redirect server.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	var errs []error
+	if s.redirectServer != nil {
+		errs = append(errs, s.redirectServer.Shutdown(ctx))
+	}
+	errs = append(errs, s.httpServer.Shutdown(ctx))
+	return errors.Join(errs...)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	h := s.feedService.Health()
+	if !h.Degraded {
+		resp := map[string]any{"status": "ok"}
+		if h.RepositoryState != "" {
+			resp["repository_state"] = h.RepositoryState
+		}
+		if h.InFlightQueries >= 0 {
+			resp["in_flight_queries"] = h.InFlightQueries
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	// Still 200: the server is alive and serving, it just can't persist new
+	// posts right now. Restarting it wouldn't help.
+	resp := map[string]any{
+		"status":        "degraded",
+		"pending_posts": h.PendingPosts,
+		"dropped_posts": h.DroppedPosts,
+		"error":         h.LastError,
+	}
+	if h.RepositoryState != "" {
+		resp["repository_state"] = h.RepositoryState
+	}
+	if h.InFlightQueries >= 0 {
+		resp["in_flight_queries"] = h.InFlightQueries
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleDIDDoc(w http.ResponseWriter, _ *http.Request) {
-	doc := map[string]any{
+// handleStats reports operational statistics: how far the firehose is behind
+// live, and per-keyword match counts for each feed over the keyword stats
+// window.
+func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
+	resp := map[string]any{}
+	if s.firehose != nil {
+		resp["firehose"] = firehoseStats(s.firehose, time.Now())
+	}
+	resp["page_depths"] = s.feedService.PageDepths()
+	if n := s.feedService.InFlightQueries(); n >= 0 {
+		resp["in_flight_queries"] = n
+	}
+	if kw, ok := s.feedService.KeywordStats(); ok {
+		resp["keywords"] = map[string]any{
+			"window": kw.Window.String(),
+			"feeds":  kw.Feeds,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleFeedStats serves GET /stats/feeds: each feed's indexed post count
+// and last match time, keyed by feed URI.
+func (s *Server) handleFeedStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.feedService.FeedStats(r.Context())
+	if err != nil {
+		logctx.From(r.Context(), s.logger).Error("failed to get feed stats", "error", err)
+		writeError(w, http.StatusInternalServerError, "InternalServerError", "failed to get feed stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// firehoseStats describes the subscriber's position as of now. lag_seconds is
+// how far the last processed event is behind live; it grows during catch-up
+// and when the subscriber falls behind. idle_seconds is how long ago that
+// event was processed, which grows when the connection stalls.
+func firehoseStats(f Firehose, now time.Time) map[string]any {
+	cursor, at := f.Position()
+	if cursor == 0 {
+		return map[string]any{"cursor": nil, "lag_seconds": nil, "last_event_at": nil, "idle_seconds": nil}
+	}
+	return map[string]any{
+		"cursor":        cursor,
+		"lag_seconds":   now.Sub(time.UnixMicro(cursor)).Seconds(),
+		"last_event_at": at.UTC().Format(time.RFC3339Nano),
+		"idle_seconds":  now.Sub(at).Seconds(),
+	}
+}
+
+// Preflight checks that the server has something valid to serve: at least
+// one feed, every feed published by an allowed publisher DID, a DID document
+// that renders with a usable service endpoint, and, with TLS enabled, a
+// loadable certificate.
+// Call it before Start so a misconfigured server fails fast instead of
+// answering requests.
+func (s *Server) Preflight() error {
+	uris := s.feedService.FeedURIs()
+	if len(uris) == 0 {
+		return errors.New("no feeds configured")
+	}
+
+	// A feed URI under another account's DID can't be resolved back to this
+	// generator, so clients would be served feeds they can't load.
+	mismatched := 0
+	for _, uri := range uris {
+		authority := feedAuthority(uri)
+		if !s.cfg.IsAllowedPublisher(authority) {
+			s.logger.Error("feed URI is not under the publisher DID",
+				"feed", uri,
+				"feed_did", authority,
+				"publisher_did", s.cfg.PublisherDID,
+				"allowed_publisher_dids", s.cfg.AllowedPublisherDIDs,
+			)
+			mismatched++
+		}
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("%d feed URI(s) don't match FEEDGEN_PUBLISHER_DID %s, FEEDGEN_ALLOWED_PUBLISHER_DIDS or FEEDGEN_EXTRA_HOSTS", mismatched, s.cfg.PublisherDID)
+	}
+
+	for _, host := range s.cfg.Hosts() {
+		doc := DIDDocument(host)
+		if _, err := json.Marshal(doc); err != nil {
+			return fmt.Errorf("render DID document for %s: %w", host.Hostname, err)
+		}
+		endpoint, err := url.Parse(fmt.Sprintf("https://%s", host.Hostname))
+		if err != nil || endpoint.Host == "" || endpoint.Path != "" {
+			return fmt.Errorf("DID document service endpoint for hostname %q is not a valid URL", host.Hostname)
+		}
+	}
+
+	return s.ReloadCertificate()
+}
+
+func (s *Server) handleDIDDoc(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, DIDDocument(s.cfg.HostFor(r.Host)))
+}
+
+// DIDDocument returns the did:web document served at
+// /.well-known/did.json, advertising the feed generator's service endpoint.
+func DIDDocument(host config.Host) map[string]any {
+	return map[string]any{
 		"@context": []string{"https://www.w3.org/ns/did/v1"},
-		"id":       s.cfg.ServiceDID(),
+		"id":       host.ServiceDID(),
 		"service": []map[string]any{
 			{
 				"id":              "#bsky_fg",
 				"type":            "BskyFeedGenerator",
-				"serviceEndpoint": fmt.Sprintf("https://%s", s.cfg.Hostname),
+				"serviceEndpoint": fmt.Sprintf("https://%s", host.Hostname),
 			},
 		},
 	}
-	writeJSON(w, http.StatusOK, doc)
 }
 
-func (s *Server) handleDescribeFeedGenerator(w http.ResponseWriter, _ *http.Request) {
-	uris := s.feedService.FeedURIs()
+// hostFeedURIs returns the URIs of the feeds served under host, sorted.
+func (s *Server) hostFeedURIs(host config.Host) []string {
+	var uris []string
+	for _, uri := range s.feedService.FeedURIs() {
+		if host.Serves(feedAuthority(uri)) {
+			uris = append(uris, uri)
+		}
+	}
+	slices.Sort(uris)
+	return uris
+}
+
+// feedAuthority returns the publisher DID of a feed AT-URI.
+func feedAuthority(uri string) string {
+	authority, _, _ := strings.Cut(strings.TrimPrefix(uri, "at://"), "/")
+	return authority
+}
+
+func (s *Server) handleDescribeFeedGenerator(w http.ResponseWriter, r *http.Request) {
+	host := s.cfg.HostFor(r.Host)
+	uris := s.hostFeedURIs(host)
 	feeds := make([]map[string]string, 0, len(uris))
 	for _, uri := range uris {
 		feeds = append(feeds, map[string]string{"uri": uri})
 	}
 
 	resp := map[string]any{
-		"did":   s.cfg.ServiceDID(),
+		"did":   host.ServiceDID(),
 		"feeds": feeds,
 	}
+
+	links := map[string]string{}
+	if s.cfg.PrivacyPolicyURL != "" {
+		links["privacyPolicy"] = s.cfg.PrivacyPolicyURL
+	}
+	if s.cfg.TermsOfServiceURL != "" {
+		links["termsOfService"] = s.cfg.TermsOfServiceURL
+	}
+	if len(links) > 0 {
+		resp["links"] = links
+	}
+
 	writeJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) handleGetFeedSkeleton(w http.ResponseWriter, r *http.Request) {
-	feedURI := r.URL.Query().Get("feed")
+	s.serveFeedSkeleton(w, r, r.URL.Query())
+}
+
+// maxSkeletonBodyBytes bounds getFeedSkeleton POST bodies.
+const maxSkeletonBodyBytes = 16 << 10
+
+// skeletonRequest is the body of a getFeedSkeleton POST.
+type skeletonRequest struct {
+	Feed   string `json:"feed"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+// handlePostFeedSkeleton serves getFeedSkeleton with its parameters in a JSON
+// body. Parameters also given in the query string take precedence, and the
+// response is the same as for a GET.
+func (s *Server) handlePostFeedSkeleton(w http.ResponseWriter, r *http.Request) {
+	var req skeletonRequest
+	if !decodeJSON(w, r, &req, maxSkeletonBodyBytes) {
+		return
+	}
+
+	params := r.URL.Query()
+	fill := func(name, value string) {
+		if params.Get(name) == "" && value != "" {
+			params.Set(name, value)
+		}
+	}
+	fill("feed", req.Feed)
+	if req.Limit != 0 {
+		fill("limit", strconv.Itoa(req.Limit))
+	}
+	fill("cursor", req.Cursor)
+
+	s.serveFeedSkeleton(w, r, params)
+}
+
+// serveFeedSkeleton answers getFeedSkeleton with the given parameters.
+func (s *Server) serveFeedSkeleton(w http.ResponseWriter, r *http.Request, params url.Values) {
+	logger := logctx.From(r.Context(), s.logger)
+
+	feedURI := params.Get("feed")
 	if feedURI == "" {
-		s.logger.Warn("getFeedSkeleton called without feed parameter")
+		logger.Warn("getFeedSkeleton called without feed parameter")
 		writeError(w, http.StatusBadRequest, "InvalidRequest", "feed parameter is required")
 		return
 	}
 
 	limit := 50
-	if l := r.URL.Query().Get("limit"); l != "" {
+	if l := params.Get("limit"); l != "" {
 		parsed, err := strconv.Atoi(l)
 		if err != nil || parsed < 1 || parsed > 100 {
-			s.logger.Warn("invalid limit parameter", "limit", l, "error", err)
+			logger.Warn("invalid limit parameter", "limit", l, "error", err)
 			writeError(w, http.StatusBadRequest, "InvalidRequest", "limit must be between 1 and 100")
 			return
 		}
 		limit = parsed
 	}
 
-	cursor := r.URL.Query().Get("cursor")
+	// Another host's feed is as unknown here as a feed that doesn't exist.
+	host := s.cfg.HostFor(r.Host)
+	if !host.Serves(feedAuthority(feedURI)) {
+		writeError(w, http.StatusNotFound, "NotFound", "feed not found")
+		return
+	}
+
+	cursor := params.Get("cursor")
 
-	s.logger.Info("getFeedSkeleton request", "feed", feedURI, "limit", limit, "cursor", cursor)
+	logger = logger.With("feed", feedURI)
+	ctx := logctx.With(r.Context(), logger)
+	logger.Info("getFeedSkeleton request", "limit", limit, "cursor", cursor)
 
-	skeleton, err := s.feedService.GetFeedSkeleton(r.Context(), feedURI, limit, cursor)
+	acceptLangs := parseAcceptLanguage(r.Header.Get("Accept-Language"))
+
+	skeleton, err := s.feedService.GetFeedSkeleton(ctx, feedURI, limit, cursor, acceptLangs, s.requesterDID(r, host, feedURI))
 	if err != nil {
 		if errors.Is(err, domain.ErrUnknownFeed) {
 			writeError(w, http.StatusNotFound, "NotFound", "feed not found")
 			return
 		}
-		s.logger.Error("failed to get feed skeleton",
-			"feed", feedURI,
+		if errors.Is(err, domain.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", "invalid cursor")
+			return
+		}
+		logger.Error("failed to get feed skeleton",
 			"limit", limit,
 			"cursor", cursor,
 			"error", err,
 		)
+		// An open circuit breaker always gets the degraded response: the
+		// repository is known to be down, so a 500 would only add noise.
+		if s.cfg.DegradedServing || errors.Is(err, domain.ErrUnavailable) {
+			posts := s.degradedPage(feedURI, cursor, limit)
+			logger.Warn("serving degraded feed skeleton", "posts_returned", len(posts))
+			writeSkeleton(w, "", posts)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "InternalError", "failed to get feed")
 		return
 	}
 
-	s.logger.Info("getFeedSkeleton success", "feed", feedURI, "posts_returned", len(skeleton.Posts), "next_cursor", skeleton.Cursor)
+	if s.cfg.DegradedServing && cursor == "" {
+		s.lastGoodMu.Lock()
+		s.lastGood[feedURI] = skeleton.Posts
+		s.lastGoodMu.Unlock()
+	}
 
-	resp := map[string]any{
-		"feed": toSkeletonResponse(skeleton.Posts),
+	logger.Info("getFeedSkeleton success", "posts_returned", len(skeleton.Posts), "next_cursor", skeleton.Cursor)
+
+	writeSkeleton(w, skeleton.Cursor, skeleton.Posts)
+}
+
+// degradedPage returns the posts to serve when the repository is failing: the
+// last good first page for the feed if one is cached and the request is for
+// the first page, otherwise an empty page. The response never carries a
+// cursor so clients don't paginate into the failing repository.
+func (s *Server) degradedPage(feedURI, cursor string, limit int) []domain.SkeletonPost {
+	if cursor != "" {
+		return nil
 	}
-	if skeleton.Cursor != "" {
-		resp["cursor"] = skeleton.Cursor
+	s.lastGoodMu.RLock()
+	defer s.lastGoodMu.RUnlock()
+	posts := s.lastGood[feedURI]
+	if len(posts) > limit {
+		posts = posts[:limit]
 	}
+	return posts
+}
 
-	writeJSON(w, http.StatusOK, resp)
+// parseAcceptLanguage returns the language tags from an Accept-Language
+// header, ignoring quality weights except to drop tags with q=0. A wildcard
+// means no preference, so it yields nil.
+func parseAcceptLanguage(header string) []string {
+	var langs []string
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if tag == "*" {
+			return nil
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if w, err := strconv.ParseFloat(q, 64); err == nil && w == 0 {
+				continue
+			}
+		}
+		langs = append(langs, tag)
+	}
+	return langs
 }
 
-func toSkeletonResponse(posts []domain.SkeletonPost) []map[string]string {
-	result := make([]map[string]string, len(posts))
+// skeletonItem is app.bsky.feed.defs#skeletonItem.
+type skeletonItem struct {
+	Post   string          `json:"post"`
+	Reason *skeletonReason `json:"reason,omitempty"`
+}
+
+// skeletonReason is one of the app.bsky.feed.defs#skeletonReason* objects.
+type skeletonReason struct {
+	Type   string `json:"$type"`
+	Repost string `json:"repost,omitempty"`
+}
+
+// writeSkeleton writes a 200 getFeedSkeleton response, encoding entries one
+// at a time rather than building the whole response in memory. The output
+// matches writeJSON of {"cursor": cursor, "feed": [...]}, with the cursor
+// omitted when empty.
+func writeSkeleton(w http.ResponseWriter, cursor string, posts []domain.SkeletonPost) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("{")
+	if cursor != "" {
+		c, _ := json.Marshal(cursor)
+		bw.WriteString(`"cursor":`)
+		bw.Write(c)
+		bw.WriteString(",")
+	}
+	bw.WriteString(`"feed":[`)
 	for i, p := range posts {
-		result[i] = map[string]string{"post": p.Post}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		item, err := json.Marshal(toSkeletonItem(p))
+		if err != nil {
+			break // can't happen: skeletonItem has only string fields
+		}
+		bw.Write(item)
+	}
+	bw.WriteString("]}\n")
+	bw.Flush()
+}
+
+func toSkeletonItem(p domain.SkeletonPost) skeletonItem {
+	item := skeletonItem{Post: p.Post}
+	if validReason(p.Reason) {
+		item.Reason = &skeletonReason{Type: p.Reason.Type, Repost: p.Reason.Repost}
+	}
+	return item
+}
+
+// validReason reports whether r can be emitted as a lexicon-conformant
+// skeleton reason. Entries with invalid reasons are served without one.
+func validReason(r *domain.SkeletonReason) bool {
+	if r == nil {
+		return false
+	}
+	switch r.Type {
+	case domain.ReasonPin:
+		return r.Repost == ""
+	case domain.ReasonRepost:
+		return strings.HasPrefix(r.Repost, "at://") && strings.Contains(r.Repost, "/app.bsky.feed.repost/")
+	default:
+		return false
 	}
-	return result
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -164,26 +571,129 @@ func writeError(w http.ResponseWriter, status int, errType, message string) {
 	})
 }
 
-func withLogging(logger *slog.Logger, next http.Handler) http.Handler {
+// decodeJSON decodes the JSON request body into dst, reading at most maxBytes
+// and rejecting unknown fields and trailing data. On failure it writes an
+// XRPC error response and returns false; the handler should then return.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) bool {
+	if mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";"); strings.TrimSpace(mediaType) != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "InvalidRequest", "request body must be application/json")
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after JSON value")
+	}
+	if err == nil {
+		return true
+	}
+
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		writeError(w, http.StatusRequestEntityTooLarge, "InvalidRequest", fmt.Sprintf("request body exceeds %d bytes", maxBytes))
+	case errors.Is(err, io.EOF):
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "request body is empty")
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "invalid request body: "+err.Error())
+	}
+	return false
+}
+
+// withLogging logs each request once it completes. It assigns the request an
+// ID, echoed in the X-Request-ID response header, and puts a logger tagged
+// with it in the request context for the layers below to log with.
+func withLogging(logger *slog.Logger, trusted []netip.Prefix, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		reqLogger := logger.With("request_id", id)
+		r = r.WithContext(logctx.With(r.Context(), reqLogger))
+
 		wrapped := &statusWriter{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(wrapped, r)
-		logger.Info("http request",
+		reqLogger.Info("http request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", wrapped.status,
+			"bytes", wrapped.bytes,
 			"duration", time.Since(start),
+			"remote_addr", remoteAddr(r, trusted),
+			"user_agent", r.UserAgent(),
 		)
 	})
 }
 
+// requestID returns the request's X-Request-ID if it is a reasonable token,
+// e.g. one set by a proxy, and otherwise generates a new one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); requestIDPattern.MatchString(id) {
+		return id
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// remoteAddr returns the client address. X-Forwarded-For and X-Real-IP are
+// only believed when the peer is one of the trusted proxies; the client is
+// then the nearest X-Forwarded-For hop that isn't itself a trusted proxy.
+func remoteAddr(r *http.Request, trusted []netip.Prefix) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+	if !isTrustedProxy(peer, trusted) {
+		return peer
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && !isTrustedProxy(hop, trusted) {
+				return hop
+			}
+		}
+	}
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
+		return xrip
+	}
+	return peer
+}
+
+// isTrustedProxy reports whether addr falls in one of the trusted ranges.
+func isTrustedProxy(addr string, trusted []netip.Prefix) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 type statusWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (w *statusWriter) WriteHeader(status int) {
 	w.status = status
 	w.ResponseWriter.WriteHeader(status)
 }
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
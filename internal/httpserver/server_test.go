@@ -0,0 +1,102 @@
+package httpserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blackmichael/bluesky-feeds/internal/config"
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/sqlite"
+)
+
+// newTestFeedService returns a FeedService over a fresh SQLite database.
+func newTestFeedService(t *testing.T, feeds ...domain.FeedConfig) *domain.FeedService {
+	t.Helper()
+	repo, err := sqlite.NewRepository(t.TempDir()+"/feeds.db", sqlite.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	svc, err := domain.NewFeedService(feeds, repo, repo, domain.ServiceOptions{PostCounts: repo}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestGetFeedSkeletonEmptyFeed(t *testing.T) {
+	const feedURI = "at://did:plc:publisher/app.bsky.feed.generator/new"
+	logger := slog.New(slog.DiscardHandler)
+	svc := newTestFeedService(t, domain.FeedConfig{URI: feedURI, Keywords: []string{"golang"}})
+	empty, err := svc.EmptyFeeds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(empty, []string{feedURI}) {
+		t.Errorf("EmptyFeeds() = %q, want %q", empty, []string{feedURI})
+	}
+
+	s := NewServer(&config.Config{PublisherDID: "did:plc:publisher"}, svc, logger)
+	r := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.feed.getFeedSkeleton?feed="+url.QueryEscape(feedURI), nil)
+	w := httptest.NewRecorder()
+	s.handleGetFeedSkeleton(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"feed":[]}` {
+		t.Errorf("body = %s, want {\"feed\":[]}", got)
+	}
+}
+
+func TestPublicFeedRateLimitClientAddress(t *testing.T) {
+	get := func(s *Server, peer, xff string) int {
+		r := httptest.NewRequest(http.MethodGet, "/feed/missing.json", nil)
+		r.SetPathValue("file", "missing.json")
+		r.RemoteAddr = peer + ":41000"
+		r.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		s.handlePublicFeed(w, r)
+		return w.Code
+	}
+	logger := slog.New(slog.DiscardHandler)
+	svc := newTestFeedService(t, domain.FeedConfig{
+		URI:      "at://did:plc:publisher/app.bsky.feed.generator/golang",
+		Keywords: []string{"golang"},
+	})
+
+	// Without trusted proxies a client can't dodge the limit by varying
+	// X-Forwarded-For.
+	s := NewServer(&config.Config{PublisherDID: "did:plc:publisher", PublicFeedRateLimit: 1}, svc, logger)
+	if code := get(s, "203.0.113.7", "198.51.100.1"); code != http.StatusNotFound {
+		t.Fatalf("first request status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := get(s, "203.0.113.7", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Behind a trusted proxy each forwarded client has its own budget.
+	cfg := &config.Config{
+		PublisherDID:        "did:plc:publisher",
+		PublicFeedRateLimit: 1,
+		TrustedProxies:      []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	s = NewServer(cfg, svc, logger)
+	if code := get(s, "10.0.0.5", "198.51.100.1"); code != http.StatusNotFound {
+		t.Fatalf("first client status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := get(s, "10.0.0.5", "198.51.100.2"); code != http.StatusNotFound {
+		t.Errorf("second client status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := get(s, "10.0.0.5", "192.0.2.9, 198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("prepended hop status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// tlsEnabled reports whether the server terminates TLS itself.
+func (s *Server) tlsEnabled() bool {
+	return s.cfg.TLSCertPath != ""
+}
+
+// ReloadCertificate reloads the TLS certificate and key from disk, e.g.
+// after a renewal. Connections made after it returns use the new
+// certificate. On error the current certificate stays in use. It is a no-op
+// when TLS is disabled.
+func (s *Server) ReloadCertificate() error {
+	if !s.tlsEnabled() {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertPath, s.cfg.TLSKeyPath)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	s.cert.Store(&cert)
+	return nil
+}
+
+// tlsConfig returns a TLS config that serves the most recently loaded
+// certificate. HTTP/2 is negotiated automatically by http.Server.
+func (s *Server) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.cert.Load(), nil
+		},
+	}
+}
+
+// redirectHandler sends every request to the same path on the HTTPS
+// listener. The target host is the configured host matching the request's
+// Host header, never the header itself, so the redirect can't be pointed
+// elsewhere.
+func (s *Server) redirectHandler() http.Handler {
+	port := ""
+	if s.cfg.Port != 443 {
+		port = ":" + strconv.Itoa(s.cfg.Port)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := s.cfg.HostFor(r.Host).Hostname
+		http.Redirect(w, r, "https://"+host+port+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
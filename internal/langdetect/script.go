@@ -0,0 +1,98 @@
+// Package langdetect provides a domain.LanguageDetector that recognizes
+// languages by their writing system.
+package langdetect
+
+import (
+	"unicode"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// minLetters is the number of letters below which Script scales its
+// confidence down, since a word or two says little about a post.
+const minLetters = 12
+
+// scripts maps writing systems used by essentially one language to that
+// language. Latin, Cyrillic, Arabic, Devanagari and other shared scripts are
+// left out: the script alone can't tell their languages apart.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// Script detects a post's language from the writing system of its letters.
+// It only recognizes languages with a script of their own, such as Japanese
+// (kana, with or without kanji), Chinese (Han without kana), Korean, Thai and
+// Greek, and reports "" for anything else, including every language written
+// in Latin or Cyrillic. The confidence is the share of the post's letters in
+// the detected script, reduced for posts with fewer than a dozen letters.
+// Digits, punctuation and emoji are ignored.
+type Script struct{}
+
+var _ domain.LanguageDetector = Script{}
+
+// Languages implements domain.LanguageDetector.
+func (Script) Languages() []string {
+	langs := []string{"ja", "zh"}
+	for _, s := range scripts {
+		langs = append(langs, s.lang)
+	}
+	return langs
+}
+
+// DetectLanguage implements domain.LanguageDetector.
+func (Script) DetectLanguage(text string) (string, float64) {
+	var letters, kana, han int
+	counts := make([]int, len(scripts))
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for i, s := range scripts {
+				if unicode.Is(s.table, r) {
+					counts[i]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return "", 0
+	}
+
+	lang, n := "", 0
+	switch {
+	case kana > 0:
+		lang, n = "ja", kana+han
+	case han > 0:
+		lang, n = "zh", han
+	}
+	for i, c := range counts {
+		if c > n {
+			lang, n = scripts[i].lang, c
+		}
+	}
+	if lang == "" {
+		return "", 0
+	}
+
+	confidence := float64(n) / float64(letters)
+	if letters < minLetters {
+		confidence *= float64(letters) / minLetters
+	}
+	return lang, confidence
+}
@@ -0,0 +1,24 @@
+// Package logctx carries a request-scoped *slog.Logger through a context, so
+// layers below the HTTP handler can log with the request's attributes (such
+// as its request ID) without having them passed explicitly.
+package logctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying logger.
+func With(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// From returns the logger carried by ctx, or fallback if there is none.
+func From(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
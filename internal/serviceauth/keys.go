@@ -0,0 +1,119 @@
+package serviceauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Multicodec prefixes of the compressed public keys atproto uses.
+var (
+	codecSecp256k1 = []byte{0xe7, 0x01}
+	codecP256      = []byte{0x80, 0x24}
+)
+
+// publicKey is an atproto signing key.
+type publicKey interface {
+	// alg is the JWT algorithm the key signs with.
+	alg() string
+
+	// verify reports whether sig, a 64-byte r||s signature in low-S form,
+	// signs hash.
+	verify(hash, sig []byte) bool
+}
+
+// parseMultibaseKey decodes a publicKeyMultibase value: a base58btc ("z")
+// multibase string holding a multicodec-prefixed compressed secp256k1 or
+// P-256 key.
+func parseMultibaseKey(s string) (publicKey, error) {
+	encoded, ok := strings.CutPrefix(s, "z")
+	if !ok {
+		return nil, errors.New("key is not base58btc multibase")
+	}
+	data, err := decodeBase58(encoded)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case hasPrefix(data, codecSecp256k1):
+		key, err := secp256k1.ParsePubKey(data[len(codecSecp256k1):])
+		if err != nil {
+			return nil, fmt.Errorf("secp256k1 key: %w", err)
+		}
+		return k256Key{key}, nil
+	case hasPrefix(data, codecP256):
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data[len(codecP256):])
+		if x == nil {
+			return nil, errors.New("invalid P-256 key")
+		}
+		return p256Key{&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+func hasPrefix(data, prefix []byte) bool {
+	return len(data) > len(prefix) && string(data[:len(prefix)]) == string(prefix)
+}
+
+// k256Key is a secp256k1 key, used for ES256K.
+type k256Key struct {
+	key *secp256k1.PublicKey
+}
+
+func (k256Key) alg() string { return "ES256K" }
+
+func (k k256Key) verify(hash, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || r.IsZero() || s.IsZero() || s.IsOverHalfOrder() {
+		return false
+	}
+	return secpecdsa.NewSignature(&r, &s).Verify(hash, k.key)
+}
+
+// p256Key is a NIST P-256 key, used for ES256.
+type p256Key struct {
+	key *ecdsa.PublicKey
+}
+
+func (p256Key) alg() string { return "ES256" }
+
+func (k p256Key) verify(hash, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	halfOrder := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+	if s.Cmp(halfOrder) > 0 {
+		return false
+	}
+	return ecdsa.Verify(k.key, hash, r, s)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58 decodes a Bitcoin-alphabet base58 string.
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	// Each leading '1' encodes a leading zero byte.
+	zeros := len(s) - len(strings.TrimLeft(s, "1"))
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
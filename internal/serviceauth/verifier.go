@@ -0,0 +1,198 @@
+// Package serviceauth verifies the atproto service auth tokens the AppView
+// forwards with feed requests, so the requester's DID can be trusted.
+package serviceauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, meant
+// for another service, or not signed by the issuer's current key.
+var ErrInvalidToken = errors.New("invalid service auth token")
+
+// KeyResolver looks up an account's current atproto signing key, as a
+// publicKeyMultibase string. *bluesky.Client implements it.
+type KeyResolver interface {
+	SigningKey(ctx context.Context, did string) (string, error)
+}
+
+// Verifier checks service auth JWTs against the issuer's signing key from
+// its DID document. Keys are cached for the configured TTL, and failed
+// lookups for a minute, so forged tokens naming many DIDs can't turn every
+// request into a directory lookup.
+type Verifier struct {
+	keys KeyResolver
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+type cachedKey struct {
+	key       publicKey // nil if the lookup failed
+	err       error
+	fetchedAt time.Time
+}
+
+const (
+	// failedLookupTTL is how long a failed key lookup is remembered.
+	failedLookupTTL = time.Minute
+
+	// minRefresh is how soon after a lookup a key may be fetched again
+	// because a signature didn't verify, e.g. after a key rotation.
+	minRefresh = time.Minute
+
+	// maxCachedKeys bounds the number of DIDs whose keys are cached.
+	maxCachedKeys = 10000
+)
+
+// NewVerifier creates a Verifier that resolves keys with keys and caches
+// them for ttl.
+func NewVerifier(keys KeyResolver, ttl time.Duration) *Verifier {
+	return &Verifier{
+		keys:  keys,
+		ttl:   ttl,
+		now:   time.Now,
+		cache: make(map[string]cachedKey),
+	}
+}
+
+// Verify checks token is an unexpired service auth JWT for audience, signed
+// by its issuer, and returns the issuer's DID. A token scoped to an XRPC
+// method (the lxm claim) must be scoped to method. Errors from checking the
+// token itself wrap ErrInvalidToken; others come from resolving the key.
+func (v *Verifier) Verify(ctx context.Context, token, audience, method string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: header: %w", ErrInvalidToken, err)
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Lxm string `json:"lxm"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: claims: %w", ErrInvalidToken, err)
+	}
+	if claims.Aud != audience {
+		return "", fmt.Errorf("%w: audience %q", ErrInvalidToken, claims.Aud)
+	}
+	if claims.Exp < v.now().Unix() {
+		return "", fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.Lxm != "" && claims.Lxm != method {
+		return "", fmt.Errorf("%w: scoped to %q", ErrInvalidToken, claims.Lxm)
+	}
+	// The issuer may name a service within the DID, e.g. did:plc:abc#bsky_appview.
+	did, _, _ := strings.Cut(claims.Iss, "#")
+	if !strings.HasPrefix(did, "did:") {
+		return "", fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Iss)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	key, err := v.key(ctx, did, false)
+	if err != nil {
+		return "", err
+	}
+	if !matches(key, header.Alg, hash[:], sig) {
+		// The account may have rotated its key since it was cached.
+		key, err = v.key(ctx, did, true)
+		if err != nil {
+			return "", err
+		}
+		if !matches(key, header.Alg, hash[:], sig) {
+			return "", fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	}
+	return did, nil
+}
+
+func matches(key publicKey, alg string, hash, sig []byte) bool {
+	return key != nil && key.alg() == alg && key.verify(hash, sig)
+}
+
+// key returns did's signing key, from the cache unless it has expired or
+// refresh asks for a fresh copy of one at least minRefresh old.
+func (v *Verifier) key(ctx context.Context, did string, refresh bool) (publicKey, error) {
+	now := v.now()
+	v.mu.Lock()
+	cached, ok := v.cache[did]
+	v.mu.Unlock()
+	if ok {
+		age := now.Sub(cached.fetchedAt)
+		fresh := age < v.ttl
+		if cached.err != nil {
+			fresh = age < failedLookupTTL
+		}
+		if fresh && (!refresh || age < minRefresh) {
+			return cached.key, cached.err
+		}
+	}
+
+	entry := cachedKey{fetchedAt: now}
+	multibase, err := v.keys.SigningKey(ctx, did)
+	if err == nil {
+		entry.key, err = parseMultibaseKey(multibase)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err // the caller gave up; don't remember it
+		}
+		entry.err = fmt.Errorf("signing key for %s: %w", did, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.cache[did]; !ok && len(v.cache) >= maxCachedKeys {
+		v.evict(now)
+	}
+	v.cache[did] = entry
+	return entry.key, entry.err
+}
+
+// evict makes room in the cache: expired entries go first, and if none have
+// expired, an arbitrary one. Callers hold v.mu.
+func (v *Verifier) evict(now time.Time) {
+	for did, e := range v.cache {
+		if now.Sub(e.fetchedAt) >= v.ttl || (e.err != nil && now.Sub(e.fetchedAt) >= failedLookupTTL) {
+			delete(v.cache, did)
+		}
+	}
+	if len(v.cache) < maxCachedKeys {
+		return
+	}
+	for did := range v.cache {
+		delete(v.cache, did)
+		return
+	}
+}
+
+// decodeSegment decodes a base64url JWT segment as JSON into dst.
+func decodeSegment(segment string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
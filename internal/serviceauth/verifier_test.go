@@ -0,0 +1,202 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const (
+	testAudience = "did:web:feeds.example.com"
+	testMethod   = "app.bsky.feed.getFeedSkeleton"
+)
+
+// fakeKeys resolves DIDs to fixed multibase keys and counts lookups.
+type fakeKeys struct {
+	keys    map[string]string
+	lookups int
+}
+
+func (f *fakeKeys) SigningKey(_ context.Context, did string) (string, error) {
+	f.lookups++
+	if k, ok := f.keys[did]; ok {
+		return k, nil
+	}
+	return "", errors.New("DID not found")
+}
+
+// encodeBase58 is the inverse of decodeBase58.
+func encodeBase58(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append([]byte{base58Alphabet[mod.Int64()]}, out...)
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append([]byte{'1'}, out...)
+	}
+	return string(out)
+}
+
+func k256Multibase(key *secp256k1.PrivateKey) string {
+	return "z" + encodeBase58(append([]byte{0xe7, 0x01}, key.PubKey().SerializeCompressed()...))
+}
+
+func p256Multibase(key *ecdsa.PrivateKey) string {
+	return "z" + encodeBase58(append([]byte{0x80, 0x24}, elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y)...))
+}
+
+func signK256(key *secp256k1.PrivateKey) func([]byte) []byte {
+	return func(hash []byte) []byte {
+		sig := secpecdsa.Sign(key, hash) // always low-S
+		r, s := sig.R(), sig.S()
+		rb, sb := r.Bytes(), s.Bytes()
+		return append(rb[:], sb[:]...)
+	}
+}
+
+func signP256(key *ecdsa.PrivateKey) func([]byte) []byte {
+	return func(hash []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, key, hash)
+		if err != nil {
+			panic(err)
+		}
+		n := elliptic.P256().Params().N
+		if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+			s.Sub(n, s)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+}
+
+func makeToken(alg, iss, aud string, exp int64, lxm string, sign func([]byte) []byte) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"alg":%q,"typ":"JWT"}`, alg)))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iss":%q,"aud":%q,"exp":%d,"lxm":%q}`, iss, aud, exp, lxm)))
+	hash := sha256.Sum256([]byte(header + "." + claims))
+	return header + "." + claims + "." + base64.RawURLEncoding.EncodeToString(sign(hash[:]))
+}
+
+func TestVerify(t *testing.T) {
+	k256, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &fakeKeys{keys: map[string]string{
+		"did:plc:k256": k256Multibase(k256),
+		"did:plc:p256": p256Multibase(p256),
+	}}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantDID string
+	}{
+		{"ES256K", makeToken("ES256K", "did:plc:k256", testAudience, exp, testMethod, signK256(k256)), "did:plc:k256"},
+		{"ES256", makeToken("ES256", "did:plc:p256", testAudience, exp, "", signP256(p256)), "did:plc:p256"},
+		{"issuer names a service", makeToken("ES256K", "did:plc:k256#bsky_appview", testAudience, exp, "", signK256(k256)), "did:plc:k256"},
+		{"forged signature", makeToken("ES256K", "did:plc:k256", testAudience, exp, "", signK256(other)), ""},
+		{"algorithm mismatch", makeToken("ES256", "did:plc:k256", testAudience, exp, "", signK256(k256)), ""},
+		{"other audience", makeToken("ES256K", "did:plc:k256", "did:web:other.example", exp, "", signK256(k256)), ""},
+		{"expired", makeToken("ES256K", "did:plc:k256", testAudience, 1, "", signK256(k256)), ""},
+		{"other method", makeToken("ES256K", "did:plc:k256", testAudience, exp, "com.atproto.repo.createRecord", signK256(k256)), ""},
+		{"unknown issuer", makeToken("ES256K", "did:plc:nobody", testAudience, exp, "", signK256(k256)), ""},
+		{"issuer not a DID", makeToken("ES256K", "k256", testAudience, exp, "", signK256(k256)), ""},
+		{"not a JWT", "abc.def", ""},
+	}
+	v := NewVerifier(keys, time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			did, err := v.Verify(context.Background(), tt.token, testAudience, testMethod)
+			if did != tt.wantDID {
+				t.Errorf("Verify() = %q, %v; want %q", did, err, tt.wantDID)
+			}
+			if tt.wantDID == "" && err == nil {
+				t.Error("Verify() returned no error for a rejected token")
+			}
+		})
+	}
+}
+
+func TestVerifyCachesKeys(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &fakeKeys{keys: map[string]string{"did:plc:a": k256Multibase(key)}}
+	v := NewVerifier(keys, time.Hour)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	exp := now.Add(10 * time.Minute).Unix()
+	verify := func(signer *secp256k1.PrivateKey) string {
+		did, _ := v.Verify(context.Background(), makeToken("ES256K", "did:plc:a", testAudience, exp, "", signK256(signer)), testAudience, testMethod)
+		return did
+	}
+
+	if verify(key) != "did:plc:a" || verify(key) != "did:plc:a" {
+		t.Fatal("valid token rejected")
+	}
+	if keys.lookups != 1 {
+		t.Errorf("lookups = %d, want 1 for repeated tokens", keys.lookups)
+	}
+
+	// A token signed with a new key isn't trusted until the cached key is
+	// old enough to look up again.
+	keys.keys["did:plc:a"] = k256Multibase(rotated)
+	if verify(rotated) != "" {
+		t.Error("token with rotated key accepted before refresh")
+	}
+	if keys.lookups != 1 {
+		t.Errorf("lookups = %d, want no refresh within a minute", keys.lookups)
+	}
+	now = now.Add(2 * time.Minute)
+	if verify(rotated) != "did:plc:a" {
+		t.Error("token with rotated key rejected after refresh")
+	}
+	if keys.lookups != 2 {
+		t.Errorf("lookups = %d, want 2 after rotation", keys.lookups)
+	}
+}
+
+func TestDecodeBase58(t *testing.T) {
+	for _, data := range [][]byte{{}, {0}, {0, 0, 1}, {0xe7, 0x01, 0x02, 0xff}, []byte("hello world")} {
+		got, err := decodeBase58(encodeBase58(data))
+		if err != nil || string(got) != string(data) {
+			t.Errorf("decodeBase58(encodeBase58(%x)) = %x, %v", data, got, err)
+		}
+	}
+	if _, err := decodeBase58("0OIl"); err == nil {
+		t.Error("decodeBase58 accepted characters outside the alphabet")
+	}
+}
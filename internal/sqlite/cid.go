@@ -0,0 +1,165 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// cidFormatSetting names the settings row recording the form post CIDs are
+// stored in, "binary" or "text".
+const cidFormatSetting = "cid_format"
+
+// convertCIDBatch is how many rows convertCIDs rewrites per transaction.
+const convertCIDBatch = 1000
+
+// cidEncoding is the multibase base32 alphabet CIDv1 strings use, after their
+// leading 'b', uppercased.
+var cidEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// cidToBytes decodes a base32 CIDv1 string ("bafy...") to its binary form. It
+// returns false for CIDs that wouldn't round-trip exactly, such as base58
+// CIDv0 strings, which are then stored as text.
+func cidToBytes(cid string) ([]byte, bool) {
+	rest, ok := strings.CutPrefix(cid, "b")
+	if !ok || rest == "" {
+		return nil, false
+	}
+	b, err := cidEncoding.DecodeString(strings.ToUpper(rest))
+	if err != nil || cidFromBytes(b) != cid {
+		return nil, false
+	}
+	return b, true
+}
+
+// cidFromBytes encodes a binary CID as a base32 CIDv1 string.
+func cidFromBytes(b []byte) string {
+	return "b" + strings.ToLower(cidEncoding.EncodeToString(b))
+}
+
+// cidArg returns the value to store or compare for cid: its binary form when
+// binary CIDs are enabled and cid has one, otherwise the text.
+func cidArg(cid string, binary bool) any {
+	if binary {
+		if b, ok := cidToBytes(cid); ok {
+			return b
+		}
+	}
+	return cid
+}
+
+// cidColumn scans a cid column holding either form, as text.
+type cidColumn string
+
+func (c *cidColumn) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*c = cidColumn(v)
+	case []byte:
+		*c = cidColumn(cidFromBytes(v))
+	default:
+		return fmt.Errorf("unexpected cid type %T", src)
+	}
+	return nil
+}
+
+// syncCIDFormat makes the stored post CIDs match the form binary selects,
+// converting existing rows if the database was last opened with the other
+// one. The feed order compares CIDs and SQLite sorts every BLOB after every
+// TEXT value, so a column holding the same kind of CID in both forms would
+// make cursors skip or repeat posts indexed in the same millisecond.
+func syncCIDFormat(ctx context.Context, db *sql.DB, binary bool, logger *slog.Logger) error {
+	want := "text"
+	if binary {
+		want = "binary"
+	}
+	var have string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name = ?`, cidFormatSetting).Scan(&have)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("read CID format: %w", err)
+	}
+	if have == want {
+		return nil
+	}
+
+	converted, err := convertCIDs(ctx, db, binary)
+	if err != nil {
+		return err
+	}
+	if converted > 0 {
+		logger.Info("converted stored post CIDs", "format", want, "rows", converted)
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO settings (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+		cidFormatSetting, want)
+	if err != nil {
+		return fmt.Errorf("record CID format: %w", err)
+	}
+	return nil
+}
+
+// convertCIDs rewrites every post CID stored in the other form than binary
+// selects to the value cidArg gives for it, in batches. CIDs without a
+// binary form stay as text. It returns the number of rows rewritten.
+func convertCIDs(ctx context.Context, db *sql.DB, binary bool) (int64, error) {
+	from := "blob"
+	if binary {
+		from = "text"
+	}
+
+	type row struct {
+		rowid int64
+		cid   cidColumn
+	}
+	var converted, after int64
+	for {
+		rows, err := db.QueryContext(ctx, `
+			SELECT rowid, cid FROM posts
+			WHERE rowid > ? AND typeof(cid) = ?
+			ORDER BY rowid
+			LIMIT ?`, after, from, convertCIDBatch)
+		if err != nil {
+			return converted, fmt.Errorf("select CIDs to convert: %w", err)
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.rowid, &r.cid); err != nil {
+				rows.Close()
+				return converted, fmt.Errorf("scan CID: %w", err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return converted, fmt.Errorf("select CIDs to convert: %w", err)
+		}
+		if len(batch) == 0 {
+			return converted, nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return converted, fmt.Errorf("begin tx: %w", err)
+		}
+		for _, r := range batch {
+			arg := cidArg(string(r.cid), binary)
+			if _, ok := arg.([]byte); binary && !ok {
+				continue // no binary form, so it stays text
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE posts SET cid = ? WHERE rowid = ?`, arg, r.rowid); err != nil {
+				tx.Rollback()
+				return converted, fmt.Errorf("convert CID: %w", err)
+			}
+			converted++
+		}
+		if err := tx.Commit(); err != nil {
+			return converted, fmt.Errorf("commit converted CIDs: %w", err)
+		}
+		after = batch[len(batch)-1].rowid
+	}
+}
@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+func TestCIDToBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		cid    string
+		binary bool
+	}{
+		{"CIDv1 base32", "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm", true},
+		{"CIDv0 base58", "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG", false},
+		{"uppercase base32", "BAFYREIE5737GDXLW5I64VZICHCALBA3Z2V5N6ICIFVX5XYTVSKE7MR3HPM", false},
+		{"not base32", "b0189", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, ok := cidToBytes(tt.cid)
+			if ok != tt.binary {
+				t.Fatalf("cidToBytes(%q) ok = %t, want %t", tt.cid, ok, tt.binary)
+			}
+			if ok && cidFromBytes(b) != tt.cid {
+				t.Errorf("cidFromBytes(cidToBytes(%q)) = %q", tt.cid, cidFromBytes(b))
+			}
+		})
+	}
+}
+
+// BenchmarkCursorCID measures paging from a cursor inside a burst of posts
+// sharing one indexed_at, where every row comparison falls through to the
+// CID, with CIDs stored as text and as bytes.
+func BenchmarkCursorCID(b *testing.B) {
+	for _, binary := range []bool{false, true} {
+		name := "text"
+		if binary {
+			name = "binary"
+		}
+		b.Run(name, func(b *testing.B) {
+			repo := newTestRepository(b, Options{BinaryCIDs: binary})
+			ctx := context.Background()
+
+			const posts = 5000
+			indexedAt := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+			batch := make([]*domain.Post, 0, posts)
+			for i := range posts {
+				batch = append(batch, &domain.Post{
+					URI:       fmt.Sprintf("at://did:plc:author/app.bsky.feed.post/%05d", i),
+					CID:       testCID(b, i),
+					IndexedAt: indexedAt,
+				})
+			}
+			for _, post := range batch {
+				if err := repo.CreatePost(ctx, post, []string{testFeedURI}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			mid := batch[posts/2]
+			cursor := formatCursor(indexedAt.UnixMilli(), mid.CID, mid.URI)
+
+			for b.Loop() {
+				if _, _, err := repo.GetFeedPosts(ctx, testFeedURI, 50, cursor, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBinaryCIDsToggleConvertsStoredCIDs(t *testing.T) {
+	path := t.TempDir() + "/feeds.db"
+	ctx := context.Background()
+	indexedAt := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+	const cidV0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+	// Each open switches the option and adds a burst of posts in the same
+	// millisecond as the ones before, so page boundaries fall between rows
+	// written in either form.
+	posts := 0
+	for _, binary := range []bool{false, true, false} {
+		repo, err := NewRepository(path, Options{BinaryCIDs: binary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 20 {
+			cid := testCID(t, posts)
+			if posts == 0 {
+				cid = cidV0
+			}
+			post := &domain.Post{
+				URI:       fmt.Sprintf("at://did:plc:author/app.bsky.feed.post/%03d", posts),
+				CID:       cid,
+				IndexedAt: indexedAt,
+			}
+			if err := repo.CreatePost(ctx, post, []string{testFeedURI}); err != nil {
+				t.Fatal(err)
+			}
+			posts++
+		}
+
+		var blobs int
+		if err := repo.db.QueryRow(`SELECT count(*) FROM posts WHERE typeof(cid) = 'blob'`).Scan(&blobs); err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]int{false: 0, true: posts - 1}[binary]; blobs != want {
+			t.Errorf("binary %t: %d binary CIDs stored, want %d", binary, blobs, want)
+		}
+
+		seen := make(map[string]int)
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > posts {
+				t.Fatalf("binary %t: pagination did not end", binary)
+			}
+			page, next, err := repo.GetFeedPosts(ctx, testFeedURI, 3, cursor, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range page {
+				seen[p.URI]++
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if len(seen) != posts {
+			t.Errorf("binary %t: got %d distinct posts, want %d", binary, len(seen), posts)
+		}
+		for uri, n := range seen {
+			if n != 1 {
+				t.Errorf("binary %t: %s returned %d times", binary, uri, n)
+			}
+		}
+		repo.Close()
+	}
+}
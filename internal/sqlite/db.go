@@ -3,6 +3,7 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -28,6 +29,7 @@ func Open(path string) (*sql.DB, error) {
 		"PRAGMA synchronous = NORMAL",
 		"PRAGMA temp_store = MEMORY",
 		"PRAGMA cache_size = -8000",
+		"PRAGMA foreign_keys = ON",
 	}
 	for _, p := range pragmas {
 		if _, err := db.Exec(p); err != nil {
@@ -44,6 +46,47 @@ func Open(path string) (*sql.DB, error) {
 	return db, nil
 }
 
+// replicaPragmas are applied to every connection to a replica. They go in
+// the DSN rather than through db.Exec because the replica's pool isn't
+// limited to one connection: an Exec would only configure whichever
+// connection ran it.
+var replicaPragmas = []string{
+	"busy_timeout(5000)",
+	"query_only(1)",
+	"temp_store(MEMORY)",
+	"cache_size(-8000)",
+}
+
+// OpenReplica opens a read-only copy of the database at path, e.g. one kept
+// up to date by a replication tool, for serving reads. The schema is left to
+// the primary: no migrations are run.
+func OpenReplica(path string) (*sql.DB, error) {
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	params := []string{"mode=ro"}
+	for _, p := range replicaPragmas {
+		params = append(params, "_pragma="+p)
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + strings.Join(params, "&")
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite replica: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open sqlite replica: %w", err)
+	}
+
+	return db, nil
+}
+
 // migrate runs all pending SQL migrations in order. Each migration runs in
 // its own transaction and is recorded in the schema_migrations table.
 func migrate(db *sql.DB) error {
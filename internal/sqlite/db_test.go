@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpenReplicaConfiguresEveryConnection(t *testing.T) {
+	path := t.TempDir() + "/feeds.db"
+	primary, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	replica, err := OpenReplica(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// Hold several connections at once so the pool has to open new ones.
+	ctx := context.Background()
+	for i := range 3 {
+		conn, err := replica.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var queryOnly, busyTimeout int
+		if err := conn.QueryRowContext(ctx, "PRAGMA query_only").Scan(&queryOnly); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+			t.Fatal(err)
+		}
+		if queryOnly != 1 || busyTimeout != 5000 {
+			t.Errorf("connection %d: query_only = %d, busy_timeout = %d; want 1, 5000", i, queryOnly, busyTimeout)
+		}
+		if _, err := conn.ExecContext(ctx, "DELETE FROM posts"); err == nil {
+			t.Errorf("connection %d: write to replica succeeded", i)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// PostRow is a complete row of the posts table, used for export and import.
+type PostRow struct {
+	URI       string    `json:"uri"`
+	CID       string    `json:"cid"`
+	FeedURI   string    `json:"feed_uri"`
+	IndexedAt time.Time `json:"indexed_at"`
+	Langs     []string  `json:"langs"`
+	RepostURI string    `json:"repost_uri,omitempty"`
+	AuthorDID string    `json:"author_did,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Keywords  []string  `json:"matched_keywords,omitempty"`
+}
+
+// ExportPosts calls fn for every post row, ordered by primary key. Rows are
+// read in batches of batchSize using keyset pagination, so memory use is
+// bounded regardless of table size and no read transaction is held open
+// while fn runs.
+func (r *Repository) ExportPosts(ctx context.Context, batchSize int, fn func(PostRow) error) error {
+	var lastURI, lastFeedURI string
+	for {
+		batch, err := r.exportBatch(ctx, lastURI, lastFeedURI, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, row := range batch {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		lastURI, lastFeedURI = last.URI, last.FeedURI
+	}
+}
+
+func (r *Repository) exportBatch(ctx context.Context, afterURI, afterFeedURI string, limit int) ([]PostRow, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT uri, cid, feed_uri, indexed_at, langs, repost_uri, author_did, text, matched_keywords
+		FROM posts
+		WHERE (uri, feed_uri) > (?, ?)
+		ORDER BY uri, feed_uri
+		LIMIT ?`,
+		afterURI, afterFeedURI, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query posts: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []PostRow
+	for rows.Next() {
+		var (
+			row             PostRow
+			millis          int64
+			langs, keywords string
+		)
+		if err := rows.Scan(&row.URI, (*cidColumn)(&row.CID), &row.FeedURI, &millis, &langs, &row.RepostURI, &row.AuthorDID, &row.Text, &keywords); err != nil {
+			return nil, fmt.Errorf("scan post: %w", err)
+		}
+		row.IndexedAt = time.UnixMilli(millis).UTC()
+		if err := json.Unmarshal([]byte(langs), &row.Langs); err != nil {
+			return nil, fmt.Errorf("decode langs for %s: %w", row.URI, err)
+		}
+		if err := json.Unmarshal([]byte(keywords), &row.Keywords); err != nil {
+			return nil, fmt.Errorf("decode matched keywords for %s: %w", row.URI, err)
+		}
+		batch = append(batch, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate posts: %w", err)
+	}
+	return batch, nil
+}
+
+// ImportPosts inserts rows in a single transaction. Rows that already exist
+// are left unchanged. Returns the number of rows processed.
+func (r *Repository) ImportPosts(ctx context.Context, rows []PostRow) (int, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ins, err := newPostInserter(ctx, tx, r.binaryCIDs)
+	if err != nil {
+		return 0, err
+	}
+	defer ins.Close()
+
+	for _, row := range rows {
+		post := &domain.Post{
+			URI:       row.URI,
+			CID:       row.CID,
+			IndexedAt: row.IndexedAt,
+			Langs:     row.Langs,
+			RepostURI: row.RepostURI,
+			AuthorDID: row.AuthorDID,
+			Text:      row.Text,
+		}
+		if len(row.Keywords) > 0 {
+			post.MatchedKeywords = map[string][]string{row.FeedURI: row.Keywords}
+		}
+		if err := ins.insert(ctx, post, row.FeedURI); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(rows), nil
+}
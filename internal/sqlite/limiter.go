@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// ErrTooManyQueries is returned when the concurrent query limit is reached
+// and the query could not be admitted in time.
+// It wraps domain.ErrOverloaded.
+var ErrTooManyQueries = fmt.Errorf("%w: too many concurrent database queries", domain.ErrOverloaded)
+
+// queryLimiter is a semaphore bounding the number of in-flight queries.
+// A nil *queryLimiter admits everything but still tracks in-flight count.
+type queryLimiter struct {
+	slots        chan struct{} // nil means unlimited
+	queueTimeout time.Duration // 0 means fail fast when full
+	inFlight     atomic.Int64
+}
+
+func newQueryLimiter(maxConcurrent int, queueTimeout time.Duration) *queryLimiter {
+	l := &queryLimiter{queueTimeout: queueTimeout}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// acquire admits a query, waiting up to queueTimeout for a free slot. The
+// returned func must be called when the query is done.
+func (l *queryLimiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if l.queueTimeout <= 0 {
+				return nil, ErrTooManyQueries
+			}
+			timer := time.NewTimer(l.queueTimeout)
+			defer timer.Stop()
+			select {
+			case l.slots <- struct{}{}:
+			case <-timer.C:
+				return nil, ErrTooManyQueries
+			case <-ctx.Done():
+				// Still queued, so this is about load, not the database.
+				return nil, fmt.Errorf("%w: %w", ErrTooManyQueries, ctx.Err())
+			}
+		}
+	}
+
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}, nil
+}
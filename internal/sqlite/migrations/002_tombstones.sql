@@ -0,0 +1,7 @@
+CREATE TABLE tombstones (
+    uri        TEXT    PRIMARY KEY,
+    deleted_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_tombstones_deleted_at
+    ON tombstones (deleted_at);
@@ -0,0 +1,2 @@
+-- JSON array of the post's primary language subtags (e.g. ["en","ja"]).
+ALTER TABLE posts ADD COLUMN langs TEXT NOT NULL DEFAULT '[]';
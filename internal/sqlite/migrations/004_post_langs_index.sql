@@ -0,0 +1,17 @@
+-- One row per (post, feed, language) so language-filtered feed queries can use
+-- an index instead of scanning each post's langs JSON. Rows are removed with
+-- their post via the foreign key.
+CREATE TABLE post_langs (
+    uri      TEXT NOT NULL,
+    feed_uri TEXT NOT NULL,
+    lang     TEXT NOT NULL,
+    PRIMARY KEY (uri, feed_uri, lang),
+    FOREIGN KEY (uri, feed_uri) REFERENCES posts (uri, feed_uri) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_post_langs_feed_lang
+    ON post_langs (feed_uri, lang, uri);
+
+INSERT INTO post_langs (uri, feed_uri, lang)
+SELECT p.uri, p.feed_uri, j.value
+FROM posts p, json_each(p.langs) j;
@@ -0,0 +1,3 @@
+-- AT-URI of the repost that added the post to the feed, or '' for posts
+-- matched on their own content.
+ALTER TABLE posts ADD COLUMN repost_uri TEXT NOT NULL DEFAULT '';
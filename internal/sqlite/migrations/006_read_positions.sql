@@ -0,0 +1,11 @@
+CREATE TABLE read_positions (
+    requester_did TEXT    NOT NULL,
+    feed_uri      TEXT    NOT NULL,
+    indexed_at    INTEGER NOT NULL,
+    cid           TEXT    NOT NULL,
+    updated_at    INTEGER NOT NULL,
+    PRIMARY KEY (requester_did, feed_uri)
+);
+
+CREATE INDEX idx_read_positions_updated_at
+    ON read_positions (updated_at);
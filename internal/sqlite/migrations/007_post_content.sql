@@ -0,0 +1,4 @@
+-- Author DID and text of the post, for operator tooling. Rows indexed before
+-- this migration, and posts added through reposts, have an empty text.
+ALTER TABLE posts ADD COLUMN author_did TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN text TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- Break ties between posts indexed in the same millisecond with the same CID
+-- (byte-identical records from different accounts) by URI, so pagination has
+-- a strict order to resume from.
+DROP INDEX idx_posts_feed_indexed;
+
+CREATE INDEX idx_posts_feed_indexed
+    ON posts (feed_uri, indexed_at DESC, cid DESC, uri DESC);
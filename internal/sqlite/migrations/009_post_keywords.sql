@@ -0,0 +1,16 @@
+-- JSON array of the feed's top-level keywords the post matched (e.g.
+-- ["claude","gemini"]), for analytics. Empty for posts matched otherwise.
+ALTER TABLE posts ADD COLUMN matched_keywords TEXT NOT NULL DEFAULT '[]';
+
+-- One row per (post, feed, keyword) so posts can be looked up by the keyword
+-- that matched them. Rows are removed with their post via the foreign key.
+CREATE TABLE post_keywords (
+    uri      TEXT NOT NULL,
+    feed_uri TEXT NOT NULL,
+    keyword  TEXT NOT NULL,
+    PRIMARY KEY (uri, feed_uri, keyword),
+    FOREIGN KEY (uri, feed_uri) REFERENCES posts (uri, feed_uri) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_post_keywords_feed_keyword
+    ON post_keywords (feed_uri, keyword, uri);
@@ -0,0 +1,7 @@
+-- Facts about how data is stored that depend on repository options, such as
+-- the form post CIDs are kept in, so a changed option can be detected and
+-- applied to existing rows on startup.
+CREATE TABLE settings (
+    name  TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+// GetReadPosition returns the furthest cursor requesterDID has paged to in
+// feedURI, or "" if none is saved.
+func (r *Repository) GetReadPosition(ctx context.Context, requesterDID, feedURI string) (string, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var (
+		millis int64
+		cid    string
+	)
+	err = r.db.QueryRowContext(ctx,
+		`SELECT indexed_at, cid FROM read_positions WHERE requester_did = ? AND feed_uri = ?`,
+		requesterDID, feedURI,
+	).Scan(&millis, &cid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query read position: %w", err)
+	}
+	return fmt.Sprintf("%d::%s", millis, cid), nil
+}
+
+// SaveReadPosition records cursor as requesterDID's position in feedURI if
+// it is further down the feed than the saved one. Either way the position's
+// last use is refreshed.
+func (r *Repository) SaveReadPosition(ctx context.Context, requesterDID, feedURI, cursor string) error {
+	millis, cid, _, err := parseCursor(cursor)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", domain.ErrInvalidCursor, cursor, err)
+	}
+
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO read_positions (requester_did, feed_uri, indexed_at, cid, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (requester_did, feed_uri) DO UPDATE SET
+			indexed_at = CASE WHEN (excluded.indexed_at, excluded.cid) < (indexed_at, cid)
+				THEN excluded.indexed_at ELSE indexed_at END,
+			cid = CASE WHEN (excluded.indexed_at, excluded.cid) < (indexed_at, cid)
+				THEN excluded.cid ELSE cid END,
+			updated_at = excluded.updated_at`,
+		requesterDID, feedURI, millis, cid, time.Now().UTC().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("save read position: %w", err)
+	}
+	return nil
+}
+
+// ResetReadPosition deletes requesterDID's position in feedURI.
+func (r *Repository) ResetReadPosition(ctx context.Context, requesterDID, feedURI string) error {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = r.db.ExecContext(ctx,
+		`DELETE FROM read_positions WHERE requester_did = ? AND feed_uri = ?`,
+		requesterDID, feedURI,
+	)
+	if err != nil {
+		return fmt.Errorf("reset read position: %w", err)
+	}
+	return nil
+}
+
+// DeleteReadPositions removes positions last used before t, then caps the
+// table at maxRows, keeping the most recently used. Zero maxRows means no
+// cap. Returns rows deleted.
+func (r *Repository) DeleteReadPositions(ctx context.Context, t time.Time, maxRows int) (int64, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM read_positions WHERE updated_at < ?`, t.UTC().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired read positions: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if maxRows <= 0 {
+		return deleted, nil
+	}
+
+	res, err = r.db.ExecContext(ctx, `
+		DELETE FROM read_positions
+		WHERE rowid NOT IN (
+			SELECT rowid FROM read_positions
+			ORDER BY updated_at DESC
+			LIMIT ?
+		)`, maxRows)
+	if err != nil {
+		return deleted, fmt.Errorf("delete excess read positions: %w", err)
+	}
+	excess, err := res.RowsAffected()
+	return deleted + excess, err
+}
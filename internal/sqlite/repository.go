@@ -3,102 +3,509 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/blackmichael/bluesky-feeds/internal/domain"
+	"github.com/blackmichael/bluesky-feeds/internal/logctx"
 )
 
 // Repository implements domain.PostRepository and domain.CursorRepository
 // using SQLite.
 type Repository struct {
-	db *sql.DB
+	db               *sql.DB
+	replica          *sql.DB // serves GetFeedPosts and CountPosts; nil means db
+	limiter          *queryLimiter
+	logger           *slog.Logger
+	binaryCIDs       bool
+	statementTimeout time.Duration
+}
+
+// Options tunes a Repository. The zero value applies no limits.
+type Options struct {
+	// MaxConcurrentQueries bounds the number of in-flight repository calls.
+	// Zero means unlimited.
+	MaxConcurrentQueries int
+
+	// QueueTimeout is how long a call waits for a free slot once
+	// MaxConcurrentQueries is reached before failing with ErrTooManyQueries.
+	// Zero fails fast.
+	QueueTimeout time.Duration
+
+	// StatementTimeout bounds how long a repository call may run once
+	// admitted, whatever the caller's context allows; SQLite interrupts the
+	// running statement when it passes. Zero means no limit.
+	StatementTimeout time.Duration
+
+	// ReplicaPath, if set, is a read-only replica of the database that
+	// serves feed reads (GetFeedPosts and CountPosts). Everything else,
+	// including all writes, goes to the primary.
+	ReplicaPath string
+
+	// Logger receives query diagnostics when the context doesn't carry a
+	// request-scoped logger (see logctx). nil discards them.
+	Logger *slog.Logger
+
+	// BinaryCIDs stores post CIDs in their binary form rather than as base32
+	// text, saving about a third of their size in the table and its index.
+	// CIDs are still read and returned as text. When the option changes for
+	// an existing database, NewRepository converts the stored CIDs first.
+	BinaryCIDs bool
 }
 
 // NewRepository opens the SQLite database at path, applies the schema,
 // and returns a new Repository.
-func NewRepository(path string) (*Repository, error) {
+func NewRepository(path string, opts Options) (*Repository, error) {
 	db, err := Open(path)
 	if err != nil {
 		return nil, err
 	}
-	return &Repository{db: db}, nil
+	var replica *sql.DB
+	if opts.ReplicaPath != "" {
+		if replica, err = OpenReplica(opts.ReplicaPath); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	if err := syncCIDFormat(context.Background(), db, opts.BinaryCIDs, logger); err != nil {
+		db.Close()
+		if replica != nil {
+			replica.Close()
+		}
+		return nil, err
+	}
+	return &Repository{
+		db:         db,
+		replica:    replica,
+		limiter:    newQueryLimiter(opts.MaxConcurrentQueries, opts.QueueTimeout),
+		logger:     logger,
+		binaryCIDs: opts.BinaryCIDs,
+
+		statementTimeout: opts.StatementTimeout,
+	}, nil
 }
 
-// Close closes the underlying database connection.
+// begin admits a repository call through the limiter and bounds ctx by the
+// statement timeout. The returned release must be called when the call is
+// done.
+func (r *Repository) begin(ctx context.Context) (context.Context, func(), error) {
+	release, err := r.limiter.acquire(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+	if r.statementTimeout <= 0 {
+		return ctx, release, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.statementTimeout)
+	return ctx, func() {
+		cancel()
+		release()
+	}, nil
+}
+
+// reader returns the database feed reads are served from: the replica if
+// one is configured, otherwise the primary.
+func (r *Repository) reader() *sql.DB {
+	if r.replica != nil {
+		return r.replica
+	}
+	return r.db
+}
+
+// InFlightQueries implements domain.QueryGauge. It counts repository calls
+// currently running, including any waiting on the busy timeout.
+func (r *Repository) InFlightQueries() int64 {
+	return r.limiter.inFlight.Load()
+}
+
+// Ping implements domain.RepositoryPinger by checking the primary database
+// answers a query.
+func (r *Repository) Ping(ctx context.Context) error {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	var one int
+	if err := r.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying database connections.
 func (r *Repository) Close() error {
+	if r.replica != nil {
+		r.replica.Close()
+	}
 	return r.db.Close()
 }
 
 // CreatePost inserts a post row for each matched feed URI.
 func (r *Repository) CreatePost(ctx context.Context, post *domain.Post, feedURIs []string) error {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO posts (uri, cid, feed_uri, indexed_at)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT (uri, feed_uri) DO NOTHING`)
+	ins, err := newPostInserter(ctx, tx, r.binaryCIDs)
 	if err != nil {
-		return fmt.Errorf("prepare insert: %w", err)
+		return err
 	}
-	defer stmt.Close()
+	defer ins.Close()
 
-	millis := post.IndexedAt.UnixMilli()
 	for _, feedURI := range feedURIs {
-		if _, err := stmt.ExecContext(ctx, post.URI, post.CID, feedURI, millis); err != nil {
-			return fmt.Errorf("insert post for feed %s: %w", feedURI, err)
+		if err := ins.insert(ctx, post, feedURI); err != nil {
+			return err
 		}
 	}
 
 	return tx.Commit()
 }
 
-// DeletePost removes all rows for a post URI across all feeds.
+// UpsertPost adds the post to each feed like CreatePost, except that where
+// the post is already in a feed its indexed_at and metadata are overwritten,
+// moving it to the top of the feed. Repost attribution is left as is.
+func (r *Repository) UpsertPost(ctx context.Context, post *domain.Post, feedURIs []string) (domain.UpsertResult, error) {
+	var result domain.UpsertResult
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ins, err := newPostInserter(ctx, tx, r.binaryCIDs)
+	if err != nil {
+		return result, err
+	}
+	defer ins.Close()
+
+	for _, feedURI := range feedURIs {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM posts WHERE uri = ? AND feed_uri = ?)`, post.URI, feedURI,
+		).Scan(&exists)
+		if err != nil {
+			return result, fmt.Errorf("look up post for feed %s: %w", feedURI, err)
+		}
+		if exists {
+			if err := ins.refresh(ctx, tx, post, feedURI); err != nil {
+				return result, err
+			}
+			result.Updated++
+			continue
+		}
+		if err := ins.insert(ctx, post, feedURI); err != nil {
+			return result, err
+		}
+		result.Inserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.UpsertResult{}, err
+	}
+	return result, nil
+}
+
+// RemovePost deletes the post's rows for feedURIs. Unlike DeletePost it
+// records no tombstone, so the post can be added back later.
+func (r *Repository) RemovePost(ctx context.Context, uri string, feedURIs []string) (int, error) {
+	if len(feedURIs) == 0 {
+		return 0, nil
+	}
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	args := []any{uri}
+	for _, feedURI := range feedURIs {
+		args = append(args, feedURI)
+	}
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM posts WHERE uri = ? AND feed_uri IN (?`+strings.Repeat(", ?", len(feedURIs)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("remove post: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// postInserter holds the prepared statements for inserting post rows and
+// their language and keyword index rows within a transaction.
+type postInserter struct {
+	post       *sql.Stmt
+	lang       *sql.Stmt
+	keyword    *sql.Stmt
+	binaryCIDs bool
+}
+
+func newPostInserter(ctx context.Context, tx *sql.Tx, binaryCIDs bool) (*postInserter, error) {
+	post, err := tx.PrepareContext(ctx, `
+		INSERT INTO posts (uri, cid, feed_uri, indexed_at, langs, repost_uri, author_did, text, matched_keywords)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (uri, feed_uri) DO NOTHING`)
+	if err != nil {
+		return nil, fmt.Errorf("prepare insert: %w", err)
+	}
+
+	lang, err := tx.PrepareContext(ctx, `
+		INSERT INTO post_langs (uri, feed_uri, lang)
+		VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		post.Close()
+		return nil, fmt.Errorf("prepare lang insert: %w", err)
+	}
+
+	keyword, err := tx.PrepareContext(ctx, `
+		INSERT INTO post_keywords (uri, feed_uri, keyword)
+		VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		post.Close()
+		lang.Close()
+		return nil, fmt.Errorf("prepare keyword insert: %w", err)
+	}
+
+	return &postInserter{post: post, lang: lang, keyword: keyword, binaryCIDs: binaryCIDs}, nil
+}
+
+// insert adds post to the given feed. Posts already in the feed are left
+// unchanged.
+func (ins *postInserter) insert(ctx context.Context, post *domain.Post, feedURI string) error {
+	langs, err := encodeList("langs", post.Langs)
+	if err != nil {
+		return err
+	}
+	keywords, err := encodeList("matched_keywords", post.MatchedKeywords[feedURI])
+	if err != nil {
+		return err
+	}
+
+	res, err := ins.post.ExecContext(ctx, post.URI, cidArg(post.CID, ins.binaryCIDs), feedURI, post.IndexedAt.UnixMilli(), langs, post.RepostURI, post.AuthorDID, post.Text, keywords)
+	if err != nil {
+		return fmt.Errorf("insert post for feed %s: %w", feedURI, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // already indexed for this feed
+	}
+	return ins.insertIndexes(ctx, post, feedURI)
+}
+
+// refresh overwrites the indexed_at, CID, text, languages and matched
+// keywords of a post already in the given feed, and rebuilds its language
+// and keyword index rows.
+func (ins *postInserter) refresh(ctx context.Context, tx *sql.Tx, post *domain.Post, feedURI string) error {
+	langs, err := encodeList("langs", post.Langs)
+	if err != nil {
+		return err
+	}
+	keywords, err := encodeList("matched_keywords", post.MatchedKeywords[feedURI])
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE posts
+		SET cid = ?, indexed_at = ?, langs = ?, text = ?, matched_keywords = ?
+		WHERE uri = ? AND feed_uri = ?`,
+		cidArg(post.CID, ins.binaryCIDs), post.IndexedAt.UnixMilli(), langs, post.Text, keywords, post.URI, feedURI)
+	if err != nil {
+		return fmt.Errorf("update post for feed %s: %w", feedURI, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_langs WHERE uri = ? AND feed_uri = ?`, post.URI, feedURI); err != nil {
+		return fmt.Errorf("clear langs for feed %s: %w", feedURI, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_keywords WHERE uri = ? AND feed_uri = ?`, post.URI, feedURI); err != nil {
+		return fmt.Errorf("clear keywords for feed %s: %w", feedURI, err)
+	}
+	return ins.insertIndexes(ctx, post, feedURI)
+}
+
+// insertIndexes adds the language and keyword index rows for a post in the
+// given feed.
+func (ins *postInserter) insertIndexes(ctx context.Context, post *domain.Post, feedURI string) error {
+	for _, lang := range post.Langs {
+		if _, err := ins.lang.ExecContext(ctx, post.URI, feedURI, lang); err != nil {
+			return fmt.Errorf("insert lang %s for feed %s: %w", lang, feedURI, err)
+		}
+	}
+	for _, kw := range post.MatchedKeywords[feedURI] {
+		if _, err := ins.keyword.ExecContext(ctx, post.URI, feedURI, kw); err != nil {
+			return fmt.Errorf("insert keyword %q for feed %s: %w", kw, feedURI, err)
+		}
+	}
+	return nil
+}
+
+func (ins *postInserter) Close() {
+	ins.post.Close()
+	ins.lang.Close()
+	ins.keyword.Close()
+}
+
+// DeletePost removes all rows for a post URI across all feeds and records a
+// tombstone if the post was indexed. Deletes for posts we never stored don't
+// write a tombstone, which keeps the table small.
 func (r *Repository) DeletePost(ctx context.Context, uri string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM posts WHERE uri = ?`, uri)
-	return err
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE uri = ?`, uri)
+	if err != nil {
+		return fmt.Errorf("delete post: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tombstones (uri, deleted_at)
+		VALUES (?, ?)
+		ON CONFLICT (uri) DO UPDATE SET deleted_at = excluded.deleted_at`,
+		uri, time.Now().UTC().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert tombstone: %w", err)
+	}
+
+	return tx.Commit()
 }
 
-// GetFeedPosts retrieves posts for a specific feed, paginated by cursor.
-// Cursor format: "indexedAtMillis::cid".
-func (r *Repository) GetFeedPosts(ctx context.Context, feedURI string, limit int, cursor string) ([]domain.Post, string, error) {
-	var (
-		rows *sql.Rows
-		err  error
+// IsTombstoned reports whether a tombstone for uri was recorded at or after since.
+func (r *Repository) IsTombstoned(ctx context.Context, uri string, since time.Time) (bool, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	var exists int
+	err = r.db.QueryRowContext(ctx,
+		`SELECT 1 FROM tombstones WHERE uri = ? AND deleted_at >= ?`,
+		uri, since.UTC().UnixMilli(),
+	).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query tombstone: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteTombstonesBefore removes tombstones recorded before t. Returns rows deleted.
+func (r *Repository) DeleteTombstonesBefore(ctx context.Context, t time.Time) (int64, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM tombstones WHERE deleted_at < ?`,
+		t.UTC().UnixMilli(),
 	)
+	if err != nil {
+		return 0, fmt.Errorf("delete tombstones: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetFeedPosts retrieves posts for a specific feed, paginated by cursor and
+// optionally filtered to posts tagged with any of langs. Posts are ordered by
+// indexed_at, then CID, then URI, all descending; the URI only matters for
+// byte-identical posts indexed in the same millisecond, but without it a
+// page boundary between them would skip one.
+// Cursor format: "indexedAtMillis::cid::uri".
+func (r *Repository) GetFeedPosts(ctx context.Context, feedURI string, limit int, cursor string, langs []string) ([]domain.Post, string, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	query := `
+		SELECT uri, cid, indexed_at, langs, repost_uri
+		FROM posts
+		WHERE feed_uri = ?`
+	args := []any{feedURI}
 
 	if cursor != "" {
-		cursorMillis, cursorCID, parseErr := parseCursor(cursor)
-		if parseErr != nil {
-			return nil, "", fmt.Errorf("invalid cursor %q: %w", cursor, parseErr)
+		cond, condArgs, err := r.cursorCondition(cursor)
+		if err != nil {
+			return nil, "", err
 		}
+		query += cond
+		args = append(args, condArgs...)
+	}
 
-		rows, err = r.db.QueryContext(ctx, `
-			SELECT uri, cid, indexed_at
-			FROM posts
+	if len(langs) > 0 {
+		query += `
+		  AND uri IN (
+			SELECT uri FROM post_langs
 			WHERE feed_uri = ?
-			  AND (indexed_at, cid) < (?, ?)
-			ORDER BY indexed_at DESC, cid DESC
-			LIMIT ?`,
-			feedURI, cursorMillis, cursorCID, limit,
-		)
-	} else {
-		rows, err = r.db.QueryContext(ctx, `
-			SELECT uri, cid, indexed_at
-			FROM posts
-			WHERE feed_uri = ?
-			ORDER BY indexed_at DESC, cid DESC
-			LIMIT ?`,
-			feedURI, limit,
-		)
+			  AND lang IN (?` + strings.Repeat(", ?", len(langs)-1) + `)
+		  )`
+		args = append(args, feedURI)
+		for _, l := range langs {
+			args = append(args, l)
+		}
 	}
+
+	// Fetch one extra row to learn whether another page exists, so a feed
+	// with exactly limit posts left doesn't get a cursor to an empty page.
+	query += `
+		ORDER BY indexed_at DESC, cid DESC, uri DESC
+		LIMIT ?`
+	args = append(args, limit+1)
+
+	logger := logctx.From(ctx, r.logger)
+	start := time.Now()
+	rows, err := r.reader().QueryContext(ctx, query, args...)
 	if err != nil {
+		logger.Error("feed posts query failed",
+			"feed", feedURI,
+			"limit", limit,
+			"cursor", cursor,
+			"langs", langs,
+			"duration", time.Since(start),
+			"error", err,
+		)
 		return nil, "", fmt.Errorf("query feed posts: %w", err)
 	}
 	defer rows.Close()
@@ -108,75 +515,264 @@ func (r *Repository) GetFeedPosts(ctx context.Context, feedURI string, limit int
 		var (
 			p      domain.Post
 			millis int64
+			langs  string
 		)
-		if err := rows.Scan(&p.URI, &p.CID, &millis); err != nil {
+		if err := rows.Scan(&p.URI, (*cidColumn)(&p.CID), &millis, &langs, &p.RepostURI); err != nil {
 			return nil, "", fmt.Errorf("scan post: %w", err)
 		}
 		p.IndexedAt = time.UnixMilli(millis).UTC()
+		if err := json.Unmarshal([]byte(langs), &p.Langs); err != nil {
+			return nil, "", fmt.Errorf("decode langs for %s: %w", p.URI, err)
+		}
 		posts = append(posts, p)
 	}
 	if err := rows.Err(); err != nil {
+		logger.Error("feed posts query failed while reading rows", "feed", feedURI, "duration", time.Since(start), "error", err)
 		return nil, "", fmt.Errorf("iterate posts: %w", err)
 	}
+	logger.Debug("feed posts query", "feed", feedURI, "rows", len(posts), "duration", time.Since(start))
 
 	var nextCursor string
-	if len(posts) == limit {
+	if len(posts) > limit {
+		posts = posts[:limit]
 		last := posts[len(posts)-1]
-		nextCursor = fmt.Sprintf("%d::%s", last.IndexedAt.UnixMilli(), last.CID)
+		nextCursor = formatCursor(last.IndexedAt.UnixMilli(), last.CID, last.URI)
+	}
+
+	return posts, nextCursor, nil
+}
+
+// RecentPosts returns up to limit of a feed's posts, newest first, with
+// their author and text.
+func (r *Repository) RecentPosts(ctx context.Context, feedURI string, limit int) ([]domain.Post, error) {
+	rows, _, err := r.GetFeedPostsDetailed(ctx, feedURI, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]domain.Post, len(rows))
+	for i, row := range rows {
+		posts[i] = domain.Post{
+			URI:       row.URI,
+			CID:       row.CID,
+			IndexedAt: row.IndexedAt,
+			AuthorDID: row.AuthorDID,
+			Text:      row.Text,
+			Langs:     row.Langs,
+			RepostURI: row.RepostURI,
+		}
+	}
+	return posts, nil
+}
+
+// GetFeedPostsDetailed returns full rows, including author and text, for a
+// feed, newest first and paginated like GetFeedPosts. It is for operator
+// tooling; the skeleton path uses the leaner GetFeedPosts.
+func (r *Repository) GetFeedPostsDetailed(ctx context.Context, feedURI string, limit int, cursor string) ([]PostRow, string, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	query := `
+		SELECT uri, cid, feed_uri, indexed_at, langs, repost_uri, author_did, text
+		FROM posts
+		WHERE feed_uri = ?`
+	args := []any{feedURI}
+
+	if cursor != "" {
+		cond, condArgs, err := r.cursorCondition(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query += cond
+		args = append(args, condArgs...)
+	}
+
+	query += `
+		ORDER BY indexed_at DESC, cid DESC, uri DESC
+		LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("query feed posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []PostRow
+	for rows.Next() {
+		var (
+			row    PostRow
+			millis int64
+			langs  string
+		)
+		if err := rows.Scan(&row.URI, (*cidColumn)(&row.CID), &row.FeedURI, &millis, &langs, &row.RepostURI, &row.AuthorDID, &row.Text); err != nil {
+			return nil, "", fmt.Errorf("scan post: %w", err)
+		}
+		row.IndexedAt = time.UnixMilli(millis).UTC()
+		if err := json.Unmarshal([]byte(langs), &row.Langs); err != nil {
+			return nil, "", fmt.Errorf("decode langs for %s: %w", row.URI, err)
+		}
+		posts = append(posts, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("iterate posts: %w", err)
 	}
 
+	var nextCursor string
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[len(posts)-1]
+		nextCursor = formatCursor(last.IndexedAt.UnixMilli(), last.CID, last.URI)
+	}
 	return posts, nextCursor, nil
 }
 
 // DeleteOldPosts removes posts for a specific feed older than maxAge and
-// caps the feed at maxRows, keeping the most recent. Returns total rows deleted.
-func (r *Repository) DeleteOldPosts(ctx context.Context, feedURI string, maxAge time.Duration, maxRows int) (int64, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+// caps the feed at maxRows, keeping the most recent. The two phases are
+// committed independently, so a failure in the cap phase doesn't undo the
+// expiry phase. Each phase is a single atomic statement.
+func (r *Repository) DeleteOldPosts(ctx context.Context, feedURI string, maxAge time.Duration, maxRows int) (domain.CleanupResult, error) {
+	var result domain.CleanupResult
+
+	ctx, release, err := r.begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("begin tx: %w", err)
+		return result, err
 	}
-	defer tx.Rollback()
+	defer release()
 
 	cutoffMillis := time.Now().UTC().Add(-maxAge).UnixMilli()
 
 	// Delete posts older than maxAge for this feed.
-	res, err := tx.ExecContext(ctx,
+	res, err := r.db.ExecContext(ctx,
 		`DELETE FROM posts WHERE feed_uri = ? AND indexed_at < ?`,
 		feedURI, cutoffMillis,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("delete expired posts: %w", err)
+		result.ExpiredErr = fmt.Errorf("delete expired posts: %w", err)
+	} else {
+		result.ExpiredDeleted, _ = res.RowsAffected()
 	}
-	ttlDeleted, _ := res.RowsAffected()
 
 	// Cap at maxRows by deleting excess, keeping the most recent.
-	res, err = tx.ExecContext(ctx, `
+	res, err = r.db.ExecContext(ctx, `
 		DELETE FROM posts
 		WHERE feed_uri = ?
 		  AND rowid IN (
 			SELECT rowid FROM posts
 			WHERE feed_uri = ?
-			ORDER BY indexed_at DESC, cid DESC
+			ORDER BY indexed_at DESC, cid DESC, uri DESC
 			LIMIT -1 OFFSET ?
 		  )`,
 		feedURI, feedURI, maxRows,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("delete excess posts: %w", err)
+		result.ExcessErr = fmt.Errorf("delete excess posts: %w", err)
+	} else {
+		result.ExcessDeleted, _ = res.RowsAffected()
 	}
-	capDeleted, _ := res.RowsAffected()
 
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit: %w", err)
+	return result, result.Err()
+}
+
+// DeletePostsBefore removes all posts across all feeds indexed before t.
+// Returns rows deleted.
+func (r *Repository) DeletePostsBefore(ctx context.Context, t time.Time) (int64, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
 	}
+	defer release()
 
-	return ttlDeleted + capDeleted, nil
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM posts WHERE indexed_at < ?`,
+		t.UTC().UnixMilli(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete posts before %s: %w", t.Format(time.RFC3339), err)
+	}
+	return res.RowsAffected()
+}
+
+// CountPosts returns the number of posts currently indexed for feedURI.
+func (r *Repository) CountPosts(ctx context.Context, feedURI string) (int64, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var n int64
+	err = r.reader().QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM posts WHERE feed_uri = ?`, feedURI,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count posts: %w", err)
+	}
+	return n, nil
+}
+
+// PostsMatchedBy returns up to limit of feedURI's posts whose matched
+// keywords include keyword, newest first.
+func (r *Repository) PostsMatchedBy(ctx context.Context, feedURI, keyword string, limit int) ([]domain.Post, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := r.reader().QueryContext(ctx, `
+		SELECT p.uri, p.cid, p.indexed_at, p.langs, p.author_did, p.text, p.matched_keywords
+		FROM post_keywords k
+		JOIN posts p ON p.uri = k.uri AND p.feed_uri = k.feed_uri
+		WHERE k.feed_uri = ? AND k.keyword = ?
+		ORDER BY p.indexed_at DESC, p.cid DESC, p.uri DESC
+		LIMIT ?`,
+		feedURI, keyword, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query posts by keyword: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []domain.Post
+	for rows.Next() {
+		var (
+			p               domain.Post
+			millis          int64
+			langs, keywords string
+			matched         []string
+		)
+		if err := rows.Scan(&p.URI, (*cidColumn)(&p.CID), &millis, &langs, &p.AuthorDID, &p.Text, &keywords); err != nil {
+			return nil, fmt.Errorf("scan post: %w", err)
+		}
+		p.IndexedAt = time.UnixMilli(millis).UTC()
+		if err := json.Unmarshal([]byte(langs), &p.Langs); err != nil {
+			return nil, fmt.Errorf("decode langs for %s: %w", p.URI, err)
+		}
+		if err := json.Unmarshal([]byte(keywords), &matched); err != nil {
+			return nil, fmt.Errorf("decode matched keywords for %s: %w", p.URI, err)
+		}
+		p.MatchedKeywords = map[string][]string{feedURI: matched}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate posts: %w", err)
+	}
+	return posts, nil
 }
 
 // GetCursor retrieves the saved firehose cursor for a service.
 func (r *Repository) GetCursor(ctx context.Context, service string) (int64, error) {
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	var cursor int64
-	err := r.db.QueryRowContext(ctx,
+	err = r.db.QueryRowContext(ctx,
 		`SELECT cursor_value FROM cursors WHERE service = ?`, service,
 	).Scan(&cursor)
 	if err == sql.ErrNoRows {
@@ -187,7 +783,13 @@ func (r *Repository) GetCursor(ctx context.Context, service string) (int64, erro
 
 // UpdateCursor upserts the firehose cursor for a service.
 func (r *Repository) UpdateCursor(ctx context.Context, service string, cursor int64) error {
-	_, err := r.db.ExecContext(ctx, `
+	ctx, release, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = r.db.ExecContext(ctx, `
 		INSERT INTO cursors (service, cursor_value, updated_at)
 		VALUES (?, ?, ?)
 		ON CONFLICT (service) DO UPDATE SET
@@ -198,14 +800,53 @@ func (r *Repository) UpdateCursor(ctx context.Context, service string, cursor in
 	return err
 }
 
-func parseCursor(cursor string) (int64, string, error) {
-	parts := strings.SplitN(cursor, "::", 2)
-	if len(parts) != 2 {
-		return 0, "", fmt.Errorf("cursor must be in format 'timestamp::cid'")
+// encodeList serializes a string list as a JSON array for the langs and
+// matched_keywords columns.
+func encodeList(column string, values []string) (string, error) {
+	if values == nil {
+		values = []string{}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("encode %s: %w", column, err)
+	}
+	return string(data), nil
+}
+
+// formatCursor returns the cursor resuming after the post with the given
+// sort key.
+func formatCursor(millis int64, cid, uri string) string {
+	return fmt.Sprintf("%d::%s::%s", millis, cid, uri)
+}
+
+// parseCursor splits a cursor into its sort key. Cursors issued before the
+// URI tie-break was added have no URI part, and uri is then empty.
+func parseCursor(cursor string) (millis int64, cid, uri string, err error) {
+	parts := strings.SplitN(cursor, "::", 3)
+	if len(parts) < 2 {
+		return 0, "", "", fmt.Errorf("cursor must be in format 'timestamp::cid::uri'")
+	}
+	millis, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid timestamp in cursor: %w", err)
 	}
-	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if len(parts) == 3 {
+		uri = parts[2]
+	}
+	return millis, parts[1], uri, nil
+}
+
+// cursorCondition returns the WHERE clause fragment, and its arguments,
+// selecting the posts after cursor in feed order.
+func (r *Repository) cursorCondition(cursor string) (string, []any, error) {
+	millis, cid, uri, err := parseCursor(cursor)
 	if err != nil {
-		return 0, "", fmt.Errorf("invalid timestamp in cursor: %w", err)
+		return "", nil, fmt.Errorf("%w %q: %w", domain.ErrInvalidCursor, cursor, err)
+	}
+	if uri == "" {
+		return `
+		  AND (indexed_at, cid) < (?, ?)`, []any{millis, cidArg(cid, r.binaryCIDs)}, nil
 	}
-	return millis, parts[1], nil
+	return `
+		  AND (indexed_at, cid, uri) < (?, ?, ?)`, []any{millis, cidArg(cid, r.binaryCIDs), uri}, nil
 }
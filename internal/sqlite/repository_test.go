@@ -0,0 +1,180 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+const testFeedURI = "at://did:plc:publisher/app.bsky.feed.generator/test"
+
+func newTestRepository(t testing.TB, opts Options) *Repository {
+	t.Helper()
+	repo, err := NewRepository(t.TempDir()+"/feeds.db", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// testCID returns a valid base32 CIDv1 string derived from n, which is
+// stored in binary form when BinaryCIDs is set.
+func testCID(t testing.TB, n int) string {
+	t.Helper()
+	b := make([]byte, 36)
+	copy(b, []byte{0x01, 0x71, 0x12, 0x20})
+	b[len(b)-2], b[len(b)-1] = byte(n>>8), byte(n)
+	cid := cidFromBytes(b)
+	if _, ok := cidToBytes(cid); !ok {
+		t.Fatalf("test CID %s has no binary form", cid)
+	}
+	return cid
+}
+
+func TestGetFeedPostsPaginatesSameMillisecondBurst(t *testing.T) {
+	tests := []struct {
+		name       string
+		binaryCIDs bool
+		sharedCIDs bool // several posts have the same CID, so only the URI breaks ties
+	}{
+		{"text CIDs", false, false},
+		{"binary CIDs", true, false},
+		{"text CIDs shared", false, true},
+		{"binary CIDs shared", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t, Options{BinaryCIDs: tt.binaryCIDs})
+			ctx := context.Background()
+
+			const posts = 50
+			indexedAt := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+			for i := range posts {
+				cid := testCID(t, i)
+				if tt.sharedCIDs {
+					cid = testCID(t, i%3)
+				}
+				post := &domain.Post{
+					URI:       fmt.Sprintf("at://did:plc:author/app.bsky.feed.post/%03d", i),
+					CID:       cid,
+					IndexedAt: indexedAt,
+				}
+				if err := repo.CreatePost(ctx, post, []string{testFeedURI}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, limit := range []int{1, 3, 7, posts} {
+				seen := make(map[string]int)
+				cursor := ""
+				for pages := 0; ; pages++ {
+					if pages > posts {
+						t.Fatalf("limit %d: pagination did not end", limit)
+					}
+					page, next, err := repo.GetFeedPosts(ctx, testFeedURI, limit, cursor, nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, p := range page {
+						seen[p.URI]++
+					}
+					if next == "" {
+						break
+					}
+					cursor = next
+				}
+				if len(seen) != posts {
+					t.Errorf("limit %d: got %d distinct posts, want %d", limit, len(seen), posts)
+				}
+				for uri, n := range seen {
+					if n != 1 {
+						t.Errorf("limit %d: %s returned %d times", limit, uri, n)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetFeedPostsCursorAtExactBoundary(t *testing.T) {
+	const limit = 5
+	tests := []struct {
+		name       string
+		posts      int
+		wantCursor bool
+	}{
+		{"fewer than limit", limit - 1, false},
+		{"exactly limit", limit, false},
+		{"one more than limit", limit + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t, Options{})
+			ctx := context.Background()
+			start := time.Now().Add(-time.Hour)
+			for i := range tt.posts {
+				post := &domain.Post{
+					URI:       fmt.Sprintf("at://did:plc:author/app.bsky.feed.post/%d", i),
+					CID:       testCID(t, i),
+					IndexedAt: start.Add(time.Duration(i) * time.Second),
+				}
+				if err := repo.CreatePost(ctx, post, []string{testFeedURI}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			page, cursor, err := repo.GetFeedPosts(ctx, testFeedURI, limit, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := min(tt.posts, limit); len(page) != want {
+				t.Errorf("first page has %d posts, want %d", len(page), want)
+			}
+			if (cursor != "") != tt.wantCursor {
+				t.Fatalf("cursor = %q, want one: %t", cursor, tt.wantCursor)
+			}
+			if cursor == "" {
+				return
+			}
+			rest, next, err := repo.GetFeedPosts(ctx, testFeedURI, limit, cursor, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != tt.posts-limit || next != "" {
+				t.Errorf("second page has %d posts and cursor %q, want %d and none", len(rest), next, tt.posts-limit)
+			}
+		})
+	}
+}
+
+func TestRemovePost(t *testing.T) {
+	repo := newTestRepository(t, Options{})
+	ctx := context.Background()
+	const otherFeedURI = "at://did:plc:publisher/app.bsky.feed.generator/other"
+	const uri = "at://did:plc:author/app.bsky.feed.post/1"
+
+	post := &domain.Post{URI: uri, CID: testCID(t, 1), IndexedAt: time.Now(), Langs: []string{"en"}}
+	if err := repo.CreatePost(ctx, post, []string{testFeedURI, otherFeedURI}); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := repo.RemovePost(ctx, uri, []string{testFeedURI, "at://did:plc:publisher/app.bsky.feed.generator/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("RemovePost() = %d, want 1", removed)
+	}
+	for feedURI, want := range map[string]int64{testFeedURI: 0, otherFeedURI: 1} {
+		if n, err := repo.CountPosts(ctx, feedURI); err != nil || n != want {
+			t.Errorf("CountPosts(%s) = %d, %v, want %d", feedURI, n, err, want)
+		}
+	}
+	if tombstoned, err := repo.IsTombstoned(ctx, uri, time.Time{}); err != nil || tombstoned {
+		t.Errorf("IsTombstoned() = %t, %v, want false", tombstoned, err)
+	}
+}
@@ -0,0 +1,11 @@
+// Package version holds build metadata for the binaries.
+package version
+
+// Version is the release version, set at build time with
+// -ldflags "-X github.com/blackmichael/bluesky-feeds/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// UserAgent returns the default User-Agent sent on outbound requests.
+func UserAgent() string {
+	return "bluesky-feeds/" + Version
+}
@@ -0,0 +1,178 @@
+// Package webhook delivers feed match notifications to per-feed webhook URLs
+// in the background.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/blackmichael/bluesky-feeds/internal/domain"
+)
+
+const (
+	// queueSize bounds notifications waiting for a worker. Notifications
+	// beyond it are dropped rather than blocking the firehose.
+	queueSize = 1000
+
+	// maxAttempts is how many times a delivery is tried before giving up.
+	maxAttempts = 3
+
+	// requestTimeout bounds a single delivery attempt.
+	requestTimeout = 10 * time.Second
+
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of
+	// the request body, keyed with the configured secret.
+	SignatureHeader = "X-Feedgen-Signature"
+)
+
+// payload is the JSON body POSTed to a webhook.
+type payload struct {
+	FeedURI   string    `json:"feed_uri"`
+	PostURI   string    `json:"post_uri"`
+	AuthorDID string    `json:"author_did"`
+	Text      string    `json:"text"`
+	MatchedAt time.Time `json:"matched_at"`
+}
+
+type delivery struct {
+	url  string
+	body []byte
+}
+
+// Dispatcher implements domain.MatchNotifier. Notifications are queued and
+// POSTed by a fixed pool of workers, with retries, so callers never wait on
+// the network.
+type Dispatcher struct {
+	secret    []byte
+	workers   int
+	client    *http.Client
+	userAgent string
+	logger    *slog.Logger
+	queue     chan delivery
+}
+
+// NewDispatcher creates a Dispatcher that signs payloads with secret (unless
+// empty) and delivers them with the given number of workers. Call Run to
+// start delivering.
+func NewDispatcher(secret string, workers int, userAgent string, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		secret:    []byte(secret),
+		workers:   max(workers, 1),
+		client:    &http.Client{Timeout: requestTimeout},
+		userAgent: userAgent,
+		logger:    logger,
+		queue:     make(chan delivery, queueSize),
+	}
+}
+
+// NotifyMatch queues a notification that post matched feedURI. It never
+// blocks; if the queue is full the notification is dropped and logged.
+func (d *Dispatcher) NotifyMatch(webhookURL, feedURI string, post *domain.IncomingPost) {
+	body, err := json.Marshal(payload{
+		FeedURI:   feedURI,
+		PostURI:   post.URI,
+		AuthorDID: post.AuthorDID,
+		Text:      post.Text,
+		MatchedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		d.logger.Error("failed to encode webhook payload", "feed", feedURI, "error", err)
+		return
+	}
+
+	select {
+	case d.queue <- delivery{url: webhookURL, body: body}:
+	default:
+		d.logger.Warn("webhook queue full, dropping notification", "feed", feedURI, "post", post.URI)
+	}
+}
+
+// Run delivers queued notifications until ctx is cancelled. Notifications
+// still queued at that point are dropped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for range d.workers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case del := <-d.queue:
+					d.deliver(ctx, del)
+				}
+			}
+		}()
+	}
+	for range d.workers {
+		<-done
+	}
+}
+
+// deliver POSTs a notification, retrying with backoff on network errors,
+// 429s and 5xx responses.
+func (d *Dispatcher) deliver(ctx context.Context, del delivery) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, del)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == maxAttempts {
+			d.logger.Warn("webhook delivery failed", "url", del.url, "attempts", attempt, "error", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (d *Dispatcher) post(ctx context.Context, del delivery) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.url, bytes.NewReader(del.body))
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	if len(d.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(d.secret, del.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with secret, as sent in
+// SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}